@@ -1,175 +1,499 @@
-package client
-
-import (
-	"bufio"
-	"context"
-	"fmt"
-	"io"
-	"log"
-	"os"
-	"path/filepath"
-	"pcbook/pb"
-	"time"
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-)
-
-type LaptopClient struct {
-	service pb.LaptopServiceClient
-}
-
-func NewLaptopClient(cc *grpc.ClientConn) *LaptopClient {
-	return &LaptopClient{
-		service: pb.NewLaptopServiceClient(cc),
-	}
-}
-
-func (laptopClient *LaptopClient) CreateLaptop(laptop *pb.Laptop) {
-	req := &pb.CreateLaptopRequest{
-		Laptop: laptop,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	res, err := laptopClient.service.CreateLaptop(ctx, req)
-	if err != nil {
-		st, ok := status.FromError(err)
-		if ok && st.Code() == codes.AlreadyExists {
-			log.Print("laptop already exists")
-		} else {
-			log.Fatalf("failed to create laptop: %v", err)
-		}
-
-	}
-	log.Printf("created laptop with id: %v", res.Id)
-}
-
-func (laptopClient *LaptopClient) SearchLaptop(filter *pb.Filter) {
-	req := &pb.SearchLaptopRequest{
-		Filter: filter,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	stream, err := laptopClient.service.SearchLaptop(ctx, req)
-	if err != nil {
-		log.Fatalf("failed to search laptop: %v", err)
-	}
-
-	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
-			return
-		} else if err != nil {
-			log.Fatalf("failed to recv: %v", err)
-		} else {
-			laptop := res.GetLaptop()
-			log.Printf("-- found laptop: %v", laptop.GetId())
-			log.Printf("  + brand: %v", laptop.GetBrand())
-			log.Printf("  + name: %v", laptop.GetName())
-			log.Printf("  + price: %v", laptop.GetPriceUsd())
-			log.Printf("  + cpu cores: %v", laptop.GetCpu().NumberCores)
-			log.Printf("  + cpu min_ghz: %v", laptop.GetCpu().MinGhz)
-
-		}
-	}
-}
-
-func (laptopClient *LaptopClient) UploadImage(laptopId string, imagePath string) {
-	file, err := os.Open(imagePath)
-	if err != nil {
-		log.Fatalf("failed to open image: %v", err)
-	}
-	defer file.Close()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	stream, err := laptopClient.service.UploadImage(ctx)
-	if err != nil {
-		log.Fatalf("failed to upload image: %v", err)
-	}
-
-	req := &pb.UploadImageRequest{
-		Data: &pb.UploadImageRequest_Info{
-			Info: &pb.ImageInfo{
-				LaptopId:  laptopId,
-				ImageType: filepath.Ext(imagePath),
-			},
-		},
-	}
-	err = stream.Send(req)
-	if err != nil {
-		log.Fatalf("failed to send request: %v", err)
-	}
-
-	reader := bufio.NewReader(file)
-	buffer := make([]byte, 1024)
-	for {
-		n, err := reader.Read(buffer)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Fatalf("failed to read: %v", err)
-		}
-
-		err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: buffer[:n]}})
-		if err != nil {
-			log.Fatalf("failed to send chunk: %v", err)
-		}
-	}
-	res, err := stream.CloseAndRecv()
-	if err != nil {
-		log.Fatalf("failed to recv response: %v", err)
-	}
-	fmt.Printf("uploaded image with id: %s and size: %d\n", res.GetId(), res.GetSize())
-}
-
-func (laptopClient *LaptopClient) RateLaptop(laptopIds []string, ratings []float64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	stream, err := laptopClient.service.RateLaptop(ctx)
-	if err != nil {
-		log.Fatalf("failed to rate laptop: %v", err)
-	}
-	waitResponse := make(chan error)
-	// go routine to receive response
-	go func() {
-		for {
-			res, err := stream.Recv()
-			if err == io.EOF {
-				log.Print("no more response")
-				waitResponse <- nil
-				return
-			} else if err != nil {
-				waitResponse <- fmt.Errorf("failed to recv: %v", err)
-			}
-			log.Print("received response: ", res)
-		}
-	}()
-
-	//send request
-	for i, laptopId := range laptopIds {
-		req := &pb.RateLaptopRequest{
-			LaptopId: laptopId,
-			Rating:   ratings[i],
-		}
-		err := stream.Send(req)
-		if err != nil {
-			return fmt.Errorf("failed to send request: %v", err)
-		}
-
-		log.Print("sent request: ", req)
-
-	}
-	err = stream.CloseSend()
-	if err != nil {
-		return fmt.Errorf("cannot close send: %v", err)
-	}
-
-	err = <-waitResponse
-	return err
-}
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"pcbook/pb"
+	"time"
+
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type LaptopClient struct {
+	service pb.LaptopServiceClient
+}
+
+func NewLaptopClient(cc *grpc.ClientConn) *LaptopClient {
+	return &LaptopClient{
+		service: pb.NewLaptopServiceClient(cc),
+	}
+}
+
+func (laptopClient *LaptopClient) CreateLaptop(laptop *pb.Laptop) {
+	req := &pb.CreateLaptopRequest{
+		Laptop: laptop,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.CreateLaptop(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.AlreadyExists {
+			log.Print("laptop already exists")
+		} else {
+			log.Fatalf("failed to create laptop: %v", err)
+		}
+
+	}
+	log.Printf("created laptop with id: %v", res.Id)
+}
+
+// BulkCreateLaptops imports the laptops in batches of batchSize, one request per batch,
+// in atomic mode each batch is saved entirely or not at all.
+// It returns the result of every laptop in order
+func (laptopClient *LaptopClient) BulkCreateLaptops(laptops []*pb.Laptop, batchSize int, atomic bool) ([]*pb.BulkCreateResult, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size: %d", batchSize)
+	}
+
+	results := make([]*pb.BulkCreateResult, 0, len(laptops))
+	for start := 0; start < len(laptops); start += batchSize {
+		end := start + batchSize
+		if end > len(laptops) {
+			end = len(laptops)
+		}
+
+		res, err := laptopClient.bulkCreateBatch(laptops[start:end], atomic)
+		if err != nil {
+			return results, fmt.Errorf("cannot create laptops %d to %d: %w", start, end-1, err)
+		}
+		log.Printf("created %d of %d laptops", res.GetCreatedCount(), end-start)
+		results = append(results, res.GetResults()...)
+	}
+	return results, nil
+}
+
+func (laptopClient *LaptopClient) bulkCreateBatch(laptops []*pb.Laptop, atomic bool) (*pb.BulkCreateLaptopsResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stream, err := laptopClient.service.BulkCreateLaptops(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reqs := make([]*pb.BulkCreateLaptopsRequest, 0, len(laptops)+1)
+	reqs = append(reqs, &pb.BulkCreateLaptopsRequest{
+		Data: &pb.BulkCreateLaptopsRequest_Options{
+			Options: &pb.BulkCreateOptions{Atomic: atomic},
+		},
+	})
+	for _, laptop := range laptops {
+		reqs = append(reqs, &pb.BulkCreateLaptopsRequest{
+			Data: &pb.BulkCreateLaptopsRequest_Laptop{
+				Laptop: laptop,
+			},
+		})
+	}
+
+	for _, req := range reqs {
+		err = stream.Send(req)
+		if err == io.EOF {
+			// the server has closed the stream, the error is returned by CloseAndRecv
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot send request: %w", err)
+		}
+	}
+
+	return stream.CloseAndRecv()
+}
+
+func (laptopClient *LaptopClient) GetLaptop(id string) (*pb.Laptop, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.GetLaptop(ctx, &pb.GetLaptopRequest{Id: id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get laptop: %w", err)
+	}
+	return res.GetLaptop(), nil
+}
+
+// ListLaptops fetches all laptops in the given order, page by page
+func (laptopClient *LaptopClient) ListLaptops(orderBy string, pageSize int32) ([]*pb.Laptop, error) {
+	req := &pb.ListLaptopsRequest{
+		PageSize: pageSize,
+		OrderBy:  orderBy,
+	}
+
+	var laptops []*pb.Laptop
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		res, err := laptopClient.service.ListLaptops(ctx, req)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list laptops: %w", err)
+		}
+
+		laptops = append(laptops, res.GetLaptops()...)
+		if len(res.GetNextPageToken()) == 0 {
+			return laptops, nil
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+}
+
+// UpdateLaptop updates the given fields of laptop, laptop.UpdatedAt must be the last value seen by the client
+func (laptopClient *LaptopClient) UpdateLaptop(laptop *pb.Laptop, paths ...string) (*pb.Laptop, error) {
+	req := &pb.UpdateLaptopRequest{
+		Laptop:     laptop,
+		UpdateMask: &field_mask.FieldMask{Paths: paths},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.UpdateLaptop(ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if ok && st.Code() == codes.Aborted {
+			log.Print("laptop has been modified by others")
+		}
+		return nil, fmt.Errorf("failed to update laptop: %w", err)
+	}
+	log.Printf("updated laptop with id: %v", res.GetLaptop().GetId())
+	return res.GetLaptop(), nil
+}
+
+func (laptopClient *LaptopClient) SearchLaptop(filter *pb.Filter) {
+	req := &pb.SearchLaptopRequest{
+		Filter: filter,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := laptopClient.service.SearchLaptop(ctx, req)
+	if err != nil {
+		log.Fatalf("failed to search laptop: %v", err)
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Fatalf("failed to recv: %v", err)
+		} else {
+			laptop := res.GetLaptop()
+			log.Printf("-- found laptop: %v", laptop.GetId())
+			log.Printf("  + brand: %v", laptop.GetBrand())
+			log.Printf("  + name: %v", laptop.GetName())
+			log.Printf("  + price: %v", laptop.GetPriceUsd())
+			log.Printf("  + cpu cores: %v", laptop.GetCpu().NumberCores)
+			log.Printf("  + cpu min_ghz: %v", laptop.GetCpu().MinGhz)
+
+		}
+	}
+}
+
+// WatchLaptops calls handle for every change of the laptops matching the filter after the start revision,
+// until the context is done
+func (laptopClient *LaptopClient) WatchLaptops(ctx context.Context, filter *pb.Filter, startRevision uint64, handle func(event *pb.LaptopEvent) error) error {
+	req := &pb.WatchLaptopsRequest{
+		Filter:        filter,
+		StartRevision: startRevision,
+	}
+
+	stream, err := laptopClient.service.WatchLaptops(ctx, req)
+	if err != nil {
+		return fmt.Errorf("cannot watch laptops: %w", err)
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot receive event: %w", err)
+		}
+
+		err = handle(res.GetEvent())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+const (
+	uploadChunkSize = 64 << 10
+	// maxUploadAttempts is how many times an upload is resumed after a transport error
+	maxUploadAttempts = 5
+)
+
+// uploadRetryCodes are the status codes of the transport errors after which an upload is resumed
+var uploadRetryCodes = map[codes.Code]bool{
+	codes.Unavailable:      true,
+	codes.DeadlineExceeded: true,
+	codes.Aborted:          true,
+}
+
+// UploadImage uploads an image in a resumable session, after a transport error
+// the upload goes on from the size committed by the server
+func (laptopClient *LaptopClient) UploadImage(laptopId string, imagePath string) (*pb.Image, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.StartUploadRequest{
+		Info: &pb.ImageInfo{
+			LaptopId:  laptopId,
+			ImageType: filepath.Ext(imagePath),
+		},
+	}
+	start, err := laptopClient.service.StartUpload(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start upload: %w", err)
+	}
+	uploadId := start.GetUploadId()
+
+	var offset int64
+	for attempt := 1; ; attempt++ {
+		err = laptopClient.uploadChunks(uploadId, file, offset)
+		if err == nil {
+			break
+		}
+		if attempt >= maxUploadAttempts || !uploadRetryCodes[status.Code(err)] {
+			return nil, fmt.Errorf("failed to upload image: %w", err)
+		}
+
+		log.Printf("upload %s is interrupted, resuming: %v", uploadId, err)
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+
+		// on failure the chunks are sent again from the last known offset, the server skips what it has
+		committed, err := laptopClient.queryUpload(uploadId)
+		if err == nil {
+			offset = committed
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := laptopClient.service.FinishUpload(ctx, &pb.FinishUploadRequest{
+		UploadId: uploadId,
+		Size:     uint64(size),
+		Sha256:   hex.EncodeToString(hash.Sum(nil)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish upload: %w", err)
+	}
+	log.Printf("uploaded image with id: %s and size: %d", res.GetImage().GetId(), res.GetImage().GetSize())
+	return res.GetImage(), nil
+}
+
+// uploadChunks sends the file from the offset to the end
+func (laptopClient *LaptopClient) uploadChunks(uploadId string, file *os.File, offset int64) error {
+	_, err := file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek image: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := laptopClient.service.UploadChunks(ctx)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	buffer := make([]byte, uploadChunkSize)
+	for {
+		n, err := io.ReadFull(reader, buffer)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+
+		req := &pb.UploadChunkRequest{
+			UploadId:  uploadId,
+			Offset:    uint64(offset),
+			ChunkData: buffer[:n],
+		}
+		err = stream.Send(req)
+		if err == io.EOF {
+			// the server has closed the stream, the error comes with CloseAndRecv
+			break
+		} else if err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func (laptopClient *LaptopClient) queryUpload(uploadId string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := laptopClient.service.QueryUpload(ctx, &pb.QueryUploadRequest{UploadId: uploadId})
+	if err != nil {
+		return 0, err
+	}
+	return int64(res.GetCommittedSize()), nil
+}
+
+// ListImages returns the images of a laptop in upload order
+func (laptopClient *LaptopClient) ListImages(laptopId string) ([]*pb.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.ListImages(ctx, &pb.ListImagesRequest{LaptopId: laptopId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	return res.GetImages(), nil
+}
+
+// DownloadImage writes the data of an image or of one of its variants to w and returns its info
+func (laptopClient *LaptopClient) DownloadImage(imageId string, size pb.Image_Variant, w io.Writer) (*pb.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stream, err := laptopClient.service.DownloadImage(ctx, &pb.DownloadImageRequest{ImageId: imageId, Size: size})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to recv image info: %w", err)
+	}
+	image := res.GetInfo()
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return image, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to recv chunk: %w", err)
+		}
+
+		_, err = w.Write(res.GetChunkData())
+		if err != nil {
+			return nil, fmt.Errorf("failed to write chunk: %w", err)
+		}
+	}
+}
+
+func (laptopClient *LaptopClient) DeleteImage(imageId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := laptopClient.service.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: imageId})
+	if err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+	return nil
+}
+
+func (laptopClient *LaptopClient) SetPrimaryImage(imageId string) (*pb.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.SetPrimaryImage(ctx, &pb.SetPrimaryImageRequest{ImageId: imageId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set primary image: %w", err)
+	}
+	return res.GetImage(), nil
+}
+
+func (laptopClient *LaptopClient) RateLaptop(laptopIds []string, ratings []float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := laptopClient.service.RateLaptop(ctx)
+	if err != nil {
+		log.Fatalf("failed to rate laptop: %v", err)
+	}
+	waitResponse := make(chan error)
+	// go routine to receive response
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				log.Print("no more response")
+				waitResponse <- nil
+				return
+			} else if err != nil {
+				waitResponse <- fmt.Errorf("failed to recv: %v", err)
+			}
+			log.Print("received response: ", res)
+		}
+	}()
+
+	//send request
+	for i, laptopId := range laptopIds {
+		req := &pb.RateLaptopRequest{
+			LaptopId: laptopId,
+			Rating:   ratings[i],
+		}
+		err := stream.Send(req)
+		if err != nil {
+			return fmt.Errorf("failed to send request: %v", err)
+		}
+
+		log.Print("sent request: ", req)
+
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return fmt.Errorf("cannot close send: %v", err)
+	}
+
+	err = <-waitResponse
+	return err
+}
+
+// DeleteRating removes the rating of a laptop by the user and returns the rating of the laptop
+func (laptopClient *LaptopClient) DeleteRating(laptopId string) (*pb.DeleteRatingResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.DeleteRating(ctx, &pb.DeleteRatingRequest{LaptopId: laptopId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete rating: %w", err)
+	}
+	return res, nil
+}
+
+// GetMyRatings returns the ratings of the user, the most recent first
+func (laptopClient *LaptopClient) GetMyRatings() ([]*pb.UserRating, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.GetMyRatings(ctx, &pb.GetMyRatingsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ratings: %w", err)
+	}
+	return res.GetRatings(), nil
+}
+
+func (laptopClient *LaptopClient) GetRatingSummary(laptopId string) (*pb.RatingSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := laptopClient.service.GetRatingSummary(ctx, &pb.GetRatingSummaryRequest{LaptopId: laptopId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rating summary: %w", err)
+	}
+	return res.GetSummary(), nil
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"pcbook/pb"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+type ReviewClient struct {
+	service pb.ReviewServiceClient
+}
+
+func NewReviewClient(cc *grpc.ClientConn) *ReviewClient {
+	return &ReviewClient{
+		service: pb.NewReviewServiceClient(cc),
+	}
+}
+
+// CreateReview submits a review of the user, it is published once a moderator approves it
+func (reviewClient *ReviewClient) CreateReview(review *pb.Review) (*pb.Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := reviewClient.service.CreateReview(ctx, &pb.CreateReviewRequest{Review: review})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create review: %w", err)
+	}
+	return res.GetReview(), nil
+}
+
+// ListReviews fetches all the visible reviews of a laptop in the given state, page by page
+func (reviewClient *ReviewClient) ListReviews(laptopId string, state pb.Review_State, pageSize int32) ([]*pb.Review, error) {
+	req := &pb.ListReviewsRequest{
+		LaptopId: laptopId,
+		State:    state,
+		PageSize: pageSize,
+	}
+
+	var reviews []*pb.Review
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		res, err := reviewClient.service.ListReviews(ctx, req)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list reviews: %w", err)
+		}
+		reviews = append(reviews, res.GetReviews()...)
+		if res.GetNextPageToken() == "" {
+			return reviews, nil
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+}
+
+func (reviewClient *ReviewClient) VoteReview(reviewId string, helpful bool) (*pb.Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := reviewClient.service.VoteReview(ctx, &pb.VoteReviewRequest{ReviewId: reviewId, Helpful: helpful})
+	if err != nil {
+		return nil, fmt.Errorf("failed to vote on review: %w", err)
+	}
+	return res.GetReview(), nil
+}
+
+func (reviewClient *ReviewClient) ModerateReview(reviewId string, state pb.Review_State, note string) (*pb.Review, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := reviewClient.service.ModerateReview(ctx, &pb.ModerateReviewRequest{ReviewId: reviewId, State: state, Note: note})
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate review: %w", err)
+	}
+	return res.GetReview(), nil
+}
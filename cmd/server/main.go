@@ -1,172 +1,336 @@
-package main
-
-import (
-	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"flag"
-	"fmt"
-	"io/ioutil"
-	"log"
-	"net"
-	"net/http"
-	"pcbook/pb"
-	"pcbook/service"
-	"time"
-
-	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/reflection"
-)
-
-const (
-	secretKey        = "secret"
-	tokenDuration    = time.Minute * 10
-	serverCertFile   = "cert/server-cert.pem"
-	serverCertKey    = "cert/server-key.pem"
-	clientCACertFile = "cert/ca-cert.pem"
-)
-
-func main() {
-	port := flag.Int("port", 0, "the server port")
-	enableTLS := flag.Bool("tls", false, "enable SSL/TLS")
-	serverType := flag.String("type", "grpc", "server type, grpc or rest")
-	endPoint := flag.String("endpoint", "", "grpc endpoint")
-	flag.Parse()
-
-	jwtManager := service.NewJWTManager(secretKey, tokenDuration)
-	userStore := service.NewInMemoryUserStore()
-	authServer := service.NewAuthServer(userStore, jwtManager)
-	err := seedUsers(userStore)
-	if err != nil {
-		log.Fatal("failed to seed users: ", err)
-	}
-
-	laptopServer := service.NewLaptopServer(service.NewInMemoryLaptopStore(), service.NewDiskImageStore("img"), service.NewInMemoryRatingStore())
-
-	address := fmt.Sprintf("0.0.0.0:%d", *port)
-	listener, err := net.Listen("tcp", address)
-	if err != nil {
-		log.Fatal("failed to listen: ", err)
-	}
-
-	if *serverType == "grpc" {
-		err = runGRPCServer(authServer, laptopServer, jwtManager, *enableTLS, listener)
-	} else if *serverType == "rest" {
-		err = runRESTServer(authServer, laptopServer, jwtManager, *enableTLS, listener, *endPoint)
-	} else {
-		log.Fatal("unknown server type: ", *serverType)
-	}
-	if err != nil {
-		log.Fatal("failed to start server: ", err)
-	}
-}
-
-func runGRPCServer(authServer pb.AuthServiceServer, laptopServer pb.LaptopServiceServer, jwtManager *service.JWTMaganer, enableTLS bool, listener net.Listener) error {
-	interceptor := service.NewAuthInterceptor(jwtManager, accessibleRoles())
-	serverOption := []grpc.ServerOption{
-		grpc.UnaryInterceptor(interceptor.Unary()),
-		grpc.StreamInterceptor(interceptor.Stream()),
-	}
-
-	if enableTLS {
-		tlsCredentials, err := loadTLSCredentials()
-		if err != nil {
-			return fmt.Errorf("failed to load tls credentials: %w", err)
-		}
-		serverOption = append(serverOption, grpc.Creds(tlsCredentials))
-	}
-
-	grpcServer := grpc.NewServer(serverOption...)
-
-	pb.RegisterAuthServiceServer(grpcServer, authServer)
-	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
-	reflection.Register(grpcServer)
-
-	log.Printf("start GRPC server at: %s, TLS=%t", listener.Addr().String(), enableTLS)
-	return grpcServer.Serve(listener)
-}
-
-func runRESTServer(authServer pb.AuthServiceServer,
-	laptopServer pb.LaptopServiceServer,
-	jwtManager *service.JWTMaganer,
-	enableTLS bool,
-	listener net.Listener,
-	grpcEndpoint string) error {
-	mux := runtime.NewServeMux()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	dailOptions := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
-
-	err := pb.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint, dailOptions)
-	if err != nil {
-		return err
-	}
-	err = pb.RegisterLaptopServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint, dailOptions)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("start REST server at: %s, TLS=%t", listener.Addr().String(), enableTLS)
-	// Start HTTP server (and proxy calls to gRPC server endpoint)
-	if enableTLS {
-		return http.ServeTLS(listener, mux, serverCertFile, serverCertKey)
-	}
-	return http.Serve(listener, mux)
-
-}
-
-func loadTLSCredentials() (credentials.TransportCredentials, error) {
-	//Load server's certificate and private key
-	serverCert, err := tls.LoadX509KeyPair(serverCertFile, serverCertKey)
-	if err != nil {
-		return nil, err
-	}
-
-	//Load certificate of the CA who signed the client's certificate
-	pemClientCA, err := ioutil.ReadFile(clientCACertFile)
-	if err != nil {
-		return nil, err
-	}
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(pemClientCA) {
-		return nil, fmt.Errorf("failed to append ca certs")
-	}
-
-	config := &tls.Config{
-		Certificates: []tls.Certificate{serverCert},
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ClientCAs:    certPool,
-	}
-	return credentials.NewTLS(config), nil
-}
-
-func accessibleRoles() map[string][]string {
-	const laptopServerPath = "/pcbook.LaptopService/"
-	return map[string][]string{
-		laptopServerPath + "CreateLaptop": {"admin"},
-		laptopServerPath + "UplaodImage":  {"admin"},
-		laptopServerPath + "RateLaptop":   {"admin", "user"},
-		// laptopServerPath + "SearchLaptop":   {any},
-	}
-}
-
-func seedUsers(userStore service.UserStore) error {
-	err := createUser(userStore, "admin1", "secret_admin", "admin")
-	if err != nil {
-		return err
-	}
-	return createUser(userStore, "user1", "secret_user", "user")
-}
-
-func createUser(userStore service.UserStore, username, password, role string) error {
-	user, err := service.NewUser(username, password, role)
-	if err != nil {
-		return err
-	}
-	return userStore.Save(user)
-}
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"pcbook/pb"
+	"pcbook/service"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	secretKey        = "secret"
+	tokenDuration    = time.Minute * 10
+	serverCertFile   = "cert/server-cert.pem"
+	serverCertKey    = "cert/server-key.pem"
+	clientCACertFile = "cert/ca-cert.pem"
+)
+
+func main() {
+	port := flag.Int("port", 0, "the server port")
+	enableTLS := flag.Bool("tls", false, "enable SSL/TLS")
+	serverType := flag.String("type", "grpc", "server type, grpc or rest")
+	endPoint := flag.String("endpoint", "", "grpc endpoint")
+	restPort := flag.Int("rest-port", 0, "port of the REST gateway served by the grpc server, which also serves the images")
+	storeType := flag.String("store", "memory", "store type, memory, file or sqlite")
+	dbPath := flag.String("db", "pcbook.db", "database file of the sqlite stores")
+	dataDir := flag.String("data-dir", "data", "directory of the file laptop store")
+	fsync := flag.String("fsync", "always", "when the file laptop store flushes its log, always, interval or never")
+	fsyncInterval := flag.Duration("fsync-interval", time.Second, "flush interval of the file laptop store")
+	snapshotEvery := flag.Int("snapshot-every", 10000, "number of log records after which the file laptop store writes a snapshot")
+	maxImageSize := flag.Int64("max-image-size", service.DefaultMaxImageSize, "size limit of an uploaded image in bytes")
+	maxImageWidth := flag.Int("max-image-width", service.DefaultMaxImageDimension, "width limit of an uploaded image in pixels")
+	maxImageHeight := flag.Int("max-image-height", service.DefaultMaxImageDimension, "height limit of an uploaded image in pixels")
+	imageStoreType := flag.String("image-store", "disk", "image store type, disk, content or s3")
+	imageGCInterval := flag.Duration("image-gc-interval", 10*time.Minute, "how often the content image store removes unreferenced blobs")
+	s3Endpoint := flag.String("s3-endpoint", "", "URL of the S3 compatible API of the s3 image store")
+	s3Bucket := flag.String("s3-bucket", "pcbook", "bucket of the s3 image store")
+	s3Region := flag.String("s3-region", "us-east-1", "region of the s3 image store")
+	s3Timeout := flag.Duration("s3-timeout", service.DefaultS3Timeout, "time limit of a request of the s3 image store")
+	uploadDir := flag.String("upload-dir", "uploads", "directory of the unfinished resumable uploads")
+	uploadTTL := flag.Duration("upload-ttl", service.DefaultUploadTTL, "how long an unfinished upload is kept without a chunk")
+	ratingMin := flag.Float64("rating-min", service.DefaultRatingMin, "lowest rating of the scale")
+	ratingMax := flag.Float64("rating-max", service.DefaultRatingMax, "highest rating of the scale")
+	ratingPrecision := flag.Float64("rating-precision", service.DefaultRatingPrecision, "step of the ratings from the lowest one")
+	ratingPriorMean := flag.Float64("rating-prior-mean", 0, "prior mean of the Bayesian average rating, the middle of the scale if it is 0")
+	ratingPriorWeight := flag.Float64("rating-prior-weight", service.DefaultRatingPriorWeight, "number of ratings the prior of the Bayesian average counts as")
+	ratingHalfLife := flag.Duration("rating-half-life", service.DefaultRatingHalfLife, "age at which a rating weighs half in the time-decayed rating")
+	bannedWords := flag.String("banned-words", "", "comma separated words which reject a review containing them")
+	flag.Parse()
+
+	if *serverType != "grpc" && *serverType != "rest" {
+		log.Fatal("unknown server type: ", *serverType)
+	}
+
+	jwtManager := service.NewJWTManager(secretKey, tokenDuration)
+	address := fmt.Sprintf("0.0.0.0:%d", *port)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal("failed to listen: ", err)
+	}
+
+	if *serverType == "rest" {
+		// a standalone gateway only proxies the services, so it opens none of the stores of the grpc server.
+		// The images are served with -rest-port of the grpc server
+		err = runRESTServer(nil, jwtManager, *enableTLS, listener, *endPoint)
+		if err != nil {
+			log.Fatal("failed to start server: ", err)
+		}
+		return
+	}
+
+	laptopStore, userStore, ratingStore, reviewStore, err := newStores(*storeType, *dbPath, *dataDir, *fsync, *fsyncInterval, *snapshotEvery)
+	if err != nil {
+		log.Fatal("failed to create stores: ", err)
+	}
+
+	authServer := service.NewAuthServer(userStore, jwtManager)
+	err = seedUsers(userStore)
+	if err != nil {
+		log.Fatal("failed to seed users: ", err)
+	}
+
+	imageStore, err := newImageStore(*imageStoreType, service.DiskImageStoreConfig{
+		Folder:       "img",
+		MaxImageSize: *maxImageSize,
+		MaxWidth:     *maxImageWidth,
+		MaxHeight:    *maxImageHeight,
+	}, *imageGCInterval, service.S3ImageStoreConfig{
+		Endpoint:  *s3Endpoint,
+		Bucket:    *s3Bucket,
+		Region:    *s3Region,
+		Timeout:   *s3Timeout,
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+		log.Fatal("failed to create image store: ", err)
+	}
+	uploadStore, err := service.NewUploadSessionStore(service.UploadSessionConfig{
+		Folder:       *uploadDir,
+		TTL:          *uploadTTL,
+		MaxImageSize: *maxImageSize,
+	})
+	if err != nil {
+		log.Fatal("failed to create upload store: ", err)
+	}
+	if *ratingMin >= *ratingMax {
+		log.Fatalf("rating scale %v to %v is empty", *ratingMin, *ratingMax)
+	}
+	ratingConfig := service.RatingConfig{
+		Min:         *ratingMin,
+		Max:         *ratingMax,
+		Precision:   *ratingPrecision,
+		PriorMean:   *ratingPriorMean,
+		PriorWeight: *ratingPriorWeight,
+		HalfLife:    *ratingHalfLife,
+	}
+	laptopServer := service.NewLaptopServerWithConfig(laptopStore, imageStore, ratingStore, service.LaptopServerConfig{
+		UploadStore: uploadStore,
+		ReviewStore: reviewStore,
+		Rating:      ratingConfig,
+	})
+	reviewServer := service.NewReviewServer(reviewStore, laptopStore, service.ReviewServerConfig{
+		Screener:       service.NewBannedWordFilter(strings.Split(*bannedWords, ",")...),
+		ModeratorRoles: accessibleRoles()["/my.pcbook.ReviewService/ModerateReview"],
+		Rating:         ratingConfig,
+	})
+
+	if *restPort != 0 {
+		restListener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", *restPort))
+		if err != nil {
+			log.Fatal("failed to listen: ", err)
+		}
+		// the image handlers need the stores of the grpc server, so the gateway runs in the same process
+		imageHandler := service.NewImageHTTPHandler(laptopStore, imageStore)
+		go func() {
+			err := runRESTServer(imageHandler, jwtManager, *enableTLS, restListener, listener.Addr().String())
+			log.Fatal("failed to start REST server: ", err)
+		}()
+	}
+	err = runGRPCServer(authServer, laptopServer, reviewServer, jwtManager, *enableTLS, listener)
+	if err != nil {
+		log.Fatal("failed to start server: ", err)
+	}
+}
+
+func newStores(storeType, dbPath, dataDir, fsync string, fsyncInterval time.Duration, snapshotEvery int) (service.LaptopStore, service.UserStore, service.RatingStore, service.ReviewStore, error) {
+	switch storeType {
+	case "memory":
+		return service.NewInMemoryLaptopStore(), service.NewInMemoryUserStore(), service.NewInMemoryRatingStore(), service.NewInMemoryReviewStore(), nil
+	case "file":
+		syncPolicy, err := service.ParseSyncPolicy(fsync)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		laptopStore, err := service.NewFileLaptopStore(service.FileLaptopStoreConfig{
+			Dir:           dataDir,
+			SyncPolicy:    syncPolicy,
+			SyncInterval:  fsyncInterval,
+			SnapshotEvery: snapshotEvery,
+		})
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		return laptopStore, service.NewInMemoryUserStore(), service.NewInMemoryRatingStore(), service.NewInMemoryReviewStore(), nil
+	case "sqlite":
+		db, err := service.OpenSQLiteDatabase(dbPath)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		return service.NewSQLLaptopStore(db), service.NewSQLUserStore(db), service.NewSQLRatingStore(db), service.NewSQLReviewStore(db), nil
+	default:
+		return nil, nil, nil, nil, fmt.Errorf("unknown store type: %s", storeType)
+	}
+}
+
+// newImageStore returns the image store of the type, the s3 store takes the limits of the config
+func newImageStore(imageStoreType string, config service.DiskImageStoreConfig, gcInterval time.Duration, s3Config service.S3ImageStoreConfig) (service.ImageStore, error) {
+	switch imageStoreType {
+	case "disk":
+		return service.NewDiskImageStoreWithConfig(config), nil
+	case "content":
+		return service.NewContentImageStore(service.ContentImageStoreConfig{
+			Folder:       config.Folder,
+			MaxImageSize: config.MaxImageSize,
+			MaxWidth:     config.MaxWidth,
+			MaxHeight:    config.MaxHeight,
+			GCInterval:   gcInterval,
+		})
+	case "s3":
+		s3Config.MaxImageSize = config.MaxImageSize
+		s3Config.MaxWidth = config.MaxWidth
+		s3Config.MaxHeight = config.MaxHeight
+		return service.NewS3ImageStore(s3Config)
+	default:
+		return nil, fmt.Errorf("unknown image store type: %s", imageStoreType)
+	}
+}
+
+func runGRPCServer(authServer pb.AuthServiceServer, laptopServer pb.LaptopServiceServer, reviewServer pb.ReviewServiceServer, jwtManager *service.JWTMaganer, enableTLS bool, listener net.Listener) error {
+	interceptor := service.NewAuthInterceptor(jwtManager, accessibleRoles())
+	serverOption := []grpc.ServerOption{
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	}
+
+	if enableTLS {
+		tlsCredentials, err := loadTLSCredentials()
+		if err != nil {
+			return fmt.Errorf("failed to load tls credentials: %w", err)
+		}
+		serverOption = append(serverOption, grpc.Creds(tlsCredentials))
+	}
+
+	grpcServer := grpc.NewServer(serverOption...)
+
+	pb.RegisterAuthServiceServer(grpcServer, authServer)
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	pb.RegisterReviewServiceServer(grpcServer, reviewServer)
+	reflection.Register(grpcServer)
+
+	log.Printf("start GRPC server at: %s, TLS=%t", listener.Addr().String(), enableTLS)
+	return grpcServer.Serve(listener)
+}
+
+func runRESTServer(imageHandler *service.ImageHTTPHandler,
+	jwtManager *service.JWTMaganer,
+	enableTLS bool,
+	listener net.Listener,
+	grpcEndpoint string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dailOptions := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+
+	mux, err := service.NewRESTGateway(ctx, grpcEndpoint, dailOptions, imageHandler, service.NewAuthInterceptor(jwtManager, accessibleRoles()))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("start REST server at: %s, TLS=%t", listener.Addr().String(), enableTLS)
+	// Start HTTP server (and proxy calls to gRPC server endpoint)
+	if enableTLS {
+		return http.ServeTLS(listener, mux, serverCertFile, serverCertKey)
+	}
+	return http.Serve(listener, mux)
+
+}
+
+func loadTLSCredentials() (credentials.TransportCredentials, error) {
+	//Load server's certificate and private key
+	serverCert, err := tls.LoadX509KeyPair(serverCertFile, serverCertKey)
+	if err != nil {
+		return nil, err
+	}
+
+	//Load certificate of the CA who signed the client's certificate
+	pemClientCA, err := ioutil.ReadFile(clientCACertFile)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pemClientCA) {
+		return nil, fmt.Errorf("failed to append ca certs")
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    certPool,
+	}
+	return credentials.NewTLS(config), nil
+}
+
+func accessibleRoles() map[string][]string {
+	const laptopServerPath = "/my.pcbook.LaptopService/"
+	const reviewServerPath = "/my.pcbook.ReviewService/"
+	return map[string][]string{
+		laptopServerPath + "CreateLaptop":      {"admin"},
+		laptopServerPath + "BulkCreateLaptops": {"admin"},
+		laptopServerPath + "UpdateLaptop":      {"admin"},
+		laptopServerPath + "DeleteLaptop":      {"admin"},
+		laptopServerPath + "PurgeDeleted":      {"admin"},
+		laptopServerPath + "UploadImage":       {"admin"},
+		laptopServerPath + "StartUpload":       {"admin"},
+		laptopServerPath + "UploadChunks":      {"admin"},
+		laptopServerPath + "QueryUpload":       {"admin"},
+		laptopServerPath + "FinishUpload":      {"admin"},
+		laptopServerPath + "DeleteImage":       {"admin"},
+		laptopServerPath + "SetPrimaryImage":   {"admin"},
+		laptopServerPath + "RateLaptop":        {"admin", "user"},
+		laptopServerPath + "DeleteRating":      {"admin", "user"},
+		laptopServerPath + "GetMyRatings":      {"admin", "user"},
+		// laptopServerPath + "SearchLaptop":   {any},
+		reviewServerPath + "CreateReview":   {"admin", "user"},
+		reviewServerPath + "VoteReview":     {"admin", "user"},
+		reviewServerPath + "ModerateReview": {"admin"},
+		// reviewServerPath + "ListReviews":  {any}, the approved reviews unless the caller is a moderator
+	}
+}
+
+func seedUsers(userStore service.UserStore) error {
+	err := createUser(userStore, "admin1", "secret_admin", "admin")
+	if err != nil {
+		return err
+	}
+	return createUser(userStore, "user1", "secret_user", "user")
+}
+
+func createUser(userStore service.UserStore, username, password, role string) error {
+	user, err := service.NewUser(username, password, role)
+	if err != nil {
+		return err
+	}
+	err = userStore.Save(user)
+	if errors.Is(err, service.ErrAlreadyExists) {
+		// seeded by a previous run
+		return nil
+	}
+	return err
+}
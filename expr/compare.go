@@ -0,0 +1,169 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func compileComparison(op token, lhs, rhs *node) (*node, error) {
+	var err error
+	lhs, rhs, err = coerceEnums(lhs, rhs)
+	if err != nil {
+		return nil, err
+	}
+
+	compare, err := compareFunc(op, lhs.typ, rhs.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var result func(c int) bool
+	switch op.text {
+	case "==":
+		result = func(c int) bool { return c == 0 }
+	case "!=":
+		result = func(c int) bool { return c != 0 }
+	case "<":
+		result = func(c int) bool { return c < 0 }
+	case "<=":
+		result = func(c int) bool { return c <= 0 }
+	case ">":
+		result = func(c int) bool { return c > 0 }
+	default:
+		result = func(c int) bool { return c >= 0 }
+	}
+
+	left, right := lhs.eval, rhs.eval
+	return &node{typ: boolType, pos: lhs.pos, eval: func(env *env) interface{} {
+		return result(compare(left(env), right(env)))
+	}}, nil
+}
+
+func compileIn(op token, lhs, rhs *node) (*node, error) {
+	if rhs.typ.kind != listKind {
+		return nil, newError(rhs.pos, fmt.Sprintf("right operand of \"in\" must be a list, got %v", rhs.typ))
+	}
+
+	if lhs.typ.kind == enumKind && rhs.elems != nil {
+		elems := make([]*node, len(rhs.elems))
+		for i, elem := range rhs.elems {
+			_, converted, err := coerceEnums(lhs, elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = converted
+		}
+		rhs = listNode(&exprType{kind: listKind, elem: lhs.typ}, rhs.pos, elems)
+	}
+
+	compare, err := compareFunc(token{kind: tokenOperator, text: "==", pos: op.pos}, lhs.typ, rhs.typ.elem)
+	if err != nil {
+		return nil, newError(op.pos, fmt.Sprintf("cannot look for %v in %v", lhs.typ, rhs.typ))
+	}
+
+	left, right := lhs.eval, rhs.eval
+	return &node{typ: boolType, pos: lhs.pos, eval: func(env *env) interface{} {
+		value := left(env)
+		for _, elem := range right(env).([]interface{}) {
+			if compare(value, elem) == 0 {
+				return true
+			}
+		}
+		return false
+	}}, nil
+}
+
+// coerceEnums replaces a string constant compared with an enum by the enum number
+func coerceEnums(lhs, rhs *node) (*node, *node, error) {
+	var err error
+	if lhs.typ.kind == enumKind && rhs.typ.kind == stringKind && rhs.constant {
+		rhs, err = enumConstant(lhs.typ, rhs)
+	} else if rhs.typ.kind == enumKind && lhs.typ.kind == stringKind && lhs.constant {
+		lhs, err = enumConstant(rhs.typ, lhs)
+	}
+	return lhs, rhs, err
+}
+
+func enumConstant(typ *exprType, name *node) (*node, error) {
+	text := name.eval(nil).(string)
+	value := typ.enum.Values().ByName(protoreflect.Name(strings.ToUpper(text)))
+	if value == nil {
+		return nil, newError(name.pos, fmt.Sprintf("unknown value %q of %v", text, typ))
+	}
+	return constantNode(typ, name.pos, int64(value.Number())), nil
+}
+
+// compareFunc returns a function comparing values of the two types like strings.Compare
+func compareFunc(op token, lhs, rhs *exprType) (func(a, b interface{}) int, error) {
+	ordered := op.text != "==" && op.text != "!="
+
+	switch {
+	case lhs.isNumeric() && rhs.isNumeric():
+		if lhs.kind == intKind && rhs.kind == intKind {
+			return func(a, b interface{}) int {
+				return compareInt(a.(int64), b.(int64))
+			}, nil
+		}
+		return func(a, b interface{}) int {
+			return compareFloat(toFloat(a), toFloat(b))
+		}, nil
+
+	case lhs.kind == enumKind && (rhs.kind == intKind || rhs.kind == enumKind && rhs.enum.FullName() == lhs.enum.FullName()),
+		rhs.kind == enumKind && lhs.kind == intKind:
+		if ordered {
+			break
+		}
+		return func(a, b interface{}) int {
+			return compareInt(a.(int64), b.(int64))
+		}, nil
+
+	case lhs.kind == stringKind && rhs.kind == stringKind:
+		return func(a, b interface{}) int {
+			return strings.Compare(a.(string), b.(string))
+		}, nil
+
+	case lhs.kind == boolKind && rhs.kind == boolKind:
+		if ordered {
+			break
+		}
+		return func(a, b interface{}) int {
+			if a.(bool) == b.(bool) {
+				return 0
+			}
+			return 1
+		}, nil
+	}
+
+	return nil, newError(op.pos, fmt.Sprintf("cannot compare %v and %v with %q", lhs, rhs, op.text))
+}
+
+func toFloat(value interface{}) float64 {
+	if i, ok := value.(int64); ok {
+		return float64(i)
+	}
+	return value.(float64)
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,146 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+// operators are matched longest first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "-", "(", ")", "[", "]", ",", "."}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for pos < len(source) {
+		c := rune(source[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+
+		case c == '_' || unicode.IsLetter(c):
+			start := pos
+			for pos < len(source) && (source[pos] == '_' || isAlnum(rune(source[pos]))) {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:pos], pos: start})
+
+		case unicode.IsDigit(c):
+			tok, err := scanNumber(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			pos += len(tok.text)
+
+		case c == '"' || c == '\'':
+			tok, err := scanString(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			pos += len(tok.text)
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[pos:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: pos})
+					pos += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, newError(pos, fmt.Sprintf("unexpected character %q", c))
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+func isAlnum(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func scanNumber(source string, start int) (token, error) {
+	pos := start
+	isFloat := false
+	for pos < len(source) {
+		c := source[pos]
+		if c >= '0' && c <= '9' {
+			pos++
+		} else if c == '.' && !isFloat && pos+1 < len(source) && source[pos+1] >= '0' && source[pos+1] <= '9' {
+			isFloat = true
+			pos++
+		} else if (c == 'e' || c == 'E') && pos+1 < len(source) {
+			isFloat = true
+			pos++
+			if source[pos] == '+' || source[pos] == '-' {
+				pos++
+			}
+		} else {
+			break
+		}
+	}
+
+	text := source[start:pos]
+	if isFloat {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, newError(start, fmt.Sprintf("invalid number %q", text))
+		}
+		return token{kind: tokenFloat, text: text, value: value, pos: start}, nil
+	}
+
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return token{}, newError(start, fmt.Sprintf("invalid number %q", text))
+	}
+	return token{kind: tokenInt, text: text, value: value, pos: start}, nil
+}
+
+func scanString(source string, start int) (token, error) {
+	quote := source[start]
+	pos := start + 1
+	for pos < len(source) && source[pos] != quote {
+		if source[pos] == '\\' {
+			pos++
+		}
+		pos++
+	}
+	if pos >= len(source) {
+		return token{}, newError(start, "unterminated string")
+	}
+
+	text := source[start : pos+1]
+	body := text[1 : len(text)-1]
+	if quote == '\'' {
+		body = strings.ReplaceAll(body, `\'`, `'`)
+		body = strings.ReplaceAll(body, `"`, `\"`)
+	}
+	value, err := strconv.Unquote(`"` + body + `"`)
+	if err != nil {
+		return token{}, newError(start, fmt.Sprintf("invalid string %s", text))
+	}
+	return token{kind: tokenString, text: text, value: value, pos: start}, nil
+}
@@ -0,0 +1,427 @@
+package expr
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// node is a type-checked expression compiled into a closure
+type node struct {
+	typ      *exprType
+	pos      int
+	eval     func(env *env) interface{}
+	constant bool
+	// elems are the elements of a list literal
+	elems []*node
+}
+
+type env struct {
+	root protoreflect.Message
+	vars []interface{}
+}
+
+type variable struct {
+	name  string
+	typ   *exprType
+	index int
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	root    protoreflect.MessageDescriptor
+	scope   []variable
+	maxVars int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isOperator(op string) bool {
+	tok := p.peek()
+	return tok.kind == tokenOperator && tok.text == op
+}
+
+func (p *parser) expect(op string) error {
+	tok := p.next()
+	if tok.kind != tokenOperator || tok.text != op {
+		return unexpected(tok, fmt.Sprintf("expected %q", op))
+	}
+	return nil
+}
+
+func unexpected(tok token, msg string) error {
+	if tok.kind == tokenEOF {
+		return newError(tok.pos, msg+", got end of expression")
+	}
+	return newError(tok.pos, fmt.Sprintf("%s, got %q", msg, tok.text))
+}
+
+func (p *parser) parseOr() (*node, error) {
+	lhs, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("||") {
+		tok := p.next()
+		rhs, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireBool(tok, lhs, rhs); err != nil {
+			return nil, err
+		}
+
+		left, right := lhs.eval, rhs.eval
+		lhs = &node{typ: boolType, pos: lhs.pos, eval: func(env *env) interface{} {
+			return left(env).(bool) || right(env).(bool)
+		}}
+	}
+	return lhs, nil
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	lhs, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("&&") {
+		tok := p.next()
+		rhs, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireBool(tok, lhs, rhs); err != nil {
+			return nil, err
+		}
+
+		left, right := lhs.eval, rhs.eval
+		lhs = &node{typ: boolType, pos: lhs.pos, eval: func(env *env) interface{} {
+			return left(env).(bool) && right(env).(bool)
+		}}
+	}
+	return lhs, nil
+}
+
+func requireBool(tok token, operands ...*node) error {
+	for _, operand := range operands {
+		if operand.typ.kind != boolKind {
+			return newError(operand.pos, fmt.Sprintf("operand of %q must be bool, got %v", tok.text, operand.typ))
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseComparison() (*node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind == tokenIdent && tok.text == "in" {
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return compileIn(tok, lhs, rhs)
+	}
+
+	if tok.kind != tokenOperator {
+		return lhs, nil
+	}
+	switch tok.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return compileComparison(tok, lhs, rhs)
+	default:
+		return lhs, nil
+	}
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	if p.isOperator("!") {
+		tok := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireBool(tok, operand); err != nil {
+			return nil, err
+		}
+
+		eval := operand.eval
+		return &node{typ: boolType, pos: tok.pos, eval: func(env *env) interface{} {
+			return !eval(env).(bool)
+		}}, nil
+	}
+
+	if p.isOperator("-") {
+		tok := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if !operand.typ.isNumeric() {
+			return nil, newError(operand.pos, fmt.Sprintf("operand of \"-\" must be a number, got %v", operand.typ))
+		}
+
+		eval := operand.eval
+		return &node{typ: operand.typ, pos: tok.pos, constant: operand.constant, eval: func(env *env) interface{} {
+			switch v := eval(env).(type) {
+			case int64:
+				return -v
+			default:
+				return -v.(float64)
+			}
+		}}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (*node, error) {
+	operand, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator(".") {
+		p.next()
+		tok := p.next()
+		if tok.kind != tokenIdent {
+			return nil, unexpected(tok, "expected field name")
+		}
+
+		if p.isOperator("(") {
+			operand, err = p.parseMacro(operand, tok)
+		} else {
+			operand, err = selectField(operand, tok)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return operand, nil
+}
+
+func (p *parser) parsePrimary() (*node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenInt:
+		return constantNode(intType, tok.pos, tok.value), nil
+	case tokenFloat:
+		return constantNode(doubleType, tok.pos, tok.value), nil
+	case tokenString:
+		return constantNode(stringType, tok.pos, tok.value), nil
+	case tokenIdent:
+		return p.parseIdent(tok)
+	case tokenOperator:
+		switch tok.text {
+		case "(":
+			operand, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return operand, p.expect(")")
+		case "[":
+			return p.parseList(tok)
+		}
+	}
+	return nil, unexpected(tok, "expected an operand")
+}
+
+func constantNode(typ *exprType, pos int, value interface{}) *node {
+	return &node{typ: typ, pos: pos, constant: true, eval: func(env *env) interface{} {
+		return value
+	}}
+}
+
+func (p *parser) parseIdent(tok token) (*node, error) {
+	switch tok.text {
+	case "true":
+		return constantNode(boolType, tok.pos, true), nil
+	case "false":
+		return constantNode(boolType, tok.pos, false), nil
+	case "size":
+		if p.isOperator("(") {
+			return p.parseSize(tok)
+		}
+	}
+
+	for i := len(p.scope) - 1; i >= 0; i-- {
+		v := p.scope[i]
+		if v.name == tok.text {
+			index := v.index
+			return &node{typ: v.typ, pos: tok.pos, eval: func(env *env) interface{} {
+				return env.vars[index]
+			}}, nil
+		}
+	}
+
+	field := p.root.Fields().ByName(protoreflect.Name(tok.text))
+	if field == nil {
+		return nil, newError(tok.pos, fmt.Sprintf("unknown field %q", tok.text))
+	}
+	typ, err := fieldType(field)
+	if err != nil {
+		return nil, newError(tok.pos, err.Error())
+	}
+	return &node{typ: typ, pos: tok.pos, eval: func(env *env) interface{} {
+		return fieldValue(field, env.root.Get(field))
+	}}, nil
+}
+
+func selectField(operand *node, tok token) (*node, error) {
+	if operand.typ.kind != messageKind {
+		return nil, newError(tok.pos, fmt.Sprintf("cannot select field %q from %v", tok.text, operand.typ))
+	}
+
+	field := operand.typ.message.Fields().ByName(protoreflect.Name(tok.text))
+	if field == nil {
+		return nil, newError(tok.pos, fmt.Sprintf("unknown field %q in %v", tok.text, operand.typ))
+	}
+	typ, err := fieldType(field)
+	if err != nil {
+		return nil, newError(tok.pos, err.Error())
+	}
+
+	eval := operand.eval
+	return &node{typ: typ, pos: operand.pos, eval: func(env *env) interface{} {
+		return fieldValue(field, eval(env).(protoreflect.Message).Get(field))
+	}}, nil
+}
+
+func (p *parser) parseSize(tok token) (*node, error) {
+	p.next()
+	operand, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	eval := operand.eval
+	switch operand.typ.kind {
+	case listKind:
+		return &node{typ: intType, pos: tok.pos, eval: func(env *env) interface{} {
+			return int64(len(eval(env).([]interface{})))
+		}}, nil
+	case stringKind:
+		return &node{typ: intType, pos: tok.pos, eval: func(env *env) interface{} {
+			return int64(len(eval(env).(string)))
+		}}, nil
+	default:
+		return nil, newError(operand.pos, fmt.Sprintf("size of %v is not supported", operand.typ))
+	}
+}
+
+// parseMacro parses target.exists(x, predicate) and target.all(x, predicate)
+func (p *parser) parseMacro(target *node, name token) (*node, error) {
+	if name.text != "exists" && name.text != "all" {
+		return nil, newError(name.pos, fmt.Sprintf("unknown function %q", name.text))
+	}
+	if target.typ.kind != listKind {
+		return nil, newError(name.pos, fmt.Sprintf("%s is not supported on %v", name.text, target.typ))
+	}
+
+	p.next()
+	tok := p.next()
+	if tok.kind != tokenIdent {
+		return nil, unexpected(tok, "expected variable name")
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+
+	index := len(p.scope)
+	p.scope = append(p.scope, variable{name: tok.text, typ: target.typ.elem, index: index})
+	if len(p.scope) > p.maxVars {
+		p.maxVars = len(p.scope)
+	}
+	predicate, err := p.parseOr()
+	p.scope = p.scope[:index]
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if predicate.typ.kind != boolKind {
+		return nil, newError(predicate.pos, fmt.Sprintf("predicate of %s must be bool, got %v", name.text, predicate.typ))
+	}
+
+	list, check := target.eval, predicate.eval
+	exists := name.text == "exists"
+	return &node{typ: boolType, pos: target.pos, eval: func(env *env) interface{} {
+		for _, elem := range list(env).([]interface{}) {
+			env.vars[index] = elem
+			if check(env).(bool) == exists {
+				return exists
+			}
+		}
+		return !exists
+	}}, nil
+}
+
+func (p *parser) parseList(open token) (*node, error) {
+	var elems []*node
+	for !p.isOperator("]") {
+		if len(elems) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		elem, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+	p.next()
+
+	if len(elems) == 0 {
+		return nil, newError(open.pos, "empty list is not supported")
+	}
+
+	elemType := elems[0].typ
+	for _, elem := range elems[1:] {
+		if elem.typ.isNumeric() && elemType.isNumeric() {
+			if elem.typ.kind == doubleKind {
+				elemType = doubleType
+			}
+		} else if elem.typ.kind != elemType.kind {
+			return nil, newError(elem.pos, fmt.Sprintf("list elements must have the same type, got %v and %v", elemType, elem.typ))
+		}
+	}
+
+	return listNode(&exprType{kind: listKind, elem: elemType}, open.pos, elems), nil
+}
+
+func listNode(typ *exprType, pos int, elems []*node) *node {
+	return &node{typ: typ, pos: pos, elems: elems, eval: func(env *env) interface{} {
+		values := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			values[i] = elem.eval(env)
+		}
+		return values
+	}}
+}
@@ -0,0 +1,76 @@
+// Package expr implements a small filter expression language over protobuf messages,
+// for example: cpu.number_cores >= 8 && (brand == "Dell" || gpus.exists(g, g.memory.value >= 6))
+package expr
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Error is a syntax or type error at a position of the expression
+type Error struct {
+	// Column is the 1-based position of the error in the expression
+	Column int
+	Msg    string
+}
+
+func newError(pos int, msg string) *Error {
+	return &Error{Column: pos + 1, Msg: msg}
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", err.Column, err.Msg)
+}
+
+// Program is a type-checked expression that can be evaluated against messages of one type
+type Program struct {
+	source string
+	desc   protoreflect.MessageDescriptor
+	eval   func(env *env) interface{}
+	vars   int
+}
+
+// Compile parses and type-checks the source against the message descriptor,
+// the expression must evaluate to a bool
+func Compile(source string, desc protoreflect.MessageDescriptor) (*Program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, root: desc}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, unexpected(tok, "expected end of expression")
+	}
+	if root.typ.kind != boolKind {
+		return nil, newError(root.pos, fmt.Sprintf("expression must be bool, got %v", root.typ))
+	}
+
+	return &Program{
+		source: source,
+		desc:   desc,
+		eval:   root.eval,
+		vars:   p.maxVars,
+	}, nil
+}
+
+// Match evaluates the program against the message, which must be of the compiled type
+func (program *Program) Match(message proto.Message) bool {
+	m := message.ProtoReflect()
+	if m.Descriptor().FullName() != program.desc.FullName() {
+		return false
+	}
+
+	env := &env{root: m, vars: make([]interface{}, program.vars)}
+	return program.eval(env).(bool)
+}
+
+func (program *Program) String() string {
+	return program.source
+}
@@ -0,0 +1,85 @@
+package expr_test
+
+import (
+	"pcbook/expr"
+	"pcbook/pb"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLaptop() *pb.Laptop {
+	return &pb.Laptop{
+		Brand: "Dell",
+		Name:  "XPS",
+		Cpu:   &pb.CPU{NumberCores: 8, MinGhz: 2.5},
+		Gpus: []*pb.GPU{
+			{Brand: "AMD", Memory: &pb.Memory{Value: 4, Unit: pb.Memory_GIGABYTE}},
+			{Brand: "NVIDIA", Memory: &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE}},
+		},
+		Screen:   &pb.Screen{Panel: pb.Screen_OLED},
+		Weight:   &pb.Laptop_WeightLb{WeightLb: 4},
+		PriceUsd: 1999.5,
+	}
+}
+
+func TestProgramMatch(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		source  string
+		matched bool
+	}{
+		{`cpu.number_cores >= 8 && (brand == "Dell" || gpus.exists(g, g.memory.value >= 6))`, true},
+		{`cpu.number_cores > 8`, false},
+		{`brand == 'HP' || gpus.exists(g, g.brand == "NVIDIA" && g.memory.value >= 6)`, true},
+		{`gpus.all(g, g.memory.value >= 6)`, false},
+		{`price_usd < 2000 && price_usd > 1999`, true},
+		{`cpu.min_ghz >= 2`, true},
+		{`!(brand in ["HP", "Apple"])`, true},
+		{`screen.panel == "OLED" && screen.panel in ["IPS", "OLED"]`, true},
+		{`size(gpus) == 2 && size(name) == 3`, true},
+		{`weight_lb == 4 && weight_kg == 0`, true},
+		{`ram.value == 0 && -price_usd < 0`, true},
+		{`keyboard.backlit`, false},
+	}
+
+	laptop := newTestLaptop()
+	for _, tc := range testCase {
+		program, err := expr.Compile(tc.source, laptop.ProtoReflect().Descriptor())
+		require.NoError(t, err, tc.source)
+		require.Equal(t, tc.matched, program.Match(laptop), tc.source)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		source string
+		column int
+	}{
+		{`cpu.number_cores >= `, 21},
+		{`cpu.unknown > 1`, 5},
+		{`brand == 1`, 7},
+		{`screen.panel != OLED`, 17},
+		{`brand`, 1},
+		{`price_usd > 1 && name`, 18},
+		{`screen.panel == "SOMETHING"`, 17},
+		{`gpus.exists(g, g.brand)`, 16},
+		{`gpus.count(g, true)`, 6},
+		{`brand == "Dell" )`, 17},
+		{`brand == "Dell`, 10},
+		{`brand # 1`, 7},
+	}
+
+	desc := (&pb.Laptop{}).ProtoReflect().Descriptor()
+	for _, tc := range testCase {
+		_, err := expr.Compile(tc.source, desc)
+		require.Error(t, err, tc.source)
+
+		exprErr, ok := err.(*expr.Error)
+		require.True(t, ok, tc.source)
+		require.Equal(t, tc.column, exprErr.Column, "%s: %v", tc.source, err)
+	}
+}
@@ -0,0 +1,126 @@
+package expr
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type kind int
+
+const (
+	boolKind kind = iota
+	intKind
+	doubleKind
+	stringKind
+	enumKind
+	messageKind
+	listKind
+)
+
+// exprType is the static type of an expression
+type exprType struct {
+	kind    kind
+	enum    protoreflect.EnumDescriptor
+	message protoreflect.MessageDescriptor
+	elem    *exprType
+}
+
+var (
+	boolType   = &exprType{kind: boolKind}
+	intType    = &exprType{kind: intKind}
+	doubleType = &exprType{kind: doubleKind}
+	stringType = &exprType{kind: stringKind}
+)
+
+func (t *exprType) String() string {
+	switch t.kind {
+	case boolKind:
+		return "bool"
+	case intKind:
+		return "int"
+	case doubleKind:
+		return "double"
+	case stringKind:
+		return "string"
+	case enumKind:
+		return string(t.enum.FullName())
+	case messageKind:
+		return string(t.message.FullName())
+	case listKind:
+		return fmt.Sprintf("list(%v)", t.elem)
+	default:
+		return "unknown"
+	}
+}
+
+func (t *exprType) isNumeric() bool {
+	return t.kind == intKind || t.kind == doubleKind
+}
+
+// fieldType returns the type of a field, or an error if it can not be used in expressions
+func fieldType(field protoreflect.FieldDescriptor) (*exprType, error) {
+	if field.IsMap() {
+		return nil, fmt.Errorf("map field %s is not supported", field.Name())
+	}
+
+	var t *exprType
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		t = boolType
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		t = intType
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		t = doubleType
+	case protoreflect.StringKind:
+		t = stringType
+	case protoreflect.EnumKind:
+		t = &exprType{kind: enumKind, enum: field.Enum()}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		t = &exprType{kind: messageKind, message: field.Message()}
+	default:
+		return nil, fmt.Errorf("field %s of kind %v is not supported", field.Name(), field.Kind())
+	}
+
+	if field.IsList() {
+		return &exprType{kind: listKind, elem: t}, nil
+	}
+	return t, nil
+}
+
+// fieldValue converts a field value to the value used by expressions
+func fieldValue(field protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+	if field.IsList() {
+		list := value.List()
+		values := make([]interface{}, list.Len())
+		for i := range values {
+			values[i] = scalarValue(field, list.Get(i))
+		}
+		return values
+	}
+	return scalarValue(field, value)
+}
+
+func scalarValue(field protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return value.Bool()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return value.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return int64(value.Uint())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return value.Float()
+	case protoreflect.StringKind:
+		return value.String()
+	case protoreflect.EnumKind:
+		return int64(value.Enum())
+	default:
+		return value.Message()
+	}
+}
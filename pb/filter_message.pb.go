@@ -20,15 +20,35 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Unset fields mean no constraint
 type Filter struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	MaxPriceUsd float64 `protobuf:"fixed64,1,opt,name=max_price_usd,json=maxPriceUsd,proto3" json:"max_price_usd,omitempty"`
-	MinCpuCores uint32  `protobuf:"varint,2,opt,name=min_cpu_cores,json=minCpuCores,proto3" json:"min_cpu_cores,omitempty"`
-	MinCpuGhz   float64 `protobuf:"fixed64,3,opt,name=min_cpu_ghz,json=minCpuGhz,proto3" json:"min_cpu_ghz,omitempty"`
-	MinRam      *Memory `protobuf:"bytes,4,opt,name=min_ram,json=minRam,proto3" json:"min_ram,omitempty"`
+	MaxPriceUsd    float64  `protobuf:"fixed64,1,opt,name=max_price_usd,json=maxPriceUsd,proto3" json:"max_price_usd,omitempty"`
+	MinCpuCores    uint32   `protobuf:"varint,2,opt,name=min_cpu_cores,json=minCpuCores,proto3" json:"min_cpu_cores,omitempty"`
+	MinCpuGhz      float64  `protobuf:"fixed64,3,opt,name=min_cpu_ghz,json=minCpuGhz,proto3" json:"min_cpu_ghz,omitempty"`
+	MinRam         *Memory  `protobuf:"bytes,4,opt,name=min_ram,json=minRam,proto3" json:"min_ram,omitempty"`
+	Brands         []string `protobuf:"bytes,5,rep,name=brands,proto3" json:"brands,omitempty"`
+	MinReleaseYear uint32   `protobuf:"varint,6,opt,name=min_release_year,json=minReleaseYear,proto3" json:"min_release_year,omitempty"`
+	MaxReleaseYear uint32   `protobuf:"varint,7,opt,name=max_release_year,json=maxReleaseYear,proto3" json:"max_release_year,omitempty"`
+	MinPriceUsd    float64  `protobuf:"fixed64,8,opt,name=min_price_usd,json=minPriceUsd,proto3" json:"min_price_usd,omitempty"`
+	// a laptop matches if one of its GPUs matches both gpu_brands and min_gpu_memory
+	GpuBrands    []string `protobuf:"bytes,9,rep,name=gpu_brands,json=gpuBrands,proto3" json:"gpu_brands,omitempty"`
+	MinGpuMemory *Memory  `protobuf:"bytes,10,opt,name=min_gpu_memory,json=minGpuMemory,proto3" json:"min_gpu_memory,omitempty"`
+	// total capacity of the SSD and HDD storages
+	MinSsdCapacity      *Memory            `protobuf:"bytes,11,opt,name=min_ssd_capacity,json=minSsdCapacity,proto3" json:"min_ssd_capacity,omitempty"`
+	MinHddCapacity      *Memory            `protobuf:"bytes,12,opt,name=min_hdd_capacity,json=minHddCapacity,proto3" json:"min_hdd_capacity,omitempty"`
+	MinScreenSizeInch   float32            `protobuf:"fixed32,13,opt,name=min_screen_size_inch,json=minScreenSizeInch,proto3" json:"min_screen_size_inch,omitempty"`
+	MaxScreenSizeInch   float32            `protobuf:"fixed32,14,opt,name=max_screen_size_inch,json=maxScreenSizeInch,proto3" json:"max_screen_size_inch,omitempty"`
+	MinScreenResolution *Screen_Resolution `protobuf:"bytes,15,opt,name=min_screen_resolution,json=minScreenResolution,proto3" json:"min_screen_resolution,omitempty"`
+	ScreenPanels        []Screen_Panel     `protobuf:"varint,16,rep,packed,name=screen_panels,json=screenPanels,proto3,enum=my.pcbook.Screen_Panel" json:"screen_panels,omitempty"`
+	Multitouch          *bool              `protobuf:"varint,17,opt,name=multitouch,proto3,oneof" json:"multitouch,omitempty"`
+	KeyboardLayouts     []Keyboard_Layout  `protobuf:"varint,18,rep,packed,name=keyboard_layouts,json=keyboardLayouts,proto3,enum=my.pcbook.Keyboard_Layout" json:"keyboard_layouts,omitempty"`
+	KeyboardBacklit     *bool              `protobuf:"varint,19,opt,name=keyboard_backlit,json=keyboardBacklit,proto3,oneof" json:"keyboard_backlit,omitempty"`
+	// compared with weight_kg, or weight_lb converted to kilograms
+	MaxWeightKg float64 `protobuf:"fixed64,20,opt,name=max_weight_kg,json=maxWeightKg,proto3" json:"max_weight_kg,omitempty"`
 }
 
 func (x *Filter) Reset() {
@@ -91,24 +111,190 @@ func (x *Filter) GetMinRam() *Memory {
 	return nil
 }
 
+func (x *Filter) GetBrands() []string {
+	if x != nil {
+		return x.Brands
+	}
+	return nil
+}
+
+func (x *Filter) GetMinReleaseYear() uint32 {
+	if x != nil {
+		return x.MinReleaseYear
+	}
+	return 0
+}
+
+func (x *Filter) GetMaxReleaseYear() uint32 {
+	if x != nil {
+		return x.MaxReleaseYear
+	}
+	return 0
+}
+
+func (x *Filter) GetMinPriceUsd() float64 {
+	if x != nil {
+		return x.MinPriceUsd
+	}
+	return 0
+}
+
+func (x *Filter) GetGpuBrands() []string {
+	if x != nil {
+		return x.GpuBrands
+	}
+	return nil
+}
+
+func (x *Filter) GetMinGpuMemory() *Memory {
+	if x != nil {
+		return x.MinGpuMemory
+	}
+	return nil
+}
+
+func (x *Filter) GetMinSsdCapacity() *Memory {
+	if x != nil {
+		return x.MinSsdCapacity
+	}
+	return nil
+}
+
+func (x *Filter) GetMinHddCapacity() *Memory {
+	if x != nil {
+		return x.MinHddCapacity
+	}
+	return nil
+}
+
+func (x *Filter) GetMinScreenSizeInch() float32 {
+	if x != nil {
+		return x.MinScreenSizeInch
+	}
+	return 0
+}
+
+func (x *Filter) GetMaxScreenSizeInch() float32 {
+	if x != nil {
+		return x.MaxScreenSizeInch
+	}
+	return 0
+}
+
+func (x *Filter) GetMinScreenResolution() *Screen_Resolution {
+	if x != nil {
+		return x.MinScreenResolution
+	}
+	return nil
+}
+
+func (x *Filter) GetScreenPanels() []Screen_Panel {
+	if x != nil {
+		return x.ScreenPanels
+	}
+	return nil
+}
+
+func (x *Filter) GetMultitouch() bool {
+	if x != nil && x.Multitouch != nil {
+		return *x.Multitouch
+	}
+	return false
+}
+
+func (x *Filter) GetKeyboardLayouts() []Keyboard_Layout {
+	if x != nil {
+		return x.KeyboardLayouts
+	}
+	return nil
+}
+
+func (x *Filter) GetKeyboardBacklit() bool {
+	if x != nil && x.KeyboardBacklit != nil {
+		return *x.KeyboardBacklit
+	}
+	return false
+}
+
+func (x *Filter) GetMaxWeightKg() float64 {
+	if x != nil {
+		return x.MaxWeightKg
+	}
+	return 0
+}
+
 var File_filter_message_proto protoreflect.FileDescriptor
 
 var file_filter_message_proto_rawDesc = []byte{
 	0x0a, 0x14, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
 	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f,
 	0x6b, 0x1a, 0x14, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
-	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x9c, 0x01, 0x0a, 0x06, 0x46, 0x69, 0x6c, 0x74,
-	0x65, 0x72, 0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x61, 0x78, 0x5f, 0x70, 0x72, 0x69, 0x63, 0x65, 0x5f,
-	0x75, 0x73, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x6d, 0x61, 0x78, 0x50, 0x72,
-	0x69, 0x63, 0x65, 0x55, 0x73, 0x64, 0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x69, 0x6e, 0x5f, 0x63, 0x70,
-	0x75, 0x5f, 0x63, 0x6f, 0x72, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x6d,
-	0x69, 0x6e, 0x43, 0x70, 0x75, 0x43, 0x6f, 0x72, 0x65, 0x73, 0x12, 0x1e, 0x0a, 0x0b, 0x6d, 0x69,
-	0x6e, 0x5f, 0x63, 0x70, 0x75, 0x5f, 0x67, 0x68, 0x7a, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52,
-	0x09, 0x6d, 0x69, 0x6e, 0x43, 0x70, 0x75, 0x47, 0x68, 0x7a, 0x12, 0x2a, 0x0a, 0x07, 0x6d, 0x69,
-	0x6e, 0x5f, 0x72, 0x61, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79,
-	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x52, 0x06,
-	0x6d, 0x69, 0x6e, 0x52, 0x61, 0x6d, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x14, 0x73, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x5f,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x16, 0x6b,
+	0x65, 0x79, 0x62, 0x6f, 0x61, 0x72, 0x64, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xd4, 0x07, 0x0a, 0x06, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72,
+	0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x61, 0x78, 0x5f, 0x70, 0x72, 0x69, 0x63, 0x65, 0x5f, 0x75, 0x73,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x6d, 0x61, 0x78, 0x50, 0x72, 0x69, 0x63,
+	0x65, 0x55, 0x73, 0x64, 0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x69, 0x6e, 0x5f, 0x63, 0x70, 0x75, 0x5f,
+	0x63, 0x6f, 0x72, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x6d, 0x69, 0x6e,
+	0x43, 0x70, 0x75, 0x43, 0x6f, 0x72, 0x65, 0x73, 0x12, 0x1e, 0x0a, 0x0b, 0x6d, 0x69, 0x6e, 0x5f,
+	0x63, 0x70, 0x75, 0x5f, 0x67, 0x68, 0x7a, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x6d,
+	0x69, 0x6e, 0x43, 0x70, 0x75, 0x47, 0x68, 0x7a, 0x12, 0x2a, 0x0a, 0x07, 0x6d, 0x69, 0x6e, 0x5f,
+	0x72, 0x61, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79, 0x2e, 0x70,
+	0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x52, 0x06, 0x6d, 0x69,
+	0x6e, 0x52, 0x61, 0x6d, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x72, 0x61, 0x6e, 0x64, 0x73, 0x18, 0x05,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x62, 0x72, 0x61, 0x6e, 0x64, 0x73, 0x12, 0x28, 0x0a, 0x10,
+	0x6d, 0x69, 0x6e, 0x5f, 0x72, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x5f, 0x79, 0x65, 0x61, 0x72,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x6d, 0x69, 0x6e, 0x52, 0x65, 0x6c, 0x65, 0x61,
+	0x73, 0x65, 0x59, 0x65, 0x61, 0x72, 0x12, 0x28, 0x0a, 0x10, 0x6d, 0x61, 0x78, 0x5f, 0x72, 0x65,
+	0x6c, 0x65, 0x61, 0x73, 0x65, 0x5f, 0x79, 0x65, 0x61, 0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0e, 0x6d, 0x61, 0x78, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x59, 0x65, 0x61, 0x72,
+	0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x69, 0x6e, 0x5f, 0x70, 0x72, 0x69, 0x63, 0x65, 0x5f, 0x75, 0x73,
+	0x64, 0x18, 0x08, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x6d, 0x69, 0x6e, 0x50, 0x72, 0x69, 0x63,
+	0x65, 0x55, 0x73, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x67, 0x70, 0x75, 0x5f, 0x62, 0x72, 0x61, 0x6e,
+	0x64, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x67, 0x70, 0x75, 0x42, 0x72, 0x61,
+	0x6e, 0x64, 0x73, 0x12, 0x37, 0x0a, 0x0e, 0x6d, 0x69, 0x6e, 0x5f, 0x67, 0x70, 0x75, 0x5f, 0x6d,
+	0x65, 0x6d, 0x6f, 0x72, 0x79, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x52, 0x0c,
+	0x6d, 0x69, 0x6e, 0x47, 0x70, 0x75, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x12, 0x3b, 0x0a, 0x10,
+	0x6d, 0x69, 0x6e, 0x5f, 0x73, 0x73, 0x64, 0x5f, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79,
+	0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62, 0x6f,
+	0x6f, 0x6b, 0x2e, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x52, 0x0e, 0x6d, 0x69, 0x6e, 0x53, 0x73,
+	0x64, 0x43, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x12, 0x3b, 0x0a, 0x10, 0x6d, 0x69, 0x6e,
+	0x5f, 0x68, 0x64, 0x64, 0x5f, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x18, 0x0c, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e,
+	0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x52, 0x0e, 0x6d, 0x69, 0x6e, 0x48, 0x64, 0x64, 0x43, 0x61,
+	0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x12, 0x2f, 0x0a, 0x14, 0x6d, 0x69, 0x6e, 0x5f, 0x73, 0x63,
+	0x72, 0x65, 0x65, 0x6e, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x5f, 0x69, 0x6e, 0x63, 0x68, 0x18, 0x0d,
+	0x20, 0x01, 0x28, 0x02, 0x52, 0x11, 0x6d, 0x69, 0x6e, 0x53, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x53,
+	0x69, 0x7a, 0x65, 0x49, 0x6e, 0x63, 0x68, 0x12, 0x2f, 0x0a, 0x14, 0x6d, 0x61, 0x78, 0x5f, 0x73,
+	0x63, 0x72, 0x65, 0x65, 0x6e, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x5f, 0x69, 0x6e, 0x63, 0x68, 0x18,
+	0x0e, 0x20, 0x01, 0x28, 0x02, 0x52, 0x11, 0x6d, 0x61, 0x78, 0x53, 0x63, 0x72, 0x65, 0x65, 0x6e,
+	0x53, 0x69, 0x7a, 0x65, 0x49, 0x6e, 0x63, 0x68, 0x12, 0x50, 0x0a, 0x15, 0x6d, 0x69, 0x6e, 0x5f,
+	0x73, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x5f, 0x72, 0x65, 0x73, 0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62,
+	0x6f, 0x6f, 0x6b, 0x2e, 0x53, 0x63, 0x72, 0x65, 0x65, 0x6e, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x6c,
+	0x75, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x13, 0x6d, 0x69, 0x6e, 0x53, 0x63, 0x72, 0x65, 0x65, 0x6e,
+	0x52, 0x65, 0x73, 0x6f, 0x6c, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x3c, 0x0a, 0x0d, 0x73, 0x63,
+	0x72, 0x65, 0x65, 0x6e, 0x5f, 0x70, 0x61, 0x6e, 0x65, 0x6c, 0x73, 0x18, 0x10, 0x20, 0x03, 0x28,
+	0x0e, 0x32, 0x17, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x53, 0x63,
+	0x72, 0x65, 0x65, 0x6e, 0x2e, 0x50, 0x61, 0x6e, 0x65, 0x6c, 0x52, 0x0c, 0x73, 0x63, 0x72, 0x65,
+	0x65, 0x6e, 0x50, 0x61, 0x6e, 0x65, 0x6c, 0x73, 0x12, 0x23, 0x0a, 0x0a, 0x6d, 0x75, 0x6c, 0x74,
+	0x69, 0x74, 0x6f, 0x75, 0x63, 0x68, 0x18, 0x11, 0x20, 0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x0a,
+	0x6d, 0x75, 0x6c, 0x74, 0x69, 0x74, 0x6f, 0x75, 0x63, 0x68, 0x88, 0x01, 0x01, 0x12, 0x45, 0x0a,
+	0x10, 0x6b, 0x65, 0x79, 0x62, 0x6f, 0x61, 0x72, 0x64, 0x5f, 0x6c, 0x61, 0x79, 0x6f, 0x75, 0x74,
+	0x73, 0x18, 0x12, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x1a, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62,
+	0x6f, 0x6f, 0x6b, 0x2e, 0x4b, 0x65, 0x79, 0x62, 0x6f, 0x61, 0x72, 0x64, 0x2e, 0x4c, 0x61, 0x79,
+	0x6f, 0x75, 0x74, 0x52, 0x0f, 0x6b, 0x65, 0x79, 0x62, 0x6f, 0x61, 0x72, 0x64, 0x4c, 0x61, 0x79,
+	0x6f, 0x75, 0x74, 0x73, 0x12, 0x2e, 0x0a, 0x10, 0x6b, 0x65, 0x79, 0x62, 0x6f, 0x61, 0x72, 0x64,
+	0x5f, 0x62, 0x61, 0x63, 0x6b, 0x6c, 0x69, 0x74, 0x18, 0x13, 0x20, 0x01, 0x28, 0x08, 0x48, 0x01,
+	0x52, 0x0f, 0x6b, 0x65, 0x79, 0x62, 0x6f, 0x61, 0x72, 0x64, 0x42, 0x61, 0x63, 0x6b, 0x6c, 0x69,
+	0x74, 0x88, 0x01, 0x01, 0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x61, 0x78, 0x5f, 0x77, 0x65, 0x69, 0x67,
+	0x68, 0x74, 0x5f, 0x6b, 0x67, 0x18, 0x14, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x6d, 0x61, 0x78,
+	0x57, 0x65, 0x69, 0x67, 0x68, 0x74, 0x4b, 0x67, 0x42, 0x0d, 0x0a, 0x0b, 0x5f, 0x6d, 0x75, 0x6c,
+	0x74, 0x69, 0x74, 0x6f, 0x75, 0x63, 0x68, 0x42, 0x13, 0x0a, 0x11, 0x5f, 0x6b, 0x65, 0x79, 0x62,
+	0x6f, 0x61, 0x72, 0x64, 0x5f, 0x62, 0x61, 0x63, 0x6b, 0x6c, 0x69, 0x74, 0x42, 0x06, 0x5a, 0x04,
+	0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -125,16 +311,25 @@ func file_filter_message_proto_rawDescGZIP() []byte {
 
 var file_filter_message_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
 var file_filter_message_proto_goTypes = []interface{}{
-	(*Filter)(nil), // 0: my.pcbook.Filter
-	(*Memory)(nil), // 1: my.pcbook.Memory
+	(*Filter)(nil),            // 0: my.pcbook.Filter
+	(*Memory)(nil),            // 1: my.pcbook.Memory
+	(*Screen_Resolution)(nil), // 2: my.pcbook.Screen.Resolution
+	(Screen_Panel)(0),         // 3: my.pcbook.Screen.Panel
+	(Keyboard_Layout)(0),      // 4: my.pcbook.Keyboard.Layout
 }
 var file_filter_message_proto_depIdxs = []int32{
 	1, // 0: my.pcbook.Filter.min_ram:type_name -> my.pcbook.Memory
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	1, // 1: my.pcbook.Filter.min_gpu_memory:type_name -> my.pcbook.Memory
+	1, // 2: my.pcbook.Filter.min_ssd_capacity:type_name -> my.pcbook.Memory
+	1, // 3: my.pcbook.Filter.min_hdd_capacity:type_name -> my.pcbook.Memory
+	2, // 4: my.pcbook.Filter.min_screen_resolution:type_name -> my.pcbook.Screen.Resolution
+	3, // 5: my.pcbook.Filter.screen_panels:type_name -> my.pcbook.Screen.Panel
+	4, // 6: my.pcbook.Filter.keyboard_layouts:type_name -> my.pcbook.Keyboard.Layout
+	7, // [7:7] is the sub-list for method output_type
+	7, // [7:7] is the sub-list for method input_type
+	7, // [7:7] is the sub-list for extension type_name
+	7, // [7:7] is the sub-list for extension extendee
+	0, // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_filter_message_proto_init() }
@@ -143,6 +338,8 @@ func file_filter_message_proto_init() {
 		return
 	}
 	file_memory_message_proto_init()
+	file_screen_message_proto_init()
+	file_keyboard_message_proto_init()
 	if !protoimpl.UnsafeEnabled {
 		file_filter_message_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Filter); i {
@@ -157,6 +354,7 @@ func file_filter_message_proto_init() {
 			}
 		}
 	}
+	file_filter_message_proto_msgTypes[0].OneofWrappers = []interface{}{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
@@ -23,9 +23,30 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type LaptopServiceClient interface {
 	CreateLaptop(ctx context.Context, in *CreateLaptopRequest, opts ...grpc.CallOption) (*CreateLaptopResponse, error)
+	BulkCreateLaptops(ctx context.Context, opts ...grpc.CallOption) (LaptopService_BulkCreateLaptopsClient, error)
+	GetLaptop(ctx context.Context, in *GetLaptopRequest, opts ...grpc.CallOption) (*GetLaptopResponse, error)
+	ListLaptops(ctx context.Context, in *ListLaptopsRequest, opts ...grpc.CallOption) (*ListLaptopsResponse, error)
+	UpdateLaptop(ctx context.Context, in *UpdateLaptopRequest, opts ...grpc.CallOption) (*UpdateLaptopResponse, error)
+	DeleteLaptop(ctx context.Context, in *DeleteLaptopRequest, opts ...grpc.CallOption) (*DeleteLaptopResponse, error)
+	PurgeDeleted(ctx context.Context, in *PurgeDeletedRequest, opts ...grpc.CallOption) (*PurgeDeletedResponse, error)
 	SearchLaptop(ctx context.Context, in *SearchLaptopRequest, opts ...grpc.CallOption) (LaptopService_SearchLaptopClient, error)
+	TextSearchLaptop(ctx context.Context, in *TextSearchLaptopRequest, opts ...grpc.CallOption) (LaptopService_TextSearchLaptopClient, error)
+	Suggest(ctx context.Context, in *SuggestRequest, opts ...grpc.CallOption) (*SuggestResponse, error)
+	AggregateLaptops(ctx context.Context, in *AggregateLaptopsRequest, opts ...grpc.CallOption) (*AggregateLaptopsResponse, error)
+	WatchLaptops(ctx context.Context, in *WatchLaptopsRequest, opts ...grpc.CallOption) (LaptopService_WatchLaptopsClient, error)
 	UploadImage(ctx context.Context, opts ...grpc.CallOption) (LaptopService_UploadImageClient, error)
+	StartUpload(ctx context.Context, in *StartUploadRequest, opts ...grpc.CallOption) (*StartUploadResponse, error)
+	UploadChunks(ctx context.Context, opts ...grpc.CallOption) (LaptopService_UploadChunksClient, error)
+	QueryUpload(ctx context.Context, in *QueryUploadRequest, opts ...grpc.CallOption) (*QueryUploadResponse, error)
+	FinishUpload(ctx context.Context, in *FinishUploadRequest, opts ...grpc.CallOption) (*FinishUploadResponse, error)
+	ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error)
+	DownloadImage(ctx context.Context, in *DownloadImageRequest, opts ...grpc.CallOption) (LaptopService_DownloadImageClient, error)
+	DeleteImage(ctx context.Context, in *DeleteImageRequest, opts ...grpc.CallOption) (*DeleteImageResponse, error)
+	SetPrimaryImage(ctx context.Context, in *SetPrimaryImageRequest, opts ...grpc.CallOption) (*SetPrimaryImageResponse, error)
 	RateLaptop(ctx context.Context, opts ...grpc.CallOption) (LaptopService_RateLaptopClient, error)
+	DeleteRating(ctx context.Context, in *DeleteRatingRequest, opts ...grpc.CallOption) (*DeleteRatingResponse, error)
+	GetMyRatings(ctx context.Context, in *GetMyRatingsRequest, opts ...grpc.CallOption) (*GetMyRatingsResponse, error)
+	GetRatingSummary(ctx context.Context, in *GetRatingSummaryRequest, opts ...grpc.CallOption) (*GetRatingSummaryResponse, error)
 }
 
 type laptopServiceClient struct {
@@ -45,8 +66,87 @@ func (c *laptopServiceClient) CreateLaptop(ctx context.Context, in *CreateLaptop
 	return out, nil
 }
 
+func (c *laptopServiceClient) BulkCreateLaptops(ctx context.Context, opts ...grpc.CallOption) (LaptopService_BulkCreateLaptopsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[0], "/my.pcbook.LaptopService/BulkCreateLaptops", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceBulkCreateLaptopsClient{stream}
+	return x, nil
+}
+
+type LaptopService_BulkCreateLaptopsClient interface {
+	Send(*BulkCreateLaptopsRequest) error
+	CloseAndRecv() (*BulkCreateLaptopsResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceBulkCreateLaptopsClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceBulkCreateLaptopsClient) Send(m *BulkCreateLaptopsRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *laptopServiceBulkCreateLaptopsClient) CloseAndRecv() (*BulkCreateLaptopsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(BulkCreateLaptopsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *laptopServiceClient) GetLaptop(ctx context.Context, in *GetLaptopRequest, opts ...grpc.CallOption) (*GetLaptopResponse, error) {
+	out := new(GetLaptopResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/GetLaptop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) ListLaptops(ctx context.Context, in *ListLaptopsRequest, opts ...grpc.CallOption) (*ListLaptopsResponse, error) {
+	out := new(ListLaptopsResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/ListLaptops", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) UpdateLaptop(ctx context.Context, in *UpdateLaptopRequest, opts ...grpc.CallOption) (*UpdateLaptopResponse, error) {
+	out := new(UpdateLaptopResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/UpdateLaptop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) DeleteLaptop(ctx context.Context, in *DeleteLaptopRequest, opts ...grpc.CallOption) (*DeleteLaptopResponse, error) {
+	out := new(DeleteLaptopResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/DeleteLaptop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) PurgeDeleted(ctx context.Context, in *PurgeDeletedRequest, opts ...grpc.CallOption) (*PurgeDeletedResponse, error) {
+	out := new(PurgeDeletedResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/PurgeDeleted", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *laptopServiceClient) SearchLaptop(ctx context.Context, in *SearchLaptopRequest, opts ...grpc.CallOption) (LaptopService_SearchLaptopClient, error) {
-	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[0], "/my.pcbook.LaptopService/SearchLaptop", opts...)
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[1], "/my.pcbook.LaptopService/SearchLaptop", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -77,8 +177,90 @@ func (x *laptopServiceSearchLaptopClient) Recv() (*SearchLaptopResponse, error)
 	return m, nil
 }
 
+func (c *laptopServiceClient) TextSearchLaptop(ctx context.Context, in *TextSearchLaptopRequest, opts ...grpc.CallOption) (LaptopService_TextSearchLaptopClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[2], "/my.pcbook.LaptopService/TextSearchLaptop", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceTextSearchLaptopClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LaptopService_TextSearchLaptopClient interface {
+	Recv() (*TextSearchLaptopResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceTextSearchLaptopClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceTextSearchLaptopClient) Recv() (*TextSearchLaptopResponse, error) {
+	m := new(TextSearchLaptopResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *laptopServiceClient) Suggest(ctx context.Context, in *SuggestRequest, opts ...grpc.CallOption) (*SuggestResponse, error) {
+	out := new(SuggestResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/Suggest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) AggregateLaptops(ctx context.Context, in *AggregateLaptopsRequest, opts ...grpc.CallOption) (*AggregateLaptopsResponse, error) {
+	out := new(AggregateLaptopsResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/AggregateLaptops", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) WatchLaptops(ctx context.Context, in *WatchLaptopsRequest, opts ...grpc.CallOption) (LaptopService_WatchLaptopsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[3], "/my.pcbook.LaptopService/WatchLaptops", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceWatchLaptopsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LaptopService_WatchLaptopsClient interface {
+	Recv() (*WatchLaptopsResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceWatchLaptopsClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceWatchLaptopsClient) Recv() (*WatchLaptopsResponse, error) {
+	m := new(WatchLaptopsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *laptopServiceClient) UploadImage(ctx context.Context, opts ...grpc.CallOption) (LaptopService_UploadImageClient, error) {
-	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[1], "/my.pcbook.LaptopService/UploadImage", opts...)
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[4], "/my.pcbook.LaptopService/UploadImage", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -111,8 +293,128 @@ func (x *laptopServiceUploadImageClient) CloseAndRecv() (*UploadImageResponse, e
 	return m, nil
 }
 
+func (c *laptopServiceClient) StartUpload(ctx context.Context, in *StartUploadRequest, opts ...grpc.CallOption) (*StartUploadResponse, error) {
+	out := new(StartUploadResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/StartUpload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) UploadChunks(ctx context.Context, opts ...grpc.CallOption) (LaptopService_UploadChunksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[5], "/my.pcbook.LaptopService/UploadChunks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceUploadChunksClient{stream}
+	return x, nil
+}
+
+type LaptopService_UploadChunksClient interface {
+	Send(*UploadChunkRequest) error
+	CloseAndRecv() (*UploadChunksResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceUploadChunksClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceUploadChunksClient) Send(m *UploadChunkRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *laptopServiceUploadChunksClient) CloseAndRecv() (*UploadChunksResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadChunksResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *laptopServiceClient) QueryUpload(ctx context.Context, in *QueryUploadRequest, opts ...grpc.CallOption) (*QueryUploadResponse, error) {
+	out := new(QueryUploadResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/QueryUpload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) FinishUpload(ctx context.Context, in *FinishUploadRequest, opts ...grpc.CallOption) (*FinishUploadResponse, error) {
+	out := new(FinishUploadResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/FinishUpload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error) {
+	out := new(ListImagesResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/ListImages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) DownloadImage(ctx context.Context, in *DownloadImageRequest, opts ...grpc.CallOption) (LaptopService_DownloadImageClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[6], "/my.pcbook.LaptopService/DownloadImage", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceDownloadImageClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LaptopService_DownloadImageClient interface {
+	Recv() (*DownloadImageResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceDownloadImageClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceDownloadImageClient) Recv() (*DownloadImageResponse, error) {
+	m := new(DownloadImageResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *laptopServiceClient) DeleteImage(ctx context.Context, in *DeleteImageRequest, opts ...grpc.CallOption) (*DeleteImageResponse, error) {
+	out := new(DeleteImageResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/DeleteImage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) SetPrimaryImage(ctx context.Context, in *SetPrimaryImageRequest, opts ...grpc.CallOption) (*SetPrimaryImageResponse, error) {
+	out := new(SetPrimaryImageResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/SetPrimaryImage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *laptopServiceClient) RateLaptop(ctx context.Context, opts ...grpc.CallOption) (LaptopService_RateLaptopClient, error) {
-	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[2], "/my.pcbook.LaptopService/RateLaptop", opts...)
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[7], "/my.pcbook.LaptopService/RateLaptop", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -142,14 +444,62 @@ func (x *laptopServiceRateLaptopClient) Recv() (*RateLaptopResponse, error) {
 	return m, nil
 }
 
+func (c *laptopServiceClient) DeleteRating(ctx context.Context, in *DeleteRatingRequest, opts ...grpc.CallOption) (*DeleteRatingResponse, error) {
+	out := new(DeleteRatingResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/DeleteRating", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) GetMyRatings(ctx context.Context, in *GetMyRatingsRequest, opts ...grpc.CallOption) (*GetMyRatingsResponse, error) {
+	out := new(GetMyRatingsResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/GetMyRatings", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) GetRatingSummary(ctx context.Context, in *GetRatingSummaryRequest, opts ...grpc.CallOption) (*GetRatingSummaryResponse, error) {
+	out := new(GetRatingSummaryResponse)
+	err := c.cc.Invoke(ctx, "/my.pcbook.LaptopService/GetRatingSummary", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // LaptopServiceServer is the server API for LaptopService service.
 // All implementations should embed UnimplementedLaptopServiceServer
 // for forward compatibility
 type LaptopServiceServer interface {
 	CreateLaptop(context.Context, *CreateLaptopRequest) (*CreateLaptopResponse, error)
+	BulkCreateLaptops(LaptopService_BulkCreateLaptopsServer) error
+	GetLaptop(context.Context, *GetLaptopRequest) (*GetLaptopResponse, error)
+	ListLaptops(context.Context, *ListLaptopsRequest) (*ListLaptopsResponse, error)
+	UpdateLaptop(context.Context, *UpdateLaptopRequest) (*UpdateLaptopResponse, error)
+	DeleteLaptop(context.Context, *DeleteLaptopRequest) (*DeleteLaptopResponse, error)
+	PurgeDeleted(context.Context, *PurgeDeletedRequest) (*PurgeDeletedResponse, error)
 	SearchLaptop(*SearchLaptopRequest, LaptopService_SearchLaptopServer) error
+	TextSearchLaptop(*TextSearchLaptopRequest, LaptopService_TextSearchLaptopServer) error
+	Suggest(context.Context, *SuggestRequest) (*SuggestResponse, error)
+	AggregateLaptops(context.Context, *AggregateLaptopsRequest) (*AggregateLaptopsResponse, error)
+	WatchLaptops(*WatchLaptopsRequest, LaptopService_WatchLaptopsServer) error
 	UploadImage(LaptopService_UploadImageServer) error
+	StartUpload(context.Context, *StartUploadRequest) (*StartUploadResponse, error)
+	UploadChunks(LaptopService_UploadChunksServer) error
+	QueryUpload(context.Context, *QueryUploadRequest) (*QueryUploadResponse, error)
+	FinishUpload(context.Context, *FinishUploadRequest) (*FinishUploadResponse, error)
+	ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error)
+	DownloadImage(*DownloadImageRequest, LaptopService_DownloadImageServer) error
+	DeleteImage(context.Context, *DeleteImageRequest) (*DeleteImageResponse, error)
+	SetPrimaryImage(context.Context, *SetPrimaryImageRequest) (*SetPrimaryImageResponse, error)
 	RateLaptop(LaptopService_RateLaptopServer) error
+	DeleteRating(context.Context, *DeleteRatingRequest) (*DeleteRatingResponse, error)
+	GetMyRatings(context.Context, *GetMyRatingsRequest) (*GetMyRatingsResponse, error)
+	GetRatingSummary(context.Context, *GetRatingSummaryRequest) (*GetRatingSummaryResponse, error)
 }
 
 // UnimplementedLaptopServiceServer should be embedded to have forward compatible implementations.
@@ -159,15 +509,78 @@ type UnimplementedLaptopServiceServer struct {
 func (UnimplementedLaptopServiceServer) CreateLaptop(context.Context, *CreateLaptopRequest) (*CreateLaptopResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateLaptop not implemented")
 }
+func (UnimplementedLaptopServiceServer) BulkCreateLaptops(LaptopService_BulkCreateLaptopsServer) error {
+	return status.Errorf(codes.Unimplemented, "method BulkCreateLaptops not implemented")
+}
+func (UnimplementedLaptopServiceServer) GetLaptop(context.Context, *GetLaptopRequest) (*GetLaptopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLaptop not implemented")
+}
+func (UnimplementedLaptopServiceServer) ListLaptops(context.Context, *ListLaptopsRequest) (*ListLaptopsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLaptops not implemented")
+}
+func (UnimplementedLaptopServiceServer) UpdateLaptop(context.Context, *UpdateLaptopRequest) (*UpdateLaptopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateLaptop not implemented")
+}
+func (UnimplementedLaptopServiceServer) DeleteLaptop(context.Context, *DeleteLaptopRequest) (*DeleteLaptopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLaptop not implemented")
+}
+func (UnimplementedLaptopServiceServer) PurgeDeleted(context.Context, *PurgeDeletedRequest) (*PurgeDeletedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeDeleted not implemented")
+}
 func (UnimplementedLaptopServiceServer) SearchLaptop(*SearchLaptopRequest, LaptopService_SearchLaptopServer) error {
 	return status.Errorf(codes.Unimplemented, "method SearchLaptop not implemented")
 }
+func (UnimplementedLaptopServiceServer) TextSearchLaptop(*TextSearchLaptopRequest, LaptopService_TextSearchLaptopServer) error {
+	return status.Errorf(codes.Unimplemented, "method TextSearchLaptop not implemented")
+}
+func (UnimplementedLaptopServiceServer) Suggest(context.Context, *SuggestRequest) (*SuggestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Suggest not implemented")
+}
+func (UnimplementedLaptopServiceServer) AggregateLaptops(context.Context, *AggregateLaptopsRequest) (*AggregateLaptopsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AggregateLaptops not implemented")
+}
+func (UnimplementedLaptopServiceServer) WatchLaptops(*WatchLaptopsRequest, LaptopService_WatchLaptopsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchLaptops not implemented")
+}
 func (UnimplementedLaptopServiceServer) UploadImage(LaptopService_UploadImageServer) error {
 	return status.Errorf(codes.Unimplemented, "method UploadImage not implemented")
 }
+func (UnimplementedLaptopServiceServer) StartUpload(context.Context, *StartUploadRequest) (*StartUploadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartUpload not implemented")
+}
+func (UnimplementedLaptopServiceServer) UploadChunks(LaptopService_UploadChunksServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadChunks not implemented")
+}
+func (UnimplementedLaptopServiceServer) QueryUpload(context.Context, *QueryUploadRequest) (*QueryUploadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryUpload not implemented")
+}
+func (UnimplementedLaptopServiceServer) FinishUpload(context.Context, *FinishUploadRequest) (*FinishUploadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishUpload not implemented")
+}
+func (UnimplementedLaptopServiceServer) ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListImages not implemented")
+}
+func (UnimplementedLaptopServiceServer) DownloadImage(*DownloadImageRequest, LaptopService_DownloadImageServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadImage not implemented")
+}
+func (UnimplementedLaptopServiceServer) DeleteImage(context.Context, *DeleteImageRequest) (*DeleteImageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteImage not implemented")
+}
+func (UnimplementedLaptopServiceServer) SetPrimaryImage(context.Context, *SetPrimaryImageRequest) (*SetPrimaryImageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPrimaryImage not implemented")
+}
 func (UnimplementedLaptopServiceServer) RateLaptop(LaptopService_RateLaptopServer) error {
 	return status.Errorf(codes.Unimplemented, "method RateLaptop not implemented")
 }
+func (UnimplementedLaptopServiceServer) DeleteRating(context.Context, *DeleteRatingRequest) (*DeleteRatingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteRating not implemented")
+}
+func (UnimplementedLaptopServiceServer) GetMyRatings(context.Context, *GetMyRatingsRequest) (*GetMyRatingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMyRatings not implemented")
+}
+func (UnimplementedLaptopServiceServer) GetRatingSummary(context.Context, *GetRatingSummaryRequest) (*GetRatingSummaryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRatingSummary not implemented")
+}
 
 // UnsafeLaptopServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to LaptopServiceServer will
@@ -198,34 +611,228 @@ func _LaptopService_CreateLaptop_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
-func _LaptopService_SearchLaptop_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(SearchLaptopRequest)
-	if err := stream.RecvMsg(m); err != nil {
-		return err
-	}
-	return srv.(LaptopServiceServer).SearchLaptop(m, &laptopServiceSearchLaptopServer{stream})
+func _LaptopService_BulkCreateLaptops_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LaptopServiceServer).BulkCreateLaptops(&laptopServiceBulkCreateLaptopsServer{stream})
 }
 
-type LaptopService_SearchLaptopServer interface {
-	Send(*SearchLaptopResponse) error
+type LaptopService_BulkCreateLaptopsServer interface {
+	SendAndClose(*BulkCreateLaptopsResponse) error
+	Recv() (*BulkCreateLaptopsRequest, error)
 	grpc.ServerStream
 }
 
-type laptopServiceSearchLaptopServer struct {
+type laptopServiceBulkCreateLaptopsServer struct {
 	grpc.ServerStream
 }
 
-func (x *laptopServiceSearchLaptopServer) Send(m *SearchLaptopResponse) error {
+func (x *laptopServiceBulkCreateLaptopsServer) SendAndClose(m *BulkCreateLaptopsResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
-func _LaptopService_UploadImage_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(LaptopServiceServer).UploadImage(&laptopServiceUploadImageServer{stream})
+func (x *laptopServiceBulkCreateLaptopsServer) Recv() (*BulkCreateLaptopsRequest, error) {
+	m := new(BulkCreateLaptopsRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-type LaptopService_UploadImageServer interface {
-	SendAndClose(*UploadImageResponse) error
-	Recv() (*UploadImageRequest, error)
+func _LaptopService_GetLaptop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLaptopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).GetLaptop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/GetLaptop",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).GetLaptop(ctx, req.(*GetLaptopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_ListLaptops_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLaptopsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).ListLaptops(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/ListLaptops",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).ListLaptops(ctx, req.(*ListLaptopsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_UpdateLaptop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLaptopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).UpdateLaptop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/UpdateLaptop",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).UpdateLaptop(ctx, req.(*UpdateLaptopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_DeleteLaptop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLaptopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).DeleteLaptop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/DeleteLaptop",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).DeleteLaptop(ctx, req.(*DeleteLaptopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_PurgeDeleted_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeDeletedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).PurgeDeleted(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/PurgeDeleted",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).PurgeDeleted(ctx, req.(*PurgeDeletedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_SearchLaptop_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchLaptopRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LaptopServiceServer).SearchLaptop(m, &laptopServiceSearchLaptopServer{stream})
+}
+
+type LaptopService_SearchLaptopServer interface {
+	Send(*SearchLaptopResponse) error
+	grpc.ServerStream
+}
+
+type laptopServiceSearchLaptopServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceSearchLaptopServer) Send(m *SearchLaptopResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _LaptopService_TextSearchLaptop_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TextSearchLaptopRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LaptopServiceServer).TextSearchLaptop(m, &laptopServiceTextSearchLaptopServer{stream})
+}
+
+type LaptopService_TextSearchLaptopServer interface {
+	Send(*TextSearchLaptopResponse) error
+	grpc.ServerStream
+}
+
+type laptopServiceTextSearchLaptopServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceTextSearchLaptopServer) Send(m *TextSearchLaptopResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _LaptopService_Suggest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SuggestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).Suggest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/Suggest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).Suggest(ctx, req.(*SuggestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_AggregateLaptops_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AggregateLaptopsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).AggregateLaptops(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/AggregateLaptops",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).AggregateLaptops(ctx, req.(*AggregateLaptopsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_WatchLaptops_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchLaptopsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LaptopServiceServer).WatchLaptops(m, &laptopServiceWatchLaptopsServer{stream})
+}
+
+type LaptopService_WatchLaptopsServer interface {
+	Send(*WatchLaptopsResponse) error
+	grpc.ServerStream
+}
+
+type laptopServiceWatchLaptopsServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceWatchLaptopsServer) Send(m *WatchLaptopsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _LaptopService_UploadImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LaptopServiceServer).UploadImage(&laptopServiceUploadImageServer{stream})
+}
+
+type LaptopService_UploadImageServer interface {
+	SendAndClose(*UploadImageResponse) error
+	Recv() (*UploadImageRequest, error)
 	grpc.ServerStream
 }
 
@@ -245,6 +852,161 @@ func (x *laptopServiceUploadImageServer) Recv() (*UploadImageRequest, error) {
 	return m, nil
 }
 
+func _LaptopService_StartUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).StartUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/StartUpload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).StartUpload(ctx, req.(*StartUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_UploadChunks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LaptopServiceServer).UploadChunks(&laptopServiceUploadChunksServer{stream})
+}
+
+type LaptopService_UploadChunksServer interface {
+	SendAndClose(*UploadChunksResponse) error
+	Recv() (*UploadChunkRequest, error)
+	grpc.ServerStream
+}
+
+type laptopServiceUploadChunksServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceUploadChunksServer) SendAndClose(m *UploadChunksResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *laptopServiceUploadChunksServer) Recv() (*UploadChunkRequest, error) {
+	m := new(UploadChunkRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _LaptopService_QueryUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).QueryUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/QueryUpload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).QueryUpload(ctx, req.(*QueryUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_FinishUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FinishUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).FinishUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/FinishUpload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).FinishUpload(ctx, req.(*FinishUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_ListImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).ListImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/ListImages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).ListImages(ctx, req.(*ListImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_DownloadImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadImageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LaptopServiceServer).DownloadImage(m, &laptopServiceDownloadImageServer{stream})
+}
+
+type LaptopService_DownloadImageServer interface {
+	Send(*DownloadImageResponse) error
+	grpc.ServerStream
+}
+
+type laptopServiceDownloadImageServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceDownloadImageServer) Send(m *DownloadImageResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _LaptopService_DeleteImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).DeleteImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/DeleteImage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).DeleteImage(ctx, req.(*DeleteImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_SetPrimaryImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPrimaryImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).SetPrimaryImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/SetPrimaryImage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).SetPrimaryImage(ctx, req.(*SetPrimaryImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _LaptopService_RateLaptop_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(LaptopServiceServer).RateLaptop(&laptopServiceRateLaptopServer{stream})
 }
@@ -271,6 +1033,60 @@ func (x *laptopServiceRateLaptopServer) Recv() (*RateLaptopRequest, error) {
 	return m, nil
 }
 
+func _LaptopService_DeleteRating_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRatingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).DeleteRating(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/DeleteRating",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).DeleteRating(ctx, req.(*DeleteRatingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_GetMyRatings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMyRatingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).GetMyRatings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/GetMyRatings",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).GetMyRatings(ctx, req.(*GetMyRatingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_GetRatingSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRatingSummaryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).GetRatingSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/my.pcbook.LaptopService/GetRatingSummary",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).GetRatingSummary(ctx, req.(*GetRatingSummaryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // LaptopService_ServiceDesc is the grpc.ServiceDesc for LaptopService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -282,18 +1098,107 @@ var LaptopService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateLaptop",
 			Handler:    _LaptopService_CreateLaptop_Handler,
 		},
+		{
+			MethodName: "GetLaptop",
+			Handler:    _LaptopService_GetLaptop_Handler,
+		},
+		{
+			MethodName: "ListLaptops",
+			Handler:    _LaptopService_ListLaptops_Handler,
+		},
+		{
+			MethodName: "UpdateLaptop",
+			Handler:    _LaptopService_UpdateLaptop_Handler,
+		},
+		{
+			MethodName: "DeleteLaptop",
+			Handler:    _LaptopService_DeleteLaptop_Handler,
+		},
+		{
+			MethodName: "PurgeDeleted",
+			Handler:    _LaptopService_PurgeDeleted_Handler,
+		},
+		{
+			MethodName: "Suggest",
+			Handler:    _LaptopService_Suggest_Handler,
+		},
+		{
+			MethodName: "AggregateLaptops",
+			Handler:    _LaptopService_AggregateLaptops_Handler,
+		},
+		{
+			MethodName: "StartUpload",
+			Handler:    _LaptopService_StartUpload_Handler,
+		},
+		{
+			MethodName: "QueryUpload",
+			Handler:    _LaptopService_QueryUpload_Handler,
+		},
+		{
+			MethodName: "FinishUpload",
+			Handler:    _LaptopService_FinishUpload_Handler,
+		},
+		{
+			MethodName: "ListImages",
+			Handler:    _LaptopService_ListImages_Handler,
+		},
+		{
+			MethodName: "DeleteImage",
+			Handler:    _LaptopService_DeleteImage_Handler,
+		},
+		{
+			MethodName: "SetPrimaryImage",
+			Handler:    _LaptopService_SetPrimaryImage_Handler,
+		},
+		{
+			MethodName: "DeleteRating",
+			Handler:    _LaptopService_DeleteRating_Handler,
+		},
+		{
+			MethodName: "GetMyRatings",
+			Handler:    _LaptopService_GetMyRatings_Handler,
+		},
+		{
+			MethodName: "GetRatingSummary",
+			Handler:    _LaptopService_GetRatingSummary_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BulkCreateLaptops",
+			Handler:       _LaptopService_BulkCreateLaptops_Handler,
+			ClientStreams: true,
+		},
 		{
 			StreamName:    "SearchLaptop",
 			Handler:       _LaptopService_SearchLaptop_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "TextSearchLaptop",
+			Handler:       _LaptopService_TextSearchLaptop_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchLaptops",
+			Handler:       _LaptopService_WatchLaptops_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "UploadImage",
 			Handler:       _LaptopService_UploadImage_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "UploadChunks",
+			Handler:       _LaptopService_UploadChunks_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadImage",
+			Handler:       _LaptopService_DownloadImage_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "RateLaptop",
 			Handler:       _LaptopService_RateLaptop_Handler,
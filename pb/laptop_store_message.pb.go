@@ -0,0 +1,488 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.0
+// 	protoc        v3.12.4
+// source: laptop_store_message.proto
+
+package pb
+
+import (
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// LaptopMutation is a record of the write-ahead log of the file laptop store
+type LaptopMutation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sequence uint64 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	// Types that are assignable to Mutation:
+	//	*LaptopMutation_Save
+	//	*LaptopMutation_Update
+	//	*LaptopMutation_Delete
+	//	*LaptopMutation_PurgeBefore
+	Mutation isLaptopMutation_Mutation `protobuf_oneof:"mutation"`
+}
+
+func (x *LaptopMutation) Reset() {
+	*x = LaptopMutation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_laptop_store_message_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LaptopMutation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LaptopMutation) ProtoMessage() {}
+
+func (x *LaptopMutation) ProtoReflect() protoreflect.Message {
+	mi := &file_laptop_store_message_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LaptopMutation.ProtoReflect.Descriptor instead.
+func (*LaptopMutation) Descriptor() ([]byte, []int) {
+	return file_laptop_store_message_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *LaptopMutation) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (m *LaptopMutation) GetMutation() isLaptopMutation_Mutation {
+	if m != nil {
+		return m.Mutation
+	}
+	return nil
+}
+
+func (x *LaptopMutation) GetSave() *LaptopBatch {
+	if x, ok := x.GetMutation().(*LaptopMutation_Save); ok {
+		return x.Save
+	}
+	return nil
+}
+
+func (x *LaptopMutation) GetUpdate() *Laptop {
+	if x, ok := x.GetMutation().(*LaptopMutation_Update); ok {
+		return x.Update
+	}
+	return nil
+}
+
+func (x *LaptopMutation) GetDelete() *LaptopTombstone {
+	if x, ok := x.GetMutation().(*LaptopMutation_Delete); ok {
+		return x.Delete
+	}
+	return nil
+}
+
+func (x *LaptopMutation) GetPurgeBefore() *timestamp.Timestamp {
+	if x, ok := x.GetMutation().(*LaptopMutation_PurgeBefore); ok {
+		return x.PurgeBefore
+	}
+	return nil
+}
+
+type isLaptopMutation_Mutation interface {
+	isLaptopMutation_Mutation()
+}
+
+type LaptopMutation_Save struct {
+	// laptops saved together
+	Save *LaptopBatch `protobuf:"bytes,2,opt,name=save,proto3,oneof"`
+}
+
+type LaptopMutation_Update struct {
+	// the laptop after the update
+	Update *Laptop `protobuf:"bytes,3,opt,name=update,proto3,oneof"`
+}
+
+type LaptopMutation_Delete struct {
+	Delete *LaptopTombstone `protobuf:"bytes,4,opt,name=delete,proto3,oneof"`
+}
+
+type LaptopMutation_PurgeBefore struct {
+	PurgeBefore *timestamp.Timestamp `protobuf:"bytes,5,opt,name=purge_before,json=purgeBefore,proto3,oneof"`
+}
+
+func (*LaptopMutation_Save) isLaptopMutation_Mutation() {}
+
+func (*LaptopMutation_Update) isLaptopMutation_Mutation() {}
+
+func (*LaptopMutation_Delete) isLaptopMutation_Mutation() {}
+
+func (*LaptopMutation_PurgeBefore) isLaptopMutation_Mutation() {}
+
+type LaptopBatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Laptops []*Laptop `protobuf:"bytes,1,rep,name=laptops,proto3" json:"laptops,omitempty"`
+}
+
+func (x *LaptopBatch) Reset() {
+	*x = LaptopBatch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_laptop_store_message_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LaptopBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LaptopBatch) ProtoMessage() {}
+
+func (x *LaptopBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_laptop_store_message_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LaptopBatch.ProtoReflect.Descriptor instead.
+func (*LaptopBatch) Descriptor() ([]byte, []int) {
+	return file_laptop_store_message_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LaptopBatch) GetLaptops() []*Laptop {
+	if x != nil {
+		return x.Laptops
+	}
+	return nil
+}
+
+type LaptopTombstone struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Laptop    *Laptop              `protobuf:"bytes,1,opt,name=laptop,proto3" json:"laptop,omitempty"`
+	DeletedAt *timestamp.Timestamp `protobuf:"bytes,2,opt,name=deleted_at,json=deletedAt,proto3" json:"deleted_at,omitempty"`
+	DeletedBy string               `protobuf:"bytes,3,opt,name=deleted_by,json=deletedBy,proto3" json:"deleted_by,omitempty"`
+}
+
+func (x *LaptopTombstone) Reset() {
+	*x = LaptopTombstone{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_laptop_store_message_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LaptopTombstone) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LaptopTombstone) ProtoMessage() {}
+
+func (x *LaptopTombstone) ProtoReflect() protoreflect.Message {
+	mi := &file_laptop_store_message_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LaptopTombstone.ProtoReflect.Descriptor instead.
+func (*LaptopTombstone) Descriptor() ([]byte, []int) {
+	return file_laptop_store_message_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LaptopTombstone) GetLaptop() *Laptop {
+	if x != nil {
+		return x.Laptop
+	}
+	return nil
+}
+
+func (x *LaptopTombstone) GetDeletedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.DeletedAt
+	}
+	return nil
+}
+
+func (x *LaptopTombstone) GetDeletedBy() string {
+	if x != nil {
+		return x.DeletedBy
+	}
+	return ""
+}
+
+// LaptopSnapshot is the state of the file laptop store up to a mutation
+type LaptopSnapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// the sequence of the last mutation included in the snapshot
+	Sequence   uint64             `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Laptops    []*Laptop          `protobuf:"bytes,2,rep,name=laptops,proto3" json:"laptops,omitempty"`
+	Tombstones []*LaptopTombstone `protobuf:"bytes,3,rep,name=tombstones,proto3" json:"tombstones,omitempty"`
+}
+
+func (x *LaptopSnapshot) Reset() {
+	*x = LaptopSnapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_laptop_store_message_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LaptopSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LaptopSnapshot) ProtoMessage() {}
+
+func (x *LaptopSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_laptop_store_message_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LaptopSnapshot.ProtoReflect.Descriptor instead.
+func (*LaptopSnapshot) Descriptor() ([]byte, []int) {
+	return file_laptop_store_message_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LaptopSnapshot) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *LaptopSnapshot) GetLaptops() []*Laptop {
+	if x != nil {
+		return x.Laptops
+	}
+	return nil
+}
+
+func (x *LaptopSnapshot) GetTombstones() []*LaptopTombstone {
+	if x != nil {
+		return x.Tombstones
+	}
+	return nil
+}
+
+var File_laptop_store_message_proto protoreflect.FileDescriptor
+
+var file_laptop_store_message_proto_rawDesc = []byte{
+	0x0a, 0x1a, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x73, 0x74, 0x6f, 0x72, 0x65, 0x5f, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09, 0x6d, 0x79,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x14, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70,
+	0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x8a,
+	0x02, 0x0a, 0x0e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x4d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x2c, 0x0a,
+	0x04, 0x73, 0x61, 0x76, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x6d, 0x79,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x42, 0x61,
+	0x74, 0x63, 0x68, 0x48, 0x00, 0x52, 0x04, 0x73, 0x61, 0x76, 0x65, 0x12, 0x2b, 0x0a, 0x06, 0x75,
+	0x70, 0x64, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x48, 0x00,
+	0x52, 0x06, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x12, 0x34, 0x0a, 0x06, 0x64, 0x65, 0x6c, 0x65,
+	0x74, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63,
+	0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x54, 0x6f, 0x6d, 0x62, 0x73,
+	0x74, 0x6f, 0x6e, 0x65, 0x48, 0x00, 0x52, 0x06, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x12, 0x3f,
+	0x0a, 0x0c, 0x70, 0x75, 0x72, 0x67, 0x65, 0x5f, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x48, 0x00, 0x52, 0x0b, 0x70, 0x75, 0x72, 0x67, 0x65, 0x42, 0x65, 0x66, 0x6f, 0x72, 0x65, 0x42,
+	0x0a, 0x0a, 0x08, 0x6d, 0x75, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x3a, 0x0a, 0x0b, 0x4c,
+	0x61, 0x70, 0x74, 0x6f, 0x70, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x2b, 0x0a, 0x07, 0x6c, 0x61,
+	0x70, 0x74, 0x6f, 0x70, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x07,
+	0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x73, 0x22, 0x96, 0x01, 0x0a, 0x0f, 0x4c, 0x61, 0x70, 0x74,
+	0x6f, 0x70, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x12, 0x29, 0x0a, 0x06, 0x6c,
+	0x61, 0x70, 0x74, 0x6f, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x79,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x52, 0x06,
+	0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x12, 0x39, 0x0a, 0x0a, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x64, 0x5f, 0x61, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d,
+	0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x41,
+	0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x42, 0x79,
+	0x22, 0x95, 0x01, 0x0a, 0x0e, 0x4c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x63, 0x65, 0x12,
+	0x2b, 0x0a, 0x07, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x11, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x52, 0x07, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x73, 0x12, 0x3a, 0x0a, 0x0a,
+	0x74, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x1a, 0x2e, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x4c, 0x61, 0x70,
+	0x74, 0x6f, 0x70, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x52, 0x0a, 0x74, 0x6f,
+	0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x73, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_laptop_store_message_proto_rawDescOnce sync.Once
+	file_laptop_store_message_proto_rawDescData = file_laptop_store_message_proto_rawDesc
+)
+
+func file_laptop_store_message_proto_rawDescGZIP() []byte {
+	file_laptop_store_message_proto_rawDescOnce.Do(func() {
+		file_laptop_store_message_proto_rawDescData = protoimpl.X.CompressGZIP(file_laptop_store_message_proto_rawDescData)
+	})
+	return file_laptop_store_message_proto_rawDescData
+}
+
+var file_laptop_store_message_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_laptop_store_message_proto_goTypes = []interface{}{
+	(*LaptopMutation)(nil),      // 0: my.pcbook.LaptopMutation
+	(*LaptopBatch)(nil),         // 1: my.pcbook.LaptopBatch
+	(*LaptopTombstone)(nil),     // 2: my.pcbook.LaptopTombstone
+	(*LaptopSnapshot)(nil),      // 3: my.pcbook.LaptopSnapshot
+	(*Laptop)(nil),              // 4: my.pcbook.Laptop
+	(*timestamp.Timestamp)(nil), // 5: google.protobuf.Timestamp
+}
+var file_laptop_store_message_proto_depIdxs = []int32{
+	1, // 0: my.pcbook.LaptopMutation.save:type_name -> my.pcbook.LaptopBatch
+	4, // 1: my.pcbook.LaptopMutation.update:type_name -> my.pcbook.Laptop
+	2, // 2: my.pcbook.LaptopMutation.delete:type_name -> my.pcbook.LaptopTombstone
+	5, // 3: my.pcbook.LaptopMutation.purge_before:type_name -> google.protobuf.Timestamp
+	4, // 4: my.pcbook.LaptopBatch.laptops:type_name -> my.pcbook.Laptop
+	4, // 5: my.pcbook.LaptopTombstone.laptop:type_name -> my.pcbook.Laptop
+	5, // 6: my.pcbook.LaptopTombstone.deleted_at:type_name -> google.protobuf.Timestamp
+	4, // 7: my.pcbook.LaptopSnapshot.laptops:type_name -> my.pcbook.Laptop
+	2, // 8: my.pcbook.LaptopSnapshot.tombstones:type_name -> my.pcbook.LaptopTombstone
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_laptop_store_message_proto_init() }
+func file_laptop_store_message_proto_init() {
+	if File_laptop_store_message_proto != nil {
+		return
+	}
+	file_laptop_message_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_laptop_store_message_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LaptopMutation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_laptop_store_message_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LaptopBatch); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_laptop_store_message_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LaptopTombstone); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_laptop_store_message_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*LaptopSnapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_laptop_store_message_proto_msgTypes[0].OneofWrappers = []interface{}{
+		(*LaptopMutation_Save)(nil),
+		(*LaptopMutation_Update)(nil),
+		(*LaptopMutation_Delete)(nil),
+		(*LaptopMutation_PurgeBefore)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_laptop_store_message_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_laptop_store_message_proto_goTypes,
+		DependencyIndexes: file_laptop_store_message_proto_depIdxs,
+		MessageInfos:      file_laptop_store_message_proto_msgTypes,
+	}.Build()
+	File_laptop_store_message_proto = out.File
+	file_laptop_store_message_proto_rawDesc = nil
+	file_laptop_store_message_proto_goTypes = nil
+	file_laptop_store_message_proto_depIdxs = nil
+}
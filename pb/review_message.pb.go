@@ -0,0 +1,352 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.0
+// 	protoc        v3.12.4
+// source: review_message.proto
+
+package pb
+
+import (
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// a review is pending until an admin approves or rejects it
+type Review_State int32
+
+const (
+	Review_UNKNOWN  Review_State = 0
+	Review_PENDING  Review_State = 1
+	Review_APPROVED Review_State = 2
+	Review_REJECTED Review_State = 3
+)
+
+// Enum value maps for Review_State.
+var (
+	Review_State_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "PENDING",
+		2: "APPROVED",
+		3: "REJECTED",
+	}
+	Review_State_value = map[string]int32{
+		"UNKNOWN":  0,
+		"PENDING":  1,
+		"APPROVED": 2,
+		"REJECTED": 3,
+	}
+)
+
+func (x Review_State) Enum() *Review_State {
+	p := new(Review_State)
+	*p = x
+	return p
+}
+
+func (x Review_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Review_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_review_message_proto_enumTypes[0].Descriptor()
+}
+
+func (Review_State) Type() protoreflect.EnumType {
+	return &file_review_message_proto_enumTypes[0]
+}
+
+func (x Review_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Review_State.Descriptor instead.
+func (Review_State) EnumDescriptor() ([]byte, []int) {
+	return file_review_message_proto_rawDescGZIP(), []int{0, 0}
+}
+
+type Review struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	LaptopId string `protobuf:"bytes,2,opt,name=laptop_id,json=laptopId,proto3" json:"laptop_id,omitempty"`
+	// username of the author, taken from the access token
+	Author string       `protobuf:"bytes,3,opt,name=author,proto3" json:"author,omitempty"`
+	Title  string       `protobuf:"bytes,4,opt,name=title,proto3" json:"title,omitempty"`
+	Body   string       `protobuf:"bytes,5,opt,name=body,proto3" json:"body,omitempty"`
+	Pros   []string     `protobuf:"bytes,6,rep,name=pros,proto3" json:"pros,omitempty"`
+	Cons   []string     `protobuf:"bytes,7,rep,name=cons,proto3" json:"cons,omitempty"`
+	Rating float64      `protobuf:"fixed64,8,opt,name=rating,proto3" json:"rating,omitempty"`
+	State  Review_State `protobuf:"varint,9,opt,name=state,proto3,enum=my.pcbook.Review_State" json:"state,omitempty"`
+	// the admin who approved or rejected the review, with an optional note
+	ModeratedBy    string               `protobuf:"bytes,10,opt,name=moderated_by,json=moderatedBy,proto3" json:"moderated_by,omitempty"`
+	ModerationNote string               `protobuf:"bytes,11,opt,name=moderation_note,json=moderationNote,proto3" json:"moderation_note,omitempty"`
+	HelpfulCount   uint32               `protobuf:"varint,12,opt,name=helpful_count,json=helpfulCount,proto3" json:"helpful_count,omitempty"`
+	UnhelpfulCount uint32               `protobuf:"varint,13,opt,name=unhelpful_count,json=unhelpfulCount,proto3" json:"unhelpful_count,omitempty"`
+	CreatedAt      *timestamp.Timestamp `protobuf:"bytes,14,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	ModeratedAt    *timestamp.Timestamp `protobuf:"bytes,15,opt,name=moderated_at,json=moderatedAt,proto3" json:"moderated_at,omitempty"`
+}
+
+func (x *Review) Reset() {
+	*x = Review{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_review_message_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Review) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Review) ProtoMessage() {}
+
+func (x *Review) ProtoReflect() protoreflect.Message {
+	mi := &file_review_message_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Review.ProtoReflect.Descriptor instead.
+func (*Review) Descriptor() ([]byte, []int) {
+	return file_review_message_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Review) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Review) GetLaptopId() string {
+	if x != nil {
+		return x.LaptopId
+	}
+	return ""
+}
+
+func (x *Review) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *Review) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Review) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+func (x *Review) GetPros() []string {
+	if x != nil {
+		return x.Pros
+	}
+	return nil
+}
+
+func (x *Review) GetCons() []string {
+	if x != nil {
+		return x.Cons
+	}
+	return nil
+}
+
+func (x *Review) GetRating() float64 {
+	if x != nil {
+		return x.Rating
+	}
+	return 0
+}
+
+func (x *Review) GetState() Review_State {
+	if x != nil {
+		return x.State
+	}
+	return Review_UNKNOWN
+}
+
+func (x *Review) GetModeratedBy() string {
+	if x != nil {
+		return x.ModeratedBy
+	}
+	return ""
+}
+
+func (x *Review) GetModerationNote() string {
+	if x != nil {
+		return x.ModerationNote
+	}
+	return ""
+}
+
+func (x *Review) GetHelpfulCount() uint32 {
+	if x != nil {
+		return x.HelpfulCount
+	}
+	return 0
+}
+
+func (x *Review) GetUnhelpfulCount() uint32 {
+	if x != nil {
+		return x.UnhelpfulCount
+	}
+	return 0
+}
+
+func (x *Review) GetCreatedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Review) GetModeratedAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.ModeratedAt
+	}
+	return nil
+}
+
+var File_review_message_proto protoreflect.FileDescriptor
+
+var file_review_message_proto_rawDesc = []byte{
+	0x0a, 0x14, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09, 0x6d, 0x79, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f,
+	0x6b, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x22, 0xb9, 0x04, 0x0a, 0x06, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1b, 0x0a,
+	0x09, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x6c, 0x61, 0x70, 0x74, 0x6f, 0x70, 0x49, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x61, 0x75,
+	0x74, 0x68, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x61, 0x75, 0x74, 0x68,
+	0x6f, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x12, 0x12, 0x0a, 0x04,
+	0x70, 0x72, 0x6f, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04, 0x70, 0x72, 0x6f, 0x73,
+	0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x6e, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x09, 0x52, 0x04,
+	0x63, 0x6f, 0x6e, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x72, 0x61, 0x74, 0x69, 0x6e, 0x67, 0x12, 0x2d, 0x0a, 0x05,
+	0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e, 0x6d, 0x79,
+	0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x2e, 0x53,
+	0x74, 0x61, 0x74, 0x65, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x6d,
+	0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x18, 0x0a, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x42, 0x79, 0x12, 0x27,
+	0x0a, 0x0f, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x6e, 0x6f, 0x74,
+	0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x4e, 0x6f, 0x74, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x68, 0x65, 0x6c, 0x70, 0x66,
+	0x75, 0x6c, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c,
+	0x68, 0x65, 0x6c, 0x70, 0x66, 0x75, 0x6c, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x27, 0x0a, 0x0f,
+	0x75, 0x6e, 0x68, 0x65, 0x6c, 0x70, 0x66, 0x75, 0x6c, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18,
+	0x0d, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x75, 0x6e, 0x68, 0x65, 0x6c, 0x70, 0x66, 0x75, 0x6c,
+	0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x39, 0x0a, 0x0a, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64,
+	0x5f, 0x61, 0x74, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74,
+	0x12, 0x3d, 0x0a, 0x0c, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74,
+	0x18, 0x0f, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x52, 0x0b, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x22,
+	0x3d, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e,
+	0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x50, 0x45, 0x4e, 0x44, 0x49, 0x4e, 0x47,
+	0x10, 0x01, 0x12, 0x0c, 0x0a, 0x08, 0x41, 0x50, 0x50, 0x52, 0x4f, 0x56, 0x45, 0x44, 0x10, 0x02,
+	0x12, 0x0c, 0x0a, 0x08, 0x52, 0x45, 0x4a, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x03, 0x42, 0x06,
+	0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_review_message_proto_rawDescOnce sync.Once
+	file_review_message_proto_rawDescData = file_review_message_proto_rawDesc
+)
+
+func file_review_message_proto_rawDescGZIP() []byte {
+	file_review_message_proto_rawDescOnce.Do(func() {
+		file_review_message_proto_rawDescData = protoimpl.X.CompressGZIP(file_review_message_proto_rawDescData)
+	})
+	return file_review_message_proto_rawDescData
+}
+
+var file_review_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_review_message_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_review_message_proto_goTypes = []interface{}{
+	(Review_State)(0),           // 0: my.pcbook.Review.State
+	(*Review)(nil),              // 1: my.pcbook.Review
+	(*timestamp.Timestamp)(nil), // 2: google.protobuf.Timestamp
+}
+var file_review_message_proto_depIdxs = []int32{
+	0, // 0: my.pcbook.Review.state:type_name -> my.pcbook.Review.State
+	2, // 1: my.pcbook.Review.created_at:type_name -> google.protobuf.Timestamp
+	2, // 2: my.pcbook.Review.moderated_at:type_name -> google.protobuf.Timestamp
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_review_message_proto_init() }
+func file_review_message_proto_init() {
+	if File_review_message_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_review_message_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Review); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_review_message_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_review_message_proto_goTypes,
+		DependencyIndexes: file_review_message_proto_depIdxs,
+		EnumInfos:         file_review_message_proto_enumTypes,
+		MessageInfos:      file_review_message_proto_msgTypes,
+	}.Build()
+	File_review_message_proto = out.File
+	file_review_message_proto_rawDesc = nil
+	file_review_message_proto_goTypes = nil
+	file_review_message_proto_depIdxs = nil
+}
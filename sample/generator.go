@@ -1,124 +1,137 @@
-package sample
-
-import (
-	"pcbook/pb"
-
-	"google.golang.org/protobuf/types/known/timestamppb"
-)
-
-func NewKeyboard() *pb.Keyboard {
-	keyboard := &pb.Keyboard{
-		Layout:  randomKeyboardLayout(),
-		Backlit: randomBool(),
-	}
-	return keyboard
-}
-
-func NewCPU() *pb.CPU {
-	brand := randomCPUBrand()
-	name := randomCPUName(brand)
-	numberCores := randomInt(2, 8)
-	numberThreads := randomInt(numberCores, numberCores*2)
-	minGhz := randomFloat64(2.0, 3.0)
-	maxGhz := randomFloat64(minGhz, 5.0)
-
-	cpu := &pb.CPU{
-		Brand:         brand,
-		Name:          name,
-		NumberCores:   uint32(numberCores),
-		NumberThreads: uint32(numberThreads),
-		MinGhz:        minGhz,
-		MaxGhz:        maxGhz,
-	}
-	return cpu
-}
-
-func NewGPU() *pb.GPU {
-	brand := randomGPUBrand()
-	name := randomGPUName(brand)
-	minGhz := randomFloat64(1.0, 1.5)
-	maxGhz := randomFloat64(minGhz, 2.0)
-	memory := &pb.Memory{
-		Value: uint64(randomInt(2, 8)),
-		Unit:  pb.Memory_GIGABYTE,
-	}
-
-	gpu := &pb.GPU{
-		Brand:  brand,
-		Name:   name,
-		MinGhz: minGhz,
-		MaxGhz: maxGhz,
-		Memory: memory,
-	}
-	return gpu
-}
-
-func NewRAM() *pb.Memory {
-	ram := &pb.Memory{
-		Value: uint64(randomInt(4, 128)),
-		Unit:  pb.Memory_GIGABYTE,
-	}
-	return ram
-}
-
-func NewSSD() *pb.Storage {
-	ssd := &pb.Storage{
-		Driver: pb.Storage_SDD,
-		Memory: &pb.Memory{
-			Value: uint64(randomInt(64, 4096)),
-			Unit:  pb.Memory_GIGABYTE,
-		},
-	}
-	return ssd
-}
-
-func NewHDD() *pb.Storage {
-	hdd := &pb.Storage{
-		Driver: pb.Storage_HDD,
-		Memory: &pb.Memory{
-			Value: uint64(randomInt(1, 8)),
-			Unit:  pb.Memory_TERABYTE,
-		},
-	}
-	return hdd
-}
-
-func NewScreen() *pb.Screen {
-	screen := &pb.Screen{
-		SizeInch:   randomFloat32(13, 32),
-		Resolution: randomScreenResolution(),
-		Panel:      randomScreenPanel(),
-		Multtouch:  randomBool(),
-	}
-
-	return screen
-}
-
-func NewLaptop() *pb.Laptop {
-	brand := randomLaptopBrand()
-	name := randomLaptopName(brand)
-
-	laptop := &pb.Laptop{
-		Id:       randomID(),
-		Brand:    brand,
-		Name:     name,
-		Cpu:      NewCPU(),
-		Ram:      NewRAM(),
-		Gpus:     []*pb.GPU{NewGPU()},
-		Storages: []*pb.Storage{NewHDD(), NewSSD()},
-		Screen:   NewScreen(),
-		Keyboard: NewKeyboard(),
-		Weight: &pb.Laptop_WeightKg{
-			WeightKg: randomFloat64(1.0, 3.0),
-		},
-		PriceUsd:    randomFloat64(500, 3000),
-		ReleaseYear: uint32(randomInt(2014, 2022)),
-		UpdatedAt:   timestamppb.Now(),
-	}
-
-	return laptop
-}
-
-func NewRating() float64 {
-	return randomFloat64(1.0, 10.0)
-}
+package sample
+
+import (
+	"pcbook/pb"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func NewKeyboard() *pb.Keyboard {
+	keyboard := &pb.Keyboard{
+		Layout:  randomKeyboardLayout(),
+		Backlit: randomBool(),
+	}
+	return keyboard
+}
+
+func NewCPU() *pb.CPU {
+	brand := randomCPUBrand()
+	name := randomCPUName(brand)
+	numberCores := randomInt(2, 8)
+	numberThreads := randomInt(numberCores, numberCores*2)
+	minGhz := randomFloat64(2.0, 3.0)
+	maxGhz := randomFloat64(minGhz, 5.0)
+
+	cpu := &pb.CPU{
+		Brand:         brand,
+		Name:          name,
+		NumberCores:   uint32(numberCores),
+		NumberThreads: uint32(numberThreads),
+		MinGhz:        minGhz,
+		MaxGhz:        maxGhz,
+	}
+	return cpu
+}
+
+func NewGPU() *pb.GPU {
+	brand := randomGPUBrand()
+	name := randomGPUName(brand)
+	minGhz := randomFloat64(1.0, 1.5)
+	maxGhz := randomFloat64(minGhz, 2.0)
+	memory := &pb.Memory{
+		Value: uint64(randomInt(2, 8)),
+		Unit:  pb.Memory_GIGABYTE,
+	}
+
+	gpu := &pb.GPU{
+		Brand:  brand,
+		Name:   name,
+		MinGhz: minGhz,
+		MaxGhz: maxGhz,
+		Memory: memory,
+	}
+	return gpu
+}
+
+func NewRAM() *pb.Memory {
+	ram := &pb.Memory{
+		Value: uint64(randomInt(4, 128)),
+		Unit:  pb.Memory_GIGABYTE,
+	}
+	return ram
+}
+
+func NewSSD() *pb.Storage {
+	ssd := &pb.Storage{
+		Driver: pb.Storage_SDD,
+		Memory: &pb.Memory{
+			Value: uint64(randomInt(64, 4096)),
+			Unit:  pb.Memory_GIGABYTE,
+		},
+	}
+	return ssd
+}
+
+func NewHDD() *pb.Storage {
+	hdd := &pb.Storage{
+		Driver: pb.Storage_HDD,
+		Memory: &pb.Memory{
+			Value: uint64(randomInt(1, 8)),
+			Unit:  pb.Memory_TERABYTE,
+		},
+	}
+	return hdd
+}
+
+func NewScreen() *pb.Screen {
+	screen := &pb.Screen{
+		SizeInch:   randomFloat32(13, 32),
+		Resolution: randomScreenResolution(),
+		Panel:      randomScreenPanel(),
+		Multtouch:  randomBool(),
+	}
+
+	return screen
+}
+
+func NewLaptop() *pb.Laptop {
+	brand := randomLaptopBrand()
+	name := randomLaptopName(brand)
+
+	laptop := &pb.Laptop{
+		Id:       randomID(),
+		Brand:    brand,
+		Name:     name,
+		Cpu:      NewCPU(),
+		Ram:      NewRAM(),
+		Gpus:     []*pb.GPU{NewGPU()},
+		Storages: []*pb.Storage{NewHDD(), NewSSD()},
+		Screen:   NewScreen(),
+		Keyboard: NewKeyboard(),
+		Weight: &pb.Laptop_WeightKg{
+			WeightKg: randomFloat64(1.0, 3.0),
+		},
+		PriceUsd:    randomFloat64(500, 3000),
+		ReleaseYear: uint32(randomInt(2014, 2022)),
+		UpdatedAt:   timestamppb.Now(),
+	}
+
+	return laptop
+}
+
+// NewRating returns a rating of the default scale, from 1 to 10 by steps of 0.5
+func NewRating() float64 {
+	return float64(randomInt(2, 20)) / 2
+}
+
+// NewReview returns a review of the laptop as a user writes it, without the fields set by the server
+func NewReview(laptopId string) *pb.Review {
+	return &pb.Review{
+		LaptopId: laptopId,
+		Title:    randomStringFromSet("Great value", "Solid machine", "Not for gaming", "Fast and light"),
+		Body:     randomStringFromSet("Boots quickly and the screen is sharp.", "The battery lasts a full working day.", "Runs hot under load but stays quiet."),
+		Pros:     []string{randomStringFromSet("battery", "screen", "keyboard", "price")},
+		Cons:     []string{randomStringFromSet("weight", "fan noise", "ports", "speakers")},
+		Rating:   NewRating(),
+	}
+}
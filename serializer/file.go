@@ -1,62 +1,62 @@
-package serializer
-
-import (
-	"fmt"
-	"io/ioutil"
-
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/proto"
-)
-
-func WriteProtobufToBinaryFile(message proto.Message, filename string) error {
-	data, err := proto.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal proto message to binary: %w", err)
-	}
-
-	err = ioutil.WriteFile(filename, data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write binary data to file: %w", err)
-	}
-
-	return nil
-}
-
-func ReadProtobufFromBinaryFile(filename string, message proto.Message) error {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read binary from file: %w", err)
-	}
-
-	err = proto.Unmarshal(data, message)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal binary to proto message: %w", err)
-	}
-	return nil
-}
-
-func WriteProtobufToJSONFile(message proto.Message, filename string) error {
-	data, err := ProtobufToJSON(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal proto message to JSON: %w", err)
-	}
-
-	err = ioutil.WriteFile(filename, data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write JSON data to file: %w", err)
-	}
-	return nil
-}
-
-func ReadProtobufFromJSONFile(filename string, message proto.Message) error {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read JSON from file: %w", err)
-	}
-
-	err = protojson.Unmarshal(data, message)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal JSON to proto message: %w", err)
-	}
-	return nil
-}
+package serializer
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func WriteProtobufToBinaryFile(message proto.Message, filename string) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal proto message to binary: %w", err)
+	}
+
+	err = ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write binary data to file: %w", err)
+	}
+
+	return nil
+}
+
+func ReadProtobufFromBinaryFile(filename string, message proto.Message) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read binary from file: %w", err)
+	}
+
+	err = proto.Unmarshal(data, message)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal binary to proto message: %w", err)
+	}
+	return nil
+}
+
+func WriteProtobufToJSONFile(message proto.Message, filename string) error {
+	data, err := ProtobufToJSON(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal proto message to JSON: %w", err)
+	}
+
+	err = ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write JSON data to file: %w", err)
+	}
+	return nil
+}
+
+func ReadProtobufFromJSONFile(filename string, message proto.Message) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read JSON from file: %w", err)
+	}
+
+	err = protojson.Unmarshal(data, message)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON to proto message: %w", err)
+	}
+	return nil
+}
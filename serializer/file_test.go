@@ -1,36 +1,36 @@
-package serializer_test
-
-import (
-	"pcbook/pb"
-	"pcbook/sample"
-	"pcbook/serializer"
-	"testing"
-
-	"github.com/stretchr/testify/require"
-	"google.golang.org/protobuf/proto"
-)
-
-func TestFileSerializer(t *testing.T) {
-	t.Parallel()
-
-	binaryFile := "../tmp/laptop.bin"
-	jsonFile := "../tmp/laptop.json"
-
-	//binary
-	laptop1 := sample.NewLaptop()
-	err := serializer.WriteProtobufToBinaryFile(laptop1, binaryFile)
-	require.NoError(t, err)
-
-	laptop2 := &pb.Laptop{}
-	err = serializer.ReadProtobufFromBinaryFile(binaryFile, laptop2)
-	require.NoError(t, err)
-	require.True(t, proto.Equal(laptop1, laptop2))
-
-	//JSON
-	err = serializer.WriteProtobufToJSONFile(laptop1, jsonFile)
-	require.NoError(t, err)
-
-	err = serializer.ReadProtobufFromJSONFile(jsonFile, laptop2)
-	require.NoError(t, err)
-	require.True(t, proto.Equal(laptop1, laptop2))
-}
+package serializer_test
+
+import (
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/serializer"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFileSerializer(t *testing.T) {
+	t.Parallel()
+
+	binaryFile := "../tmp/laptop.bin"
+	jsonFile := "../tmp/laptop.json"
+
+	//binary
+	laptop1 := sample.NewLaptop()
+	err := serializer.WriteProtobufToBinaryFile(laptop1, binaryFile)
+	require.NoError(t, err)
+
+	laptop2 := &pb.Laptop{}
+	err = serializer.ReadProtobufFromBinaryFile(binaryFile, laptop2)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(laptop1, laptop2))
+
+	//JSON
+	err = serializer.WriteProtobufToJSONFile(laptop1, jsonFile)
+	require.NoError(t, err)
+
+	err = serializer.ReadProtobufFromJSONFile(jsonFile, laptop2)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(laptop1, laptop2))
+}
@@ -1,16 +1,16 @@
-package serializer
-
-import (
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/proto"
-)
-
-func ProtobufToJSON(message proto.Message) ([]byte, error) {
-	marshaler := protojson.MarshalOptions{
-		UseEnumNumbers:  false,
-		EmitUnpopulated: true,
-		UseProtoNames:   false,
-		Indent:          " ",
-	}
-	return marshaler.Marshal(message)
-}
+package serializer
+
+import (
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func ProtobufToJSON(message proto.Message) ([]byte, error) {
+	marshaler := protojson.MarshalOptions{
+		UseEnumNumbers:  false,
+		EmitUnpopulated: true,
+		UseProtoNames:   false,
+		Indent:          " ",
+	}
+	return marshaler.Marshal(message)
+}
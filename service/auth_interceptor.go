@@ -1,75 +1,146 @@
-package service
-
-import (
-	"context"
-	"log"
-
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
-)
-
-type AuthInterceptor struct {
-	jwtMaganer       *JWTMaganer
-	accessiableRoles map[string][]string
-}
-
-func NewAuthInterceptor(jwtMaganer *JWTMaganer, accessiableRoles map[string][]string) *AuthInterceptor {
-	return &AuthInterceptor{jwtMaganer: jwtMaganer, accessiableRoles: accessiableRoles}
-}
-
-func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
-	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		log.Printf("--> intercepted unary call: %s", info.FullMethod)
-		err := interceptor.authorize(ctx, info.FullMethod)
-		if err != nil {
-			return nil, err
-		}
-
-		return handler(ctx, req)
-	}
-}
-
-func (interceptor *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
-	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		log.Printf("--> intercepted stream call: %s", info.FullMethod)
-
-		err := interceptor.authorize(ss.Context(), info.FullMethod)
-		if err != nil {
-			return err
-		}
-
-		return handler(srv, ss)
-	}
-}
-
-func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) error {
-	accessibleRoles, ok := interceptor.accessiableRoles[method]
-	if !ok { //everyone
-		return nil
-	}
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return status.Errorf(codes.Unauthenticated, "missing credentials")
-	}
-
-	values := md["authorization"]
-	if len(values) == 0 {
-		return status.Errorf(codes.Unauthenticated, "authorization token is not provided")
-	}
-
-	accessToken := values[0]
-	claims, err := interceptor.jwtMaganer.Verify(accessToken)
-	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "invalid authorization token: %v", err)
-	}
-
-	for _, role := range accessibleRoles {
-		if role == claims.Role {
-			return nil
-		}
-	}
-
-	return status.Error(codes.PermissionDenied, "permission denied")
-}
+package service
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type AuthInterceptor struct {
+	jwtMaganer       *JWTMaganer
+	accessiableRoles map[string][]string
+}
+
+func NewAuthInterceptor(jwtMaganer *JWTMaganer, accessiableRoles map[string][]string) *AuthInterceptor {
+	return &AuthInterceptor{jwtMaganer: jwtMaganer, accessiableRoles: accessiableRoles}
+}
+
+func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		log.Printf("--> intercepted unary call: %s", info.FullMethod)
+		ctx, err := interceptor.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (interceptor *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		log.Printf("--> intercepted stream call: %s", info.FullMethod)
+
+		ctx, err := interceptor.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authorizedServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorize checks the access token and returns a context carrying the user claims.
+// A method open to everyone is called anonymously unless a valid token is provided
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	accessibleRoles, ok := interceptor.accessiableRoles[method]
+
+	var accessToken string
+	if md, found := metadata.FromIncomingContext(ctx); found && len(md["authorization"]) > 0 {
+		accessToken = md["authorization"][0]
+	}
+
+	if !ok { //everyone
+		return interceptor.withOptionalClaims(ctx, accessToken), nil
+	}
+	if accessToken == "" {
+		return nil, status.Errorf(codes.Unauthenticated, "authorization token is not provided")
+	}
+
+	claims, err := interceptor.verify(accessToken, accessibleRoles)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, userClaimsKey{}, claims), nil
+}
+
+// withOptionalClaims adds the claims of a valid access token to the context, an invalid one is ignored
+func (interceptor *AuthInterceptor) withOptionalClaims(ctx context.Context, accessToken string) context.Context {
+	if accessToken == "" {
+		return ctx
+	}
+	claims, err := interceptor.jwtMaganer.Verify(accessToken)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, userClaimsKey{}, claims)
+}
+
+// verify checks the access token and that its role is one of the accessible roles
+func (interceptor *AuthInterceptor) verify(accessToken string, accessibleRoles []string) (*UserClaims, error) {
+	claims, err := interceptor.jwtMaganer.Verify(accessToken)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid authorization token: %v", err)
+	}
+
+	for _, role := range accessibleRoles {
+		if role == claims.Role {
+			return claims, nil
+		}
+	}
+
+	return nil, status.Error(codes.PermissionDenied, "permission denied")
+}
+
+// HTTP checks the access token of the Authorization header of a plain HTTP request
+// with the accessible roles of a gRPC method, like the REST gateway would for the method.
+// The request context of the handler carries the user claims
+func (interceptor *AuthInterceptor) HTTP(method string, handler runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		log.Printf("--> intercepted http request: %s %s as %s", r.Method, r.URL.Path, method)
+
+		accessibleRoles, ok := interceptor.accessiableRoles[method]
+		accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok { //everyone
+			handler(w, r.WithContext(interceptor.withOptionalClaims(r.Context(), accessToken)), pathParams)
+			return
+		}
+
+		if accessToken == "" {
+			http.Error(w, "authorization token is not provided", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := interceptor.verify(accessToken, accessibleRoles)
+		if err != nil {
+			http.Error(w, status.Convert(err).Message(), runtime.HTTPStatusFromCode(status.Code(err)))
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), userClaimsKey{}, claims)), pathParams)
+	}
+}
+
+type userClaimsKey struct{}
+
+// UserClaimsFromContext returns the claims of the authorized user
+func UserClaimsFromContext(ctx context.Context) (*UserClaims, bool) {
+	claims, ok := ctx.Value(userClaimsKey{}).(*UserClaims)
+	return claims, ok
+}
+
+// authorizedServerStream overrides the context of a stream with the authorized one
+type authorizedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authorizedServerStream) Context() context.Context {
+	return stream.ctx
+}
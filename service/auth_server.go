@@ -1,36 +1,36 @@
-package service
-
-import (
-	"context"
-	"pcbook/pb"
-
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-)
-
-type AuthServer struct {
-	userStore  UserStore
-	jwtManager *JWTMaganer
-}
-
-func NewAuthServer(userStore UserStore, jwtManager *JWTMaganer) *AuthServer {
-	return &AuthServer{userStore: userStore, jwtManager: jwtManager}
-}
-
-func (server *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	user, err := server.userStore.Find(req.GetUsername())
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to find user: %v", err)
-	}
-
-	if user == nil || !user.IsCorrectPassword(req.GetPassword()) {
-		return nil, status.Errorf(codes.NotFound, "invalid username or password")
-	}
-
-	token, err := server.jwtManager.Generate(user)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to generate token: %v", err)
-	}
-
-	return &pb.LoginResponse{AccessToken: token}, nil
-}
+package service
+
+import (
+	"context"
+	"pcbook/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type AuthServer struct {
+	userStore  UserStore
+	jwtManager *JWTMaganer
+}
+
+func NewAuthServer(userStore UserStore, jwtManager *JWTMaganer) *AuthServer {
+	return &AuthServer{userStore: userStore, jwtManager: jwtManager}
+}
+
+func (server *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	user, err := server.userStore.Find(req.GetUsername())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to find user: %v", err)
+	}
+
+	if user == nil || !user.IsCorrectPassword(req.GetPassword()) {
+		return nil, status.Errorf(codes.NotFound, "invalid username or password")
+	}
+
+	token, err := server.jwtManager.Generate(user)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate token: %v", err)
+	}
+
+	return &pb.LoginResponse{AccessToken: token}, nil
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ContentImageStoreConfig struct {
+	Folder string
+	// MaxImageSize is the size limit of an image in bytes
+	MaxImageSize int64
+	// MaxWidth and MaxHeight are the dimension limits of an image in pixels
+	MaxWidth  int
+	MaxHeight int
+	// GCInterval runs the garbage collection periodically, it is only run by CollectGarbage if it is zero
+	GCInterval time.Duration
+}
+
+// imageBlob is the data of the images with the same digest
+type imageBlob struct {
+	path   string
+	size   int64
+	width  int
+	height int
+	// variants are made once for all the images of the blob
+	variants []*ImageVariant
+	// refs is the number of images of the blob, a blob without any is removed by the garbage collection
+	refs int
+}
+
+// ContentImageStore keeps the data of the images as blobs named by their SHA-256 digest,
+// so the images with the same data share one blob and its variants.
+// Deleting an image only drops its reference, the unreferenced blobs are removed by the garbage collection.
+// Like DiskImageStore, the image infos are kept in memory
+type ContentImageStore struct {
+	mutex   sync.Mutex
+	config  ContentImageStoreConfig
+	catalog *imageCatalog
+	blobs   map[string]*imageBlob
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewContentImageStore(config ContentImageStoreConfig) (*ContentImageStore, error) {
+	limits := DiskImageStoreConfig{MaxImageSize: config.MaxImageSize, MaxWidth: config.MaxWidth, MaxHeight: config.MaxHeight}.withDefaults()
+	config.MaxImageSize, config.MaxWidth, config.MaxHeight = limits.MaxImageSize, limits.MaxWidth, limits.MaxHeight
+
+	err := os.MkdirAll(config.Folder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create image folder: %w", err)
+	}
+
+	store := &ContentImageStore{
+		config:  config,
+		catalog: newImageCatalog(),
+		blobs:   make(map[string]*imageBlob),
+		done:    make(chan struct{}),
+	}
+
+	// the references are only counted for the images in the catalog, so the blobs written before a crash
+	// or by a previous process would never be collected
+	swept, err := store.sweepBlobs()
+	if err != nil {
+		return nil, err
+	}
+	if swept > 0 {
+		log.Printf("removed %d unreferenced image blob files", swept)
+	}
+
+	if config.GCInterval > 0 {
+		store.wg.Add(1)
+		go store.collectPeriodically()
+	}
+	return store, nil
+}
+
+// sweepBlobs removes the files of the blob folders whose digest has no blob in the store,
+// and the temporary files of unfinished saves. It returns how many files were removed
+func (store *ContentImageStore) sweepBlobs() (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	removed := 0
+	err := filepath.WalkDir(store.config.Folder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		// a blob and its variants are named by the digest, in the folder of its first byte
+		folder := filepath.Dir(path)
+		digest := strings.SplitN(entry.Name(), "_", 2)[0]
+		temp := folder == filepath.Clean(store.config.Folder) && filepath.Ext(path) == ".tmp"
+		unreferenced := len(digest) == sha256.Size*2 && strings.HasPrefix(digest, filepath.Base(folder)) && store.blobs[digest] == nil
+		if !temp && !unreferenced {
+			return nil
+		}
+
+		err = os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("cannot remove unreferenced image file: %w", err)
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// blobPath returns the path of a blob, the blobs are spread over folders by the first byte of their digest
+func (store *ContentImageStore) blobPath(digest string) string {
+	return filepath.Join(store.config.Folder, digest[:2], digest)
+}
+
+// Save streams the image data to a temporary file while hashing it. If a blob with the same digest exists,
+// the image refers to it and the file is dropped, otherwise the file becomes a new blob
+func (store *ContentImageStore) Save(laptopID string, imageType string, imageData io.Reader, uploadedBy string) (string, error) {
+	imageID, err := uuid.NewUUID()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate a new image ID: %w", err)
+	}
+
+	data, config, err := checkImage(io.LimitReader(imageData, store.config.MaxImageSize+1), imageType, store.config.MaxWidth, store.config.MaxHeight)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	tempPath, size, err := writeTempFile(store.config.Folder, "*.tmp", io.TeeReader(data, hash), store.config.MaxImageSize)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempPath)
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	image := &ImageInfo{
+		ID:          imageID.String(),
+		LaptopID:    laptopID,
+		Type:        imageType,
+		ContentType: contentType(imageType),
+		Size:        size,
+		Digest:      digest,
+		UploadedAt:  time.Now(),
+		UploadedBy:  uploadedBy,
+	}
+
+	if store.addReference(image) {
+		return image.ID, nil
+	}
+
+	// the variants are made without the lock, another upload of the same data may add the blob meanwhile
+	file, err := os.Open(tempPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot open image file: %w", err)
+	}
+	encoded, err := makeImageVariants(file)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.addReferenceLocked(image) {
+		return image.ID, nil
+	}
+
+	blobPath := store.blobPath(digest)
+	err = os.MkdirAll(filepath.Dir(blobPath), 0755)
+	if err != nil {
+		return "", fmt.Errorf("cannot create blob folder: %w", err)
+	}
+	err = renameFile(tempPath, blobPath)
+	if err != nil {
+		return "", err
+	}
+	variants, err := writeImageVariants(blobPath, encoded)
+	if err != nil {
+		os.Remove(blobPath)
+		return "", err
+	}
+
+	store.blobs[digest] = &imageBlob{
+		path:     blobPath,
+		size:     size,
+		width:    config.Width,
+		height:   config.Height,
+		variants: variants,
+	}
+	store.addReferenceLocked(image)
+	return image.ID, nil
+}
+
+// addReference adds the image if the blob of its digest exists and returns whether it does
+func (store *ContentImageStore) addReference(image *ImageInfo) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.addReferenceLocked(image)
+}
+
+func (store *ContentImageStore) addReferenceLocked(image *ImageInfo) bool {
+	blob := store.blobs[image.Digest]
+	if blob == nil {
+		return false
+	}
+
+	blob.refs++
+	image.Path = blob.path
+	image.Width = blob.width
+	image.Height = blob.height
+	image.Variants = blob.variants
+	store.catalog.add(image)
+	return true
+}
+
+func (store *ContentImageStore) Find(imageID string) (*ImageInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.catalog.find(imageID)
+}
+
+// List returns the images of a laptop in upload order
+func (store *ContentImageStore) List(laptopID string) ([]*ImageInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.catalog.list(laptopID), nil
+}
+
+// Open returns the info of an image and the data of the variant, the data must be closed by the caller.
+// The blob stays readable after the image is deleted, since an open file is not affected by its removal
+func (store *ContentImageStore) Open(imageID string, variant string) (*ImageInfo, io.ReadCloser, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image, err := store.catalog.find(imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return openImageFile(image, variant)
+}
+
+// Delete removes an image and drops its reference to the blob
+func (store *ContentImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := store.catalog.remove(imageID)
+	if image == nil {
+		return fmt.Errorf("image with id %s: %w", imageID, ErrNotFound)
+	}
+
+	store.blobs[image.Digest].refs--
+	return nil
+}
+
+// SetPrimary makes an image the primary one of its laptop
+func (store *ContentImageStore) SetPrimary(imageID string) (*ImageInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.catalog.setPrimary(imageID)
+}
+
+func (store *ContentImageStore) DeleteByLaptop(laptopID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, image := range store.catalog.list(laptopID) {
+		store.catalog.remove(image.ID)
+		store.blobs[image.Digest].refs--
+	}
+	return nil
+}
+
+// CollectGarbage removes the blobs without any image and returns how many they were.
+// A blob is kept until then, so an image uploaded again meanwhile reuses it
+func (store *ContentImageStore) CollectGarbage() (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	removed := 0
+	for digest, blob := range store.blobs {
+		if blob.refs > 0 {
+			continue
+		}
+
+		err := removeImageFiles(&ImageInfo{Path: blob.path, Variants: blob.variants})
+		if err != nil {
+			return removed, err
+		}
+		delete(store.blobs, digest)
+		removed++
+	}
+	return removed, nil
+}
+
+func (store *ContentImageStore) collectPeriodically() {
+	defer store.wg.Done()
+
+	ticker := time.NewTicker(store.config.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-store.done:
+			return
+		case <-ticker.C:
+			removed, err := store.CollectGarbage()
+			if err != nil {
+				log.Printf("cannot collect image blobs: %v", err)
+			}
+			if removed > 0 {
+				log.Printf("removed %d unreferenced image blobs", removed)
+			}
+		}
+	}
+}
+
+// Close stops the periodic garbage collection
+func (store *ContentImageStore) Close() error {
+	close(store.done)
+	store.wg.Wait()
+	return nil
+}
@@ -0,0 +1,164 @@
+package service_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"pcbook/service"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countFiles returns the number of files in a folder and its subfolders
+func countFiles(t *testing.T, folder string) int {
+	count := 0
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			count++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return count
+}
+
+func TestContentImageStore(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store, err := service.NewContentImageStore(service.ContentImageStoreConfig{Folder: folder})
+	require.NoError(t, err)
+	defer store.Close()
+
+	data := newTestImage(t, "png", 200, 100)
+	digest := sha256.Sum256(data)
+
+	image1, err := store.Save("laptop1", ".png", bytes.NewReader(data), "admin1")
+	require.NoError(t, err)
+	image2, err := store.Save("laptop2", ".png", bytes.NewReader(data), "admin2")
+	require.NoError(t, err)
+	require.NotEqual(t, image1, image2)
+	other, err := store.Save("laptop2", ".png", bytes.NewReader(newTestImage(t, "png", 20, 10)), "admin2")
+	require.NoError(t, err)
+
+	// a blob and its two variants for each distinct data
+	require.Equal(t, 6, countFiles(t, folder))
+
+	info1, err := store.Find(image1)
+	require.NoError(t, err)
+	info2, err := store.Find(image2)
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(digest[:]), info1.Digest)
+	require.Equal(t, info1.Digest, info2.Digest)
+	require.Equal(t, info1.Path, info2.Path)
+	require.Equal(t, "laptop2", info2.LaptopID)
+	require.True(t, info2.Primary)
+	require.Equal(t, 200, info2.Width)
+	require.Len(t, info2.Variants, 2)
+
+	images, err := store.List("laptop2")
+	require.NoError(t, err)
+	require.Len(t, images, 2)
+
+	// the blob is kept while an image refers to it
+	require.NoError(t, store.Delete(image1))
+	removed, err := store.CollectGarbage()
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	_, file, err := store.Open(image2, "")
+	require.NoError(t, err)
+	saved, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.Equal(t, data, saved)
+
+	require.NoError(t, store.DeleteByLaptop("laptop2"))
+	_, err = store.Find(other)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.ErrorIs(t, store.Delete(image2), service.ErrNotFound)
+
+	// an unreferenced blob is reused until it is collected
+	image3, err := store.Save("laptop3", ".png", bytes.NewReader(data), "admin1")
+	require.NoError(t, err)
+	require.Equal(t, 6, countFiles(t, folder))
+
+	removed, err = store.CollectGarbage()
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Equal(t, 3, countFiles(t, folder))
+
+	require.NoError(t, store.Delete(image3))
+	removed, err = store.CollectGarbage()
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Zero(t, countFiles(t, folder))
+}
+
+func TestContentImageStoreSweep(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store, err := service.NewContentImageStore(service.ContentImageStoreConfig{Folder: folder})
+	require.NoError(t, err)
+	_, err = store.Save("laptop1", ".png", bytes.NewReader(newTestImage(t, "png", 200, 100)), "admin1")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// a crash may leave a temporary file and a blob whose image is not in the catalog
+	require.NoError(t, os.WriteFile(filepath.Join(folder, "123.tmp"), []byte("data"), 0644))
+	other := filepath.Join(folder, "notes.txt")
+	require.NoError(t, os.WriteFile(other, []byte("notes"), 0644))
+	require.Equal(t, 5, countFiles(t, folder))
+
+	// the catalog of the new store is empty, so none of the blobs is referenced
+	store, err = service.NewContentImageStore(service.ContentImageStoreConfig{Folder: folder})
+	require.NoError(t, err)
+	defer store.Close()
+	require.Equal(t, 1, countFiles(t, folder))
+	require.FileExists(t, other)
+}
+
+func TestContentImageStoreConcurrentSave(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store, err := service.NewContentImageStore(service.ContentImageStoreConfig{Folder: folder})
+	require.NoError(t, err)
+	defer store.Close()
+
+	data := newTestImage(t, "jpeg", 300, 200)
+
+	n := 8
+	imageIDs := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			imageIDs[i], errs[i] = store.Save("laptop1", ".jpg", bytes.NewReader(data), "admin1")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, countFiles(t, folder))
+
+	images, err := store.List("laptop1")
+	require.NoError(t, err)
+	require.Len(t, images, n)
+
+	require.NoError(t, store.DeleteByLaptop("laptop1"))
+	removed, err := store.CollectGarbage()
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Zero(t, countFiles(t, folder))
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"pcbook/expr"
+	"pcbook/pb"
+	"time"
+)
+
+// SearchScan is Search without the secondary indexes, to check and benchmark them against
+func (store *InMemoryLaptopStore) SearchScan(ctx context.Context, filter *pb.Filter, program *expr.Program, found func(laptop *pb.Laptop) error) error {
+	return store.view().each(func(laptop *pb.Laptop) error {
+		return matchLaptop(ctx, laptop, filter, program, found)
+	})
+}
+
+// SignS3Request signs a request like the S3 image store, to check it against the AWS examples
+var SignS3Request = signS3Request
+
+// SummarizeRatings summarizes the ratings like the laptop server at the time, to check the summaries without waiting
+func SummarizeRatings(config RatingConfig, rating *Rating, ratings []*UserRating, now time.Time) *RatingSummary {
+	return config.withDefaults().summarize(rating, ratings, now)
+}
+
+// BreakLog closes the write-ahead log under the store, so that the next record can not be written
+func (store *FileLaptopStore) BreakLog() error {
+	return store.wal.Close()
+}
+
+// MigrateSQLDatabaseTo applies the schema versions up to the version, to check the later ones on an older schema
+func MigrateSQLDatabaseTo(db *sql.DB, version int) error {
+	return migrateSQLDatabase(db, sqlMigrations[:version])
+}
+
+// LaptopOrderFields returns the supported order_by fields, to check the documentation of the requests against them
+func LaptopOrderFields() (laptopFields []string, ratingFields []string) {
+	for field := range laptopOrderKeys {
+		laptopFields = append(laptopFields, field)
+	}
+	for field := range ratingOrderKeys {
+		ratingFields = append(ratingFields, field)
+	}
+	return laptopFields, ratingFields
+}
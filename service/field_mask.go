@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// readonlyLaptopFields are managed by the server and can not be updated by a field mask
+var readonlyLaptopFields = map[string]bool{
+	"id":         true,
+	"updated_at": true,
+}
+
+// validateFieldMask checks that every path refers to a field of the message
+func validateFieldMask(message proto.Message, paths []string) error {
+	for _, path := range paths {
+		if readonlyLaptopFields[path] {
+			return fmt.Errorf("field %s is read-only", path)
+		}
+		_, err := resolveFieldPath(message.ProtoReflect().Descriptor(), path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFieldMask copies the fields listed in paths from src to dst,
+// an empty paths means every writable top-level field
+func applyFieldMask(dst, src proto.Message, paths []string) error {
+	if len(paths) == 0 {
+		fields := src.ProtoReflect().Descriptor().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			name := string(fields.Get(i).Name())
+			if !readonlyLaptopFields[name] {
+				paths = append(paths, name)
+			}
+		}
+	}
+
+	err := validateFieldMask(dst, paths)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		copyFieldPath(dst.ProtoReflect(), src.ProtoReflect(), strings.Split(path, "."))
+	}
+	return nil
+}
+
+func resolveFieldPath(desc protoreflect.MessageDescriptor, path string) (protoreflect.FieldDescriptor, error) {
+	var field protoreflect.FieldDescriptor
+	for i, name := range strings.Split(path, ".") {
+		if i > 0 {
+			if field.Kind() != protoreflect.MessageKind || field.IsList() || field.IsMap() {
+				return nil, fmt.Errorf("invalid field path %q", path)
+			}
+			desc = field.Message()
+		}
+		field = desc.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			return nil, fmt.Errorf("unknown field %q in path %q", name, path)
+		}
+	}
+	return field, nil
+}
+
+func copyFieldPath(dst, src protoreflect.Message, names []string) {
+	field := dst.Descriptor().Fields().ByName(protoreflect.Name(names[0]))
+	if len(names) > 1 {
+		if !src.Has(field) && !dst.Has(field) {
+			return
+		}
+		copyFieldPath(dst.Mutable(field).Message(), src.Get(field).Message(), names[1:])
+		return
+	}
+
+	if !src.Has(field) {
+		dst.Clear(field)
+		return
+	}
+	dst.Set(field, src.Get(field))
+}
@@ -0,0 +1,517 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"pcbook/pb"
+	"pcbook/serializer"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	walFileName      = "laptops.wal"
+	snapshotFileName = "laptops.snapshot"
+	// walHeaderSize is the size of the length and the checksum before each record
+	walHeaderSize = 8
+	// maxWALRecordSize protects the recovery from allocating a huge buffer for a corrupt length
+	maxWALRecordSize = 64 << 20
+)
+
+var ErrCorruptLog = errors.New("write-ahead log is corrupt")
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SyncPolicy tells when the write-ahead log is flushed to disk
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes every record before the write returns
+	SyncAlways SyncPolicy = iota
+	// SyncInterval flushes the records periodically, a crash loses at most one interval of writes
+	SyncInterval
+	// SyncNever leaves flushing to the operating system
+	SyncNever
+)
+
+func ParseSyncPolicy(text string) (SyncPolicy, error) {
+	switch text {
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	case "never":
+		return SyncNever, nil
+	default:
+		return 0, fmt.Errorf("unknown sync policy %q, must be always, interval or never", text)
+	}
+}
+
+type FileLaptopStoreConfig struct {
+	Dir          string
+	SyncPolicy   SyncPolicy
+	SyncInterval time.Duration
+	// SnapshotEvery is the number of records after which the log is compacted into a snapshot,
+	// zero disables the automatic compaction
+	SnapshotEvery int
+}
+
+// FileLaptopStore is an InMemoryLaptopStore which logs every mutation to a write-ahead log
+// and compacts the log into snapshots, reads are served from memory
+type FileLaptopStore struct {
+	*InMemoryLaptopStore
+
+	config FileLaptopStoreConfig
+	// writeMutex serializes the mutations so that the log has the order of the memory
+	writeMutex sync.Mutex
+	wal        *os.File
+	sequence   uint64
+	records    int
+	// err is set when a record can not be written, the store refuses every later mutation
+	err  error
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFileLaptopStore loads the latest snapshot and replays the log found in the config directory,
+// the SyncInterval policy needs a positive SyncInterval
+func NewFileLaptopStore(config FileLaptopStoreConfig) (*FileLaptopStore, error) {
+	if config.SyncPolicy == SyncInterval && config.SyncInterval <= 0 {
+		return nil, fmt.Errorf("sync interval must be positive, got %v", config.SyncInterval)
+	}
+
+	err := os.MkdirAll(config.Dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create store directory: %w", err)
+	}
+
+	store := &FileLaptopStore{
+		InMemoryLaptopStore: NewInMemoryLaptopStore(),
+		config:              config,
+		done:                make(chan struct{}),
+	}
+
+	err = store.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.replay()
+	if err != nil {
+		return nil, err
+	}
+	// the mutations are logged before they are visible, a failed write leaves the memory unchanged
+	store.journal = store.append
+
+	if config.SyncPolicy == SyncInterval {
+		store.wg.Add(1)
+		go store.syncPeriodically()
+	}
+	return store, nil
+}
+
+func (store *FileLaptopStore) loadSnapshot() error {
+	filename := filepath.Join(store.config.Dir, snapshotFileName)
+	if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	snapshot := &pb.LaptopSnapshot{}
+	err := serializer.ReadProtobufFromBinaryFile(filename, snapshot)
+	if err != nil {
+		return fmt.Errorf("cannot load snapshot: %w", err)
+	}
+
+	store.restore(snapshot.GetLaptops()...)
+	for _, tombstone := range snapshot.GetTombstones() {
+		store.restoreTombstone(fromTombstoneProto(tombstone))
+	}
+	store.sequence = snapshot.GetSequence()
+	return nil
+}
+
+// replay applies the records after the snapshot and truncates a torn final record
+func (store *FileLaptopStore) replay() error {
+	file, err := os.OpenFile(filepath.Join(store.config.Dir, walFileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open write-ahead log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot stat write-ahead log: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		mutation, size, err := readWALRecord(reader, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Printf("truncate torn record at offset %d of the write-ahead log", offset)
+			err = file.Truncate(offset)
+			if err != nil {
+				file.Close()
+				return fmt.Errorf("cannot truncate write-ahead log: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+
+		offset += size
+		store.records++
+		if mutation.GetSequence() > store.sequence {
+			store.apply(mutation)
+			store.sequence = mutation.GetSequence()
+		}
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot seek write-ahead log: %w", err)
+	}
+	store.wal = file
+	return nil
+}
+
+// readWALRecord reads a record framed as [length][crc32][payload],
+// io.ErrUnexpectedEOF means the record is cut by the end of the file
+func readWALRecord(reader io.Reader, remaining int64) (*pb.LaptopMutation, int64, error) {
+	header := make([]byte, walHeaderSize)
+	n, err := io.ReadFull(reader, header)
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("header of %d bytes: %w", n, io.ErrUnexpectedEOF)
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[0:4]))
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if length > maxWALRecordSize {
+		return nil, 0, fmt.Errorf("record of %d bytes: %w", length, ErrCorruptLog)
+	}
+	if walHeaderSize+length > remaining {
+		// the rest of the file is shorter than the record and smaller than maxWALRecordSize,
+		// it is a write which has not completed unless a corrupt length hides later records
+		rest, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot read the rest of the log: %w", err)
+		}
+		if containsWALRecord(rest) {
+			return nil, 0, fmt.Errorf("record of %d bytes is followed by valid records: %w", length, ErrCorruptLog)
+		}
+		return nil, 0, fmt.Errorf("record of %d bytes: %w", length, io.ErrUnexpectedEOF)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return nil, 0, fmt.Errorf("payload: %w", io.ErrUnexpectedEOF)
+	}
+
+	if crc32.Checksum(payload, walTable) != checksum {
+		if walHeaderSize+length == remaining {
+			// the last record is torn if the size was written before the payload
+			return nil, 0, fmt.Errorf("checksum mismatch of the last record: %w", io.ErrUnexpectedEOF)
+		}
+		return nil, 0, fmt.Errorf("checksum mismatch: %w", ErrCorruptLog)
+	}
+
+	mutation := &pb.LaptopMutation{}
+	err = proto.Unmarshal(payload, mutation)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot unmarshal record: %v: %w", err, ErrCorruptLog)
+	}
+	return mutation, walHeaderSize + length, nil
+}
+
+// containsWALRecord tells if a complete record with a valid checksum starts anywhere in the data
+func containsWALRecord(data []byte) bool {
+	for start := 0; start+walHeaderSize < len(data); start++ {
+		// a record is never empty, and zeroed bytes would pass the checksum of an empty payload
+		length := int64(binary.LittleEndian.Uint32(data[start : start+4]))
+		if length == 0 || length > int64(len(data)-start-walHeaderSize) {
+			continue
+		}
+		payload := data[start+walHeaderSize : start+walHeaderSize+int(length)]
+		if crc32.Checksum(payload, walTable) != binary.LittleEndian.Uint32(data[start+4:start+8]) {
+			continue
+		}
+		if proto.Unmarshal(payload, &pb.LaptopMutation{}) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// apply replays a mutation on the memory without recording events
+func (store *FileLaptopStore) apply(mutation *pb.LaptopMutation) {
+	switch m := mutation.GetMutation().(type) {
+	case *pb.LaptopMutation_Save:
+		store.restore(m.Save.GetLaptops()...)
+	case *pb.LaptopMutation_Update:
+		store.restore(m.Update)
+	case *pb.LaptopMutation_Delete:
+		store.restoreTombstone(fromTombstoneProto(m.Delete))
+	case *pb.LaptopMutation_PurgeBefore:
+		store.InMemoryLaptopStore.PurgeDeleted(m.PurgeBefore.AsTime())
+	}
+}
+
+// append writes the mutation to the log, the caller must hold the write mutex.
+// It is the journal of the memory, so it runs before the mutation is published
+func (store *FileLaptopStore) append(mutation *pb.LaptopMutation) error {
+	mutation.Sequence = store.sequence + 1
+	payload, err := proto.Marshal(mutation)
+	if err != nil {
+		store.err = fmt.Errorf("cannot marshal record: %w", err)
+		return store.err
+	}
+
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, walTable))
+	copy(record[walHeaderSize:], payload)
+
+	_, err = store.wal.Write(record)
+	if err == nil && store.config.SyncPolicy == SyncAlways {
+		err = store.wal.Sync()
+	}
+	if err != nil {
+		store.err = fmt.Errorf("cannot write record: %w", err)
+		return store.err
+	}
+
+	store.sequence = mutation.Sequence
+	store.records++
+	return nil
+}
+
+// compactIfDue compacts the log once it has enough records, the caller must hold the write mutex
+func (store *FileLaptopStore) compactIfDue() {
+	if store.config.SnapshotEvery > 0 && store.records >= store.config.SnapshotEvery {
+		err := store.compact()
+		if err != nil {
+			// the log still has every record
+			log.Printf("cannot compact write-ahead log: %v", err)
+		}
+	}
+}
+
+// lockWrite acquires the write mutex unless the store has failed
+func (store *FileLaptopStore) lockWrite() error {
+	store.writeMutex.Lock()
+	if store.err != nil {
+		store.writeMutex.Unlock()
+		return store.err
+	}
+	return nil
+}
+
+func (store *FileLaptopStore) Save(laptop *pb.Laptop) error {
+	if err := store.lockWrite(); err != nil {
+		return err
+	}
+	defer store.writeMutex.Unlock()
+
+	err := store.InMemoryLaptopStore.Save(laptop)
+	if err != nil {
+		return err
+	}
+	store.compactIfDue()
+	return nil
+}
+
+func (store *FileLaptopStore) SaveAll(laptops []*pb.Laptop) (int, error) {
+	if err := store.lockWrite(); err != nil {
+		return 0, err
+	}
+	defer store.writeMutex.Unlock()
+
+	i, err := store.InMemoryLaptopStore.SaveAll(laptops)
+	if err != nil {
+		return i, err
+	}
+	store.compactIfDue()
+	return 0, nil
+}
+
+func (store *FileLaptopStore) Update(laptop *pb.Laptop, paths []string) (*pb.Laptop, error) {
+	if err := store.lockWrite(); err != nil {
+		return nil, err
+	}
+	defer store.writeMutex.Unlock()
+
+	updated, err := store.InMemoryLaptopStore.Update(laptop, paths)
+	if err != nil {
+		return nil, err
+	}
+	store.compactIfDue()
+	return updated, nil
+}
+
+func (store *FileLaptopStore) Delete(id string, deletedBy string) error {
+	if err := store.lockWrite(); err != nil {
+		return err
+	}
+	defer store.writeMutex.Unlock()
+
+	err := store.InMemoryLaptopStore.Delete(id, deletedBy)
+	if err != nil {
+		return err
+	}
+	store.compactIfDue()
+	return nil
+}
+
+func (store *FileLaptopStore) PurgeDeleted(before time.Time) (int, error) {
+	if err := store.lockWrite(); err != nil {
+		return 0, err
+	}
+	defer store.writeMutex.Unlock()
+
+	purged, err := store.InMemoryLaptopStore.PurgeDeleted(before)
+	if err != nil {
+		return 0, err
+	}
+	store.compactIfDue()
+	return purged, nil
+}
+
+// Compact writes a snapshot of the store and empties the log
+func (store *FileLaptopStore) Compact() error {
+	if err := store.lockWrite(); err != nil {
+		return err
+	}
+	defer store.writeMutex.Unlock()
+
+	return store.compact()
+}
+
+func (store *FileLaptopStore) compact() error {
+	laptops, tombstones := store.snapshot()
+	snapshot := &pb.LaptopSnapshot{
+		Sequence:   store.sequence,
+		Laptops:    laptops,
+		Tombstones: make([]*pb.LaptopTombstone, len(tombstones)),
+	}
+	for i, tombstone := range tombstones {
+		snapshot.Tombstones[i] = toTombstoneProto(tombstone)
+	}
+
+	// the snapshot replaces the previous one only once it is complete on disk
+	filename := filepath.Join(store.config.Dir, snapshotFileName)
+	err := serializer.WriteProtobufToBinaryFile(snapshot, filename+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot write snapshot: %w", err)
+	}
+	err = syncFile(filename + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = os.Rename(filename+".tmp", filename)
+	if err != nil {
+		return fmt.Errorf("cannot rename snapshot: %w", err)
+	}
+	err = syncFile(store.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	// the records are skipped by their sequence if the log is not truncated
+	err = store.wal.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("cannot truncate write-ahead log: %w", err)
+	}
+	_, err = store.wal.Seek(0, io.SeekStart)
+	if err != nil {
+		store.err = fmt.Errorf("cannot seek write-ahead log: %w", err)
+		return store.err
+	}
+	store.records = 0
+	return nil
+}
+
+func syncFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("cannot open %s: %w", name, err)
+	}
+	defer file.Close()
+
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("cannot sync %s: %w", name, err)
+	}
+	return nil
+}
+
+func (store *FileLaptopStore) syncPeriodically() {
+	defer store.wg.Done()
+
+	ticker := time.NewTicker(store.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-store.done:
+			return
+		case <-ticker.C:
+			store.writeMutex.Lock()
+			err := store.wal.Sync()
+			store.writeMutex.Unlock()
+			if err != nil {
+				log.Printf("cannot sync write-ahead log: %v", err)
+			}
+		}
+	}
+}
+
+// Close flushes and closes the log, the store can not be written afterwards
+func (store *FileLaptopStore) Close() error {
+	close(store.done)
+	store.wg.Wait()
+
+	store.writeMutex.Lock()
+	defer store.writeMutex.Unlock()
+
+	err := store.wal.Sync()
+	if err != nil {
+		return fmt.Errorf("cannot sync write-ahead log: %w", err)
+	}
+	store.err = errors.New("store is closed")
+	return store.wal.Close()
+}
+
+func toTombstoneProto(tombstone *Tombstone) *pb.LaptopTombstone {
+	return &pb.LaptopTombstone{
+		Laptop:    tombstone.Laptop,
+		DeletedAt: timestamppb.New(tombstone.DeletedAt),
+		DeletedBy: tombstone.DeletedBy,
+	}
+}
+
+func fromTombstoneProto(tombstone *pb.LaptopTombstone) *Tombstone {
+	return &Tombstone{
+		Laptop:    tombstone.GetLaptop(),
+		DeletedAt: tombstone.GetDeletedAt().AsTime(),
+		DeletedBy: tombstone.GetDeletedBy(),
+	}
+}
@@ -0,0 +1,217 @@
+package service_test
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func openTestFileLaptopStore(t *testing.T, dir string, snapshotEvery int) *service.FileLaptopStore {
+	store, err := service.NewFileLaptopStore(service.FileLaptopStoreConfig{
+		Dir:           dir,
+		SyncPolicy:    service.SyncAlways,
+		SnapshotEvery: snapshotEvery,
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func TestFileLaptopStoreRecovery(t *testing.T) {
+	t.Parallel()
+
+	for _, snapshotEvery := range []int{0, 2} {
+		dir := t.TempDir()
+		store := openTestFileLaptopStore(t, dir, snapshotEvery)
+
+		laptop1 := sample.NewLaptop()
+		laptop2 := sample.NewLaptop()
+		laptop3 := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop1))
+		_, err := store.SaveAll([]*pb.Laptop{laptop2, laptop3})
+		require.NoError(t, err)
+
+		laptop1.PriceUsd = 1234
+		updated, err := store.Update(laptop1, []string{"price_usd"})
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(laptop2.Id, "admin1"))
+		require.NoError(t, store.Delete(laptop3.Id, "admin1"))
+		purged, err := store.PurgeDeleted(time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, 2, purged)
+
+		laptop4 := sample.NewLaptop()
+		require.NoError(t, store.Save(laptop4))
+		require.NoError(t, store.Delete(laptop4.Id, "admin1"))
+		require.NoError(t, store.Close())
+		if snapshotEvery > 0 {
+			require.FileExists(t, filepath.Join(dir, "laptops.snapshot"))
+		}
+
+		store = openTestFileLaptopStore(t, dir, snapshotEvery)
+		found, err := store.Find(laptop1.Id)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(updated, found))
+
+		for _, laptop := range []*pb.Laptop{laptop2, laptop3, laptop4} {
+			_, err = store.Find(laptop.Id)
+			require.ErrorIs(t, err, service.ErrNotFound)
+		}
+		// the tombstone is recovered
+		require.ErrorIs(t, store.Save(laptop4), service.ErrAlreadyExists)
+		require.NoError(t, store.Save(laptop2))
+		require.NoError(t, store.Close())
+	}
+}
+
+func TestFileLaptopStoreTornRecord(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := openTestFileLaptopStore(t, dir, 0)
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+	require.NoError(t, store.Close())
+
+	walFile := filepath.Join(dir, "laptops.wal")
+	info, err := os.Stat(walFile)
+	require.NoError(t, err)
+
+	// a record of 100 bytes cut after 10 bytes
+	file, err := os.OpenFile(walFile, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{100, 0, 0, 0, 1, 2, 3, 4, 5, 6})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	store = openTestFileLaptopStore(t, dir, 0)
+	_, err = store.Find(laptop.Id)
+	require.NoError(t, err)
+
+	truncated, err := os.Stat(walFile)
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), truncated.Size())
+
+	other := sample.NewLaptop()
+	require.NoError(t, store.Save(other))
+	require.NoError(t, store.Close())
+
+	store = openTestFileLaptopStore(t, dir, 0)
+	_, err = store.Find(other.Id)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+}
+
+func TestFileLaptopStoreCorruptRecord(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := openTestFileLaptopStore(t, dir, 0)
+	require.NoError(t, store.Save(sample.NewLaptop()))
+	require.NoError(t, store.Save(sample.NewLaptop()))
+	require.NoError(t, store.Close())
+
+	// flip a byte of the first payload
+	walFile := filepath.Join(dir, "laptops.wal")
+	data, err := os.ReadFile(walFile)
+	require.NoError(t, err)
+	data[10] ^= 0xff
+	require.NoError(t, os.WriteFile(walFile, data, 0644))
+
+	_, err = service.NewFileLaptopStore(service.FileLaptopStoreConfig{Dir: dir})
+	require.ErrorIs(t, err, service.ErrCorruptLog)
+}
+
+func TestFileLaptopStoreCorruptLength(t *testing.T) {
+	t.Parallel()
+
+	for _, length := range []uint32{1 << 20, 1 << 30} {
+		dir := t.TempDir()
+		store := openTestFileLaptopStore(t, dir, 0)
+		require.NoError(t, store.Save(sample.NewLaptop()))
+		require.NoError(t, store.Save(sample.NewLaptop()))
+		require.NoError(t, store.Close())
+
+		// a length past the end of the file in the first record must not truncate the second one
+		walFile := filepath.Join(dir, "laptops.wal")
+		data, err := os.ReadFile(walFile)
+		require.NoError(t, err)
+		binary.LittleEndian.PutUint32(data[0:4], length)
+		require.NoError(t, os.WriteFile(walFile, data, 0644))
+
+		_, err = service.NewFileLaptopStore(service.FileLaptopStoreConfig{Dir: dir})
+		require.ErrorIs(t, err, service.ErrCorruptLog)
+
+		info, err := os.Stat(walFile)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), info.Size())
+	}
+}
+
+func TestFileLaptopStoreFailedWrite(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := openTestFileLaptopStore(t, dir, 0)
+	saved := sample.NewLaptop()
+	require.NoError(t, store.Save(sample.NewLaptop()))
+	require.NoError(t, store.Save(saved))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan *service.LaptopEvent, 10)
+	go store.Watch(ctx, 1, nil, func(event *service.LaptopEvent) error {
+		events <- event
+		return nil
+	})
+	require.Equal(t, saved.Id, (<-events).Laptop.Id)
+
+	// a mutation which can not be logged is neither visible nor published
+	require.NoError(t, store.BreakLog())
+	laptop := sample.NewLaptop()
+	require.Error(t, store.Save(laptop))
+	_, err := store.Find(laptop.Id)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	// the store refuses the later mutations
+	require.Error(t, store.Delete(saved.Id, "admin1"))
+	_, err = store.Find(saved.Id)
+	require.NoError(t, err)
+
+	select {
+	case event := <-events:
+		require.Failf(t, "unexpected event", "%v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFileLaptopStoreSyncInterval(t *testing.T) {
+	t.Parallel()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		_, err := service.NewFileLaptopStore(service.FileLaptopStoreConfig{
+			Dir:          t.TempDir(),
+			SyncPolicy:   service.SyncInterval,
+			SyncInterval: interval,
+		})
+		require.Error(t, err)
+	}
+
+	store, err := service.NewFileLaptopStore(service.FileLaptopStoreConfig{
+		Dir:          t.TempDir(),
+		SyncPolicy:   service.SyncInterval,
+		SyncInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Save(sample.NewLaptop()))
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"pcbook/pb"
+	"pcbook/serializer"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// imageCacheControl lets the clients keep an image for a year, the data of an image ID never changes
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// ImageHTTPHandler serves and receives the laptop images over plain HTTP next to the REST gateway,
+// which can neither send an image with its content type nor receive a multipart upload
+type ImageHTTPHandler struct {
+	laptopStore LaptopStore
+	imageStore  ImageStore
+}
+
+func NewImageHTTPHandler(laptopStore LaptopStore, imageStore ImageStore) *ImageHTTPHandler {
+	return &ImageHTTPHandler{laptopStore: laptopStore, imageStore: imageStore}
+}
+
+// Register adds the handlers to the gateway mux, they check the roles of DownloadImage and UploadImage
+func (handler *ImageHTTPHandler) Register(mux *runtime.ServeMux, interceptor *AuthInterceptor) error {
+	const laptopServicePath = "/my.pcbook.LaptopService/"
+	serveImage := interceptor.HTTP(laptopServicePath+"DownloadImage", handler.ServeImage)
+	uploadImage := interceptor.HTTP(laptopServicePath+"UploadImage", handler.UploadImage)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		err := mux.HandlePath(method, "/v1/laptop/{laptop_id}/images/{image_id}", serveImage)
+		if err != nil {
+			return fmt.Errorf("cannot register image handler: %w", err)
+		}
+	}
+	err := mux.HandlePath(http.MethodPost, "/v1/laptop/{laptop_id}/images", uploadImage)
+	if err != nil {
+		return fmt.Errorf("cannot register image upload handler: %w", err)
+	}
+	return nil
+}
+
+// ServeImage sends the data of an image, or of one of its variants with the size query parameter.
+// The ETag is derived from the digest of the image, so conditional and range requests are supported
+func (handler *ImageHTTPHandler) ServeImage(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	laptopID, imageID := pathParams["laptop_id"], pathParams["image_id"]
+
+	size := pb.Image_ORIGINAL
+	if value := r.URL.Query().Get("size"); value != "" {
+		v, ok := pb.Image_Variant_value[strings.ToUpper(value)]
+		if !ok {
+			http.Error(w, fmt.Sprintf("image size %s is not supported", value), http.StatusBadRequest)
+			return
+		}
+		size = pb.Image_Variant(v)
+	}
+	variant := imageVariantNames[size]
+
+	// the info is enough to answer a revalidation, the data of a remote store is not fetched for it
+	image, err := handler.imageStore.Find(imageID)
+	if err == nil && image.LaptopID != laptopID {
+		err = fmt.Errorf("image with id %s of laptop %s: %w", imageID, laptopID, ErrNotFound)
+	}
+	if err == nil {
+		_, err = imageVariantPath(image, variant)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "image is not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "cannot find image", http.StatusInternalServerError)
+		return
+	}
+
+	contentType, etag, length := image.ContentType, image.Digest, image.Size
+	for _, v := range image.Variants {
+		if v.Name == variant {
+			contentType, etag, length = v.ContentType, etag+"-"+v.Name, v.Size
+		}
+	}
+
+	w.Header().Set("Cache-Control", imageCacheControl)
+	if image.Digest != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+		if etagMatch(r.Header.Get("If-None-Match"), `"`+etag+`"`) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	image, data, err := handler.imageStore.Open(imageID, variant)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "image is not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "cannot open image", http.StatusInternalServerError)
+		return
+	}
+	defer data.Close()
+
+	// only a range request needs to seek, then the data of a remote store is read in memory
+	content, ok := data.(io.ReadSeeker)
+	if !ok && r.Header.Get("Range") != "" {
+		buffer, err := io.ReadAll(data)
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "cannot read image data", http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(buffer)
+	} else if !ok {
+		content = &streamSeeker{reader: data, size: length}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", image.UploadedAt, content)
+}
+
+// etagMatch tells if an If-None-Match header lists the quoted etag, with the weak comparison of RFC 9110
+func etagMatch(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// streamSeeker streams data of a known size to http.ServeContent, which only seeks to find the size
+// before it reads. Any other seek fails
+type streamSeeker struct {
+	reader   io.Reader
+	size     int64
+	offset   int64
+	consumed int64
+}
+
+func (seeker *streamSeeker) Read(p []byte) (int, error) {
+	if seeker.offset != seeker.consumed {
+		return 0, fmt.Errorf("cannot read at offset %d of a stream at %d", seeker.offset, seeker.consumed)
+	}
+	n, err := seeker.reader.Read(p)
+	seeker.consumed += int64(n)
+	seeker.offset = seeker.consumed
+	return n, err
+}
+
+func (seeker *streamSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += seeker.offset
+	case io.SeekEnd:
+		offset += seeker.size
+	}
+	if offset < 0 || (seeker.consumed > 0 && offset != seeker.consumed) {
+		return 0, fmt.Errorf("cannot seek to %d of a stream", offset)
+	}
+	seeker.offset = offset
+	return offset, nil
+}
+
+// UploadImage saves the file of the image field of a multipart/form-data request,
+// the image type is the extension of its file name. It responds with the image info
+func (handler *ImageHTTPHandler) UploadImage(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+	laptopID := pathParams["laptop_id"]
+
+	_, err := handler.laptopStore.Find(laptopID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "laptop is not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "cannot find laptop", http.StatusInternalServerError)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "request is not a multipart/form-data upload", http.StatusBadRequest)
+		return
+	}
+	part, err := imagePart(reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer part.Close()
+
+	imageType := filepath.Ext(part.FileName())
+	if imageType == "" {
+		http.Error(w, "image file name has no extension", http.StatusBadRequest)
+		return
+	}
+
+	uploadedBy := ""
+	if claims, ok := UserClaimsFromContext(r.Context()); ok {
+		uploadedBy = claims.Username
+	}
+
+	imageID, err := handler.imageStore.Save(laptopID, imageType, part, uploadedBy)
+	switch {
+	case errors.Is(err, ErrImageTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, ErrInvalidImage):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Print(err)
+		http.Error(w, "cannot save image to store", http.StatusInternalServerError)
+		return
+	}
+
+	image, err := handler.imageStore.Find(imageID)
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "cannot find image", http.StatusInternalServerError)
+		return
+	}
+	res, err := serializer.ProtobufToJSON(toImageProto(image))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "cannot encode image", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("saved image with id: %s, size: %d", imageID, image.Size)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/v1/laptop/%s/images/%s", laptopID, imageID))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(res)
+}
+
+// imagePart skips the parts of a multipart body until the image field
+func imagePart(reader *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("image field is missing")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read multipart body: %w", err)
+		}
+		if part.FormName() == "image" && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
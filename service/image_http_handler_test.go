@@ -0,0 +1,260 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func newTestToken(t *testing.T, jwtManager *service.JWTMaganer, username string, role string) string {
+	user, err := service.NewUser(username, "secret", role)
+	require.NoError(t, err)
+	token, err := jwtManager.Generate(user)
+	require.NoError(t, err)
+	return token
+}
+
+// multipartImage returns a multipart/form-data body with a field and the image file
+func multipartImage(t *testing.T, fileName string, data []byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("description", "front"))
+	part, err := writer.CreateFormFile("image", fileName)
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return &body, writer.FormDataContentType()
+}
+
+func TestImageHTTPHandler(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStoreWithConfig(service.DiskImageStoreConfig{Folder: t.TempDir(), MaxImageSize: 64 << 10})
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	interceptor := service.NewAuthInterceptor(jwtManager, map[string][]string{
+		"/my.pcbook.LaptopService/UploadImage": {"admin"},
+	})
+
+	mux := runtime.NewServeMux()
+	require.NoError(t, service.NewImageHTTPHandler(laptopStore, imageStore).Register(mux, interceptor))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	data := newTestImage(t, "jpeg", 300, 200)
+	uploadURL := server.URL + "/v1/laptop/" + laptop.Id + "/images"
+
+	upload := func(token string, fileName string, data []byte) *http.Response {
+		body, contentType := multipartImage(t, fileName, data)
+		req, err := http.NewRequest(http.MethodPost, uploadURL, body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	adminToken := newTestToken(t, jwtManager, "admin1", "admin")
+	require.Equal(t, http.StatusUnauthorized, upload("", "front.jpg", data).StatusCode)
+	require.Equal(t, http.StatusUnauthorized, upload("invalid", "front.jpg", data).StatusCode)
+	require.Equal(t, http.StatusForbidden, upload(newTestToken(t, jwtManager, "user1", "user"), "front.jpg", data).StatusCode)
+	require.Equal(t, http.StatusBadRequest, upload(adminToken, "front.png", data).StatusCode)
+	require.Equal(t, http.StatusRequestEntityTooLarge, upload(adminToken, "large.png", newTestImage(t, "png", 200, 200)).StatusCode)
+
+	body, contentType := multipartImage(t, "front.jpg", data)
+	req, err := http.NewRequest(http.MethodPost, uploadURL, body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var image struct {
+		Id         string
+		UploadedBy string
+		Sha256     string
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&image))
+	res.Body.Close()
+	require.Equal(t, "admin1", image.UploadedBy)
+	imageURL := server.URL + "/v1/laptop/" + laptop.Id + "/images/" + image.Id
+	require.Equal(t, "/v1/laptop/"+laptop.Id+"/images/"+image.Id, res.Header.Get("Location"))
+
+	get := func(url string, header map[string]string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	res, got := get(imageURL, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, data, got)
+	require.Equal(t, "image/jpeg", res.Header.Get("Content-Type"))
+	require.Equal(t, `"`+image.Sha256+`"`, res.Header.Get("ETag"))
+	require.Contains(t, res.Header.Get("Cache-Control"), "max-age=")
+
+	res, got = get(imageURL, map[string]string{"If-None-Match": `"` + image.Sha256 + `"`})
+	require.Equal(t, http.StatusNotModified, res.StatusCode)
+	require.Empty(t, got)
+
+	res, got = get(imageURL, map[string]string{"Range": "bytes=10-19"})
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	require.Equal(t, data[10:20], got)
+	require.Equal(t, fmt.Sprintf("bytes 10-19/%d", len(data)), res.Header.Get("Content-Range"))
+
+	res, got = get(imageURL+"?size=thumbnail", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NotEqual(t, res.Header.Get("ETag"), `"`+image.Sha256+`"`)
+	thumbnail, err := jpeg.DecodeConfig(bytes.NewReader(got))
+	require.NoError(t, err)
+	require.Equal(t, 128, thumbnail.Width)
+
+	res, _ = get(imageURL+"?size=huge", nil)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = get(server.URL+"/v1/laptop/"+sample.NewLaptop().Id+"/images/"+image.Id, nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, _ = get(server.URL+"/v1/laptop/"+laptop.Id+"/images/unknown", nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestImageHTTPHandlerS3(t *testing.T) {
+	t.Parallel()
+
+	s3, endpoint := newFakeS3(t, "access1", "images")
+	imageStore := newTestS3ImageStore(t, endpoint)
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	interceptor := service.NewAuthInterceptor(jwtManager, map[string][]string{})
+
+	mux := runtime.NewServeMux()
+	require.NoError(t, service.NewImageHTTPHandler(service.NewInMemoryLaptopStore(), imageStore).Register(mux, interceptor))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	data := newTestImage(t, "png", 60, 40)
+	imageID, err := imageStore.Save("laptop1", ".png", bytes.NewReader(data), "admin1")
+	require.NoError(t, err)
+	imageURL := server.URL + "/v1/laptop/laptop1/images/" + imageID
+	key := "images/" + imageID + ".png"
+
+	do := func(method string, header map[string]string) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, imageURL, nil)
+		require.NoError(t, err)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	// the object is streamed with its length
+	res, got := do(http.MethodGet, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, data, got)
+	require.EqualValues(t, len(data), res.ContentLength)
+	require.Equal(t, 1, s3.getCount(key))
+	etag := res.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// a revalidation does not fetch the object
+	res, got = do(http.MethodGet, map[string]string{"If-None-Match": `"other", ` + etag})
+	require.Equal(t, http.StatusNotModified, res.StatusCode)
+	require.Empty(t, got)
+	require.Equal(t, etag, res.Header.Get("ETag"))
+	require.Equal(t, 1, s3.getCount(key))
+
+	res, got = do(http.MethodGet, map[string]string{"Range": "bytes=5-14"})
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	require.Equal(t, data[5:15], got)
+	require.Equal(t, 2, s3.getCount(key))
+
+	res, got = do(http.MethodHead, nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Empty(t, got)
+	require.EqualValues(t, len(data), res.ContentLength)
+}
+
+func TestRESTGatewayImages(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+	_, serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	interceptor := service.NewAuthInterceptor(jwtManager, map[string][]string{})
+	dialOptions := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	mux, err := service.NewRESTGateway(ctx, serverAddress, dialOptions, service.NewImageHTTPHandler(laptopStore, imageStore), interceptor)
+	require.NoError(t, err)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	laptop := sample.NewLaptop()
+	_, err = laptopClient.CreateLaptop(context.Background(), &pb.CreateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+
+	// the laptop is proxied to the gRPC server
+	res, err := http.Get(server.URL + "/v1/laptop/" + laptop.Id)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// an image uploaded over gRPC is downloaded over HTTP
+	data := newTestImage(t, "jpeg", 60, 40)
+	imageID := uploadTestImage(t, laptopClient, laptop.Id, ".jpg", data)
+	res, err = http.Get(server.URL + "/v1/laptop/" + laptop.Id + "/images/" + imageID)
+	require.NoError(t, err)
+	got, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, data, got)
+
+	// an image uploaded over HTTP is listed over gRPC
+	body, contentType := multipartImage(t, "back.jpg", data)
+	res, err = http.Post(server.URL+"/v1/laptop/"+laptop.Id+"/images", contentType, body)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	images, err := laptopClient.ListImages(context.Background(), &pb.ListImagesRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.Len(t, images.GetImages(), 2)
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultMaxImageDimension is the width and height limit of an image in pixels unless it is configured
+const DefaultMaxImageDimension = 4096
+
+// the variants of an image besides the original
+const (
+	ImageThumbnail = "thumbnail"
+	ImageMedium    = "medium"
+)
+
+var ErrInvalidImage = errors.New("invalid image")
+
+// imageVariantSizes are the boxes in pixels the variants are resized to fit in
+var imageVariantSizes = []struct {
+	name string
+	size int
+}{
+	{ImageThumbnail, 128},
+	{ImageMedium, 640},
+}
+
+// imageFormats are the formats of the supported image types
+var imageFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+	".webp": "webp",
+}
+
+// ImageVariant is a resized copy of an image, it is not changed once it is saved
+type ImageVariant struct {
+	Name        string
+	Type        string
+	ContentType string
+	Path        string
+	Size        int64
+	Width       int
+	Height      int
+}
+
+// sniffImageFormat returns the format of an image by the magic bytes of its header,
+// or "" if it is not a supported one
+func sniffImageFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("\xff\xd8\xff")):
+		return "jpeg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "gif"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return "webp"
+	}
+	return ""
+}
+
+// checkImage sniffs the format of the image data and decodes its dimensions from the header only,
+// so an image of a wrong type or too many pixels is refused before the rest is read.
+// It returns a reader of the whole data
+func checkImage(data io.Reader, imageType string, maxWidth int, maxHeight int) (io.Reader, image.Config, error) {
+	format, ok := imageFormats[strings.ToLower(imageType)]
+	if !ok {
+		return nil, image.Config{}, fmt.Errorf("image type %q is not supported: %w", imageType, ErrInvalidImage)
+	}
+
+	reader := bufio.NewReader(data)
+	header, err := reader.Peek(12)
+	if err != nil && err != io.EOF {
+		return nil, image.Config{}, fmt.Errorf("cannot read image header: %w", err)
+	}
+
+	sniffed := sniffImageFormat(header)
+	if sniffed == "" {
+		return nil, image.Config{}, fmt.Errorf("data is not a supported image: %w", ErrInvalidImage)
+	}
+	if sniffed != format {
+		return nil, image.Config{}, fmt.Errorf("image type %s does not match %s data: %w", imageType, sniffed, ErrInvalidImage)
+	}
+
+	var head bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(reader, &head))
+	if err != nil {
+		return nil, image.Config{}, fmt.Errorf("cannot decode image header: %v: %w", err, ErrInvalidImage)
+	}
+	if config.Width > maxWidth || config.Height > maxHeight {
+		return nil, image.Config{}, fmt.Errorf("image of %dx%d pixels is larger than %dx%d: %w",
+			config.Width, config.Height, maxWidth, maxHeight, ErrImageTooLarge)
+	}
+
+	return io.MultiReader(&head, reader), config, nil
+}
+
+// encodedImageVariant is a variant with its encoded data before it is saved
+type encodedImageVariant struct {
+	variant *ImageVariant
+	data    []byte
+}
+
+// makeImageVariants decodes an image and encodes each of its variants.
+// Only the pixels are encoded, so the metadata of the original like EXIF is dropped
+func makeImageVariants(data io.Reader) ([]*encodedImageVariant, error) {
+	img, format, err := image.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image: %v: %w", err, ErrInvalidImage)
+	}
+
+	variants := make([]*encodedImageVariant, 0, len(imageVariantSizes))
+	for _, variantSize := range imageVariantSizes {
+		resized := resizeImage(img, variantSize.size)
+
+		var buffer bytes.Buffer
+		imageType, err := encodeImage(&buffer, resized, format)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %s variant: %w", variantSize.name, err)
+		}
+
+		variant := &ImageVariant{
+			Name:        variantSize.name,
+			Type:        imageType,
+			ContentType: contentType(imageType),
+			Size:        int64(buffer.Len()),
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+		}
+		variants = append(variants, &encodedImageVariant{variant: variant, data: buffer.Bytes()})
+	}
+	return variants, nil
+}
+
+// resizeImage scales an image down to fit in a square of size pixels, keeping its aspect ratio.
+// A smaller image keeps its dimensions
+func resizeImage(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, height*size/width
+		} else {
+			width, height = width*size/height, size
+		}
+		if width == 0 {
+			width = 1
+		}
+		if height == 0 {
+			height = 1
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// encodeImage encodes a variant as JPEG if the original is one, otherwise as PNG to keep its transparency,
+// and returns the image type of the encoding
+func encodeImage(w io.Writer, img image.Image, format string) (string, error) {
+	if format == "jpeg" {
+		return ".jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return ".png", png.Encode(w, img)
+}
@@ -1,64 +1,445 @@
-package service
-
-import (
-	"bytes"
-	"fmt"
-	"os"
-	"sync"
-
-	"github.com/google/uuid"
-)
-
-type ImageStore interface {
-	Save(laptopID string, imageType string, imageData *bytes.Buffer) (string, error)
-}
-
-type DiskImageStore struct {
-	mutex       sync.Mutex
-	imageFolder string
-	images      map[string]*ImageInfo
-}
-
-type ImageInfo struct {
-	LaptopID string
-	Type     string
-	Path     string
-}
-
-func NewDiskImageStore(imageFolder string) *DiskImageStore {
-	return &DiskImageStore{
-		imageFolder: imageFolder,
-		images:      make(map[string]*ImageInfo),
-	}
-}
-
-func (store *DiskImageStore) Save(laptopID string, imageType string, imageData *bytes.Buffer) (string, error) {
-	imageID, err := uuid.NewUUID()
-	if err != nil {
-		return "", fmt.Errorf("cannot generate a new image ID: %w", err)
-	}
-
-	imagePath := fmt.Sprintf("%s/%s%s", store.imageFolder, imageID, imageType)
-
-	file, err := os.Create(imagePath)
-	if err != nil {
-		return "", fmt.Errorf("cannot create image file: %w", err)
-	}
-	defer file.Close()
-
-	_, err = imageData.WriteTo(file)
-	if err != nil {
-		return "", fmt.Errorf("cannot write image data to file: %w", err)
-	}
-
-	store.mutex.Lock()
-	defer store.mutex.Unlock()
-
-	store.images[laptopID] = &ImageInfo{
-		LaptopID: laptopID,
-		Type:     imageType,
-		Path:     imagePath,
-	}
-
-	return imageID.String(), nil
-}
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMaxImageSize is the size limit of an image unless it is configured
+const DefaultMaxImageSize = 1 << 20
+
+var ErrImageTooLarge = errors.New("image size is too large")
+
+type ImageStore interface {
+	// Save reads the image data until EOF and makes its variants, on any error nothing is stored
+	Save(laptopID string, imageType string, imageData io.Reader, uploadedBy string) (string, error)
+	Find(imageID string) (*ImageInfo, error)
+	List(laptopID string) ([]*ImageInfo, error)
+	// Open returns the data of the original image if the variant is empty
+	Open(imageID string, variant string) (*ImageInfo, io.ReadCloser, error)
+	Delete(imageID string) error
+	SetPrimary(imageID string) (*ImageInfo, error)
+	DeleteByLaptop(laptopID string) error
+}
+
+type DiskImageStoreConfig struct {
+	Folder string
+	// MaxImageSize is the size limit of an image in bytes
+	MaxImageSize int64
+	// MaxWidth and MaxHeight are the dimension limits of an image in pixels
+	MaxWidth  int
+	MaxHeight int
+}
+
+type DiskImageStore struct {
+	mutex        sync.Mutex
+	imageFolder  string
+	maxImageSize int64
+	maxWidth     int
+	maxHeight    int
+	catalog      *imageCatalog
+}
+
+type ImageInfo struct {
+	ID          string
+	LaptopID    string
+	Type        string
+	ContentType string
+	Path        string
+	Size        int64
+	// Digest is the hex encoded SHA-256 digest of the data
+	Digest     string
+	UploadedAt time.Time
+	UploadedBy string
+	// Primary is set on one image of each laptop, the first uploaded one unless it is changed
+	Primary bool
+	Width   int
+	Height  int
+	// Variants are the resized copies of the image, like the thumbnail
+	Variants []*ImageVariant
+}
+
+func NewDiskImageStore(imageFolder string) *DiskImageStore {
+	return NewDiskImageStoreWithConfig(DiskImageStoreConfig{Folder: imageFolder})
+}
+
+func NewDiskImageStoreWithConfig(config DiskImageStoreConfig) *DiskImageStore {
+	config = config.withDefaults()
+	return &DiskImageStore{
+		imageFolder:  config.Folder,
+		maxImageSize: config.MaxImageSize,
+		maxWidth:     config.MaxWidth,
+		maxHeight:    config.MaxHeight,
+		catalog:      newImageCatalog(),
+	}
+}
+
+func (config DiskImageStoreConfig) withDefaults() DiskImageStoreConfig {
+	if config.MaxImageSize <= 0 {
+		config.MaxImageSize = DefaultMaxImageSize
+	}
+	if config.MaxWidth <= 0 {
+		config.MaxWidth = DefaultMaxImageDimension
+	}
+	if config.MaxHeight <= 0 {
+		config.MaxHeight = DefaultMaxImageDimension
+	}
+	return config
+}
+
+// contentType returns the MIME type of an image type like ".jpg"
+func contentType(imageType string) string {
+	if t := mime.TypeByExtension(imageType); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Save checks the format and the dimensions of the image, then streams its data to a temporary file,
+// which is renamed to the image path once it is synced. The variants are made from the saved file
+func (store *DiskImageStore) Save(laptopID string, imageType string, imageData io.Reader, uploadedBy string) (string, error) {
+	imageID, err := uuid.NewUUID()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate a new image ID: %w", err)
+	}
+
+	data, config, err := checkImage(io.LimitReader(imageData, store.maxImageSize+1), imageType, store.maxWidth, store.maxHeight)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	imagePath := fmt.Sprintf("%s/%s%s", store.imageFolder, imageID, imageType)
+	size, err := writeFileAtomic(imagePath, io.TeeReader(data, hash), store.maxImageSize)
+	if err != nil {
+		return "", err
+	}
+
+	variants, err := saveImageVariants(imagePath)
+	if err != nil {
+		os.Remove(imagePath)
+		return "", err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := &ImageInfo{
+		ID:          imageID.String(),
+		LaptopID:    laptopID,
+		Type:        imageType,
+		ContentType: contentType(imageType),
+		Path:        imagePath,
+		Size:        size,
+		Digest:      hex.EncodeToString(hash.Sum(nil)),
+		UploadedAt:  time.Now(),
+		UploadedBy:  uploadedBy,
+		Width:       config.Width,
+		Height:      config.Height,
+		Variants:    variants,
+	}
+	store.catalog.add(image)
+
+	return image.ID, nil
+}
+
+// saveImageVariants makes the variants of a saved image and writes them next to it,
+// as <path without extension>_<variant><type>
+func saveImageVariants(imagePath string) ([]*ImageVariant, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open image file: %w", err)
+	}
+	defer file.Close()
+
+	encoded, err := makeImageVariants(file)
+	if err != nil {
+		return nil, err
+	}
+	return writeImageVariants(imagePath, encoded)
+}
+
+// writeImageVariants writes the encoded variants of an image next to it, on any error none is kept
+func writeImageVariants(imagePath string, encoded []*encodedImageVariant) ([]*ImageVariant, error) {
+	prefix := strings.TrimSuffix(imagePath, filepath.Ext(imagePath))
+
+	variants := make([]*ImageVariant, 0, len(encoded))
+	for _, e := range encoded {
+		e.variant.Path = fmt.Sprintf("%s_%s%s", prefix, e.variant.Name, e.variant.Type)
+		_, err := writeFileAtomic(e.variant.Path, bytes.NewReader(e.data), e.variant.Size)
+		if err != nil {
+			removeImageFiles(&ImageInfo{Variants: variants})
+			return nil, err
+		}
+		variants = append(variants, e.variant)
+	}
+	return variants, nil
+}
+
+// removeImageFiles removes the file of an image and of its variants, a missing file is not an error
+func removeImageFiles(image *ImageInfo) error {
+	paths := []string{image.Path}
+	for _, variant := range image.Variants {
+		paths = append(paths, variant.Path)
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove image file: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes at most maxSize bytes of data to a temporary file next to the path,
+// then syncs and renames it. The temporary file is removed on any error
+func writeFileAtomic(path string, data io.Reader, maxSize int64) (int64, error) {
+	tempPath, size, err := writeTempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp", data, maxSize)
+	if err != nil {
+		return 0, err
+	}
+
+	err = renameFile(tempPath, path)
+	if err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+	return size, nil
+}
+
+// writeTempFile writes at most maxSize bytes of data to a new synced file in the folder and returns its path,
+// the file is removed on any error
+func writeTempFile(folder string, pattern string, data io.Reader, maxSize int64) (string, int64, error) {
+	file, err := os.CreateTemp(folder, pattern)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot create image file: %w", err)
+	}
+	defer func() {
+		if file != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	size, err := io.Copy(file, io.LimitReader(data, maxSize+1))
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot write image data to file: %w", err)
+	}
+	if size > maxSize {
+		return "", 0, fmt.Errorf("image is larger than %d bytes: %w", maxSize, ErrImageTooLarge)
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot sync image file: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot close image file: %w", err)
+	}
+
+	path := file.Name()
+	file = nil
+	return path, size, nil
+}
+
+// renameFile renames a synced file and syncs the folder of its new path
+func renameFile(oldPath string, newPath string) error {
+	err := os.Rename(oldPath, newPath)
+	if err != nil {
+		return fmt.Errorf("cannot rename image file: %w", err)
+	}
+	return syncFile(filepath.Dir(newPath))
+}
+
+func (store *DiskImageStore) Find(imageID string) (*ImageInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.catalog.find(imageID)
+}
+
+// List returns the images of a laptop in upload order
+func (store *DiskImageStore) List(laptopID string) ([]*ImageInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.catalog.list(laptopID), nil
+}
+
+// Open returns the info of an image and the data of the variant, the data must be closed by the caller
+func (store *DiskImageStore) Open(imageID string, variant string) (*ImageInfo, io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return openImageFile(image, variant)
+}
+
+// imageVariantPath returns the path of an image, or of one of its variants if the variant is not empty
+func imageVariantPath(image *ImageInfo, variant string) (string, error) {
+	if variant == "" {
+		return image.Path, nil
+	}
+	for _, v := range image.Variants {
+		if v.Name == variant {
+			return v.Path, nil
+		}
+	}
+	return "", fmt.Errorf("%s variant of image with id %s: %w", variant, image.ID, ErrNotFound)
+}
+
+// openImageFile opens the file of an image or of one of its variants
+func openImageFile(image *ImageInfo, variant string) (*ImageInfo, io.ReadCloser, error) {
+	path, err := imageVariantPath(image, variant)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open image file: %w", err)
+	}
+	return image, file, nil
+}
+
+// Delete removes an image, if it is the primary one the next image of the laptop becomes primary
+func (store *DiskImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image, err := store.catalog.find(imageID)
+	if err != nil {
+		return err
+	}
+
+	err = removeImageFiles(image)
+	if err != nil {
+		return err
+	}
+
+	store.catalog.remove(imageID)
+	return nil
+}
+
+// SetPrimary makes an image the primary one of its laptop
+func (store *DiskImageStore) SetPrimary(imageID string) (*ImageInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.catalog.setPrimary(imageID)
+}
+
+func (store *DiskImageStore) DeleteByLaptop(laptopID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, image := range store.catalog.list(laptopID) {
+		err := removeImageFiles(image)
+		if err != nil {
+			return err
+		}
+		store.catalog.remove(image.ID)
+	}
+	return nil
+}
+
+// imageCatalog keeps the infos of the images and the image IDs of each laptop in upload order,
+// the caller must serialize its use
+type imageCatalog struct {
+	images       map[string]*ImageInfo
+	laptopImages map[string][]string
+}
+
+func newImageCatalog() *imageCatalog {
+	return &imageCatalog{
+		images:       make(map[string]*ImageInfo),
+		laptopImages: make(map[string][]string),
+	}
+}
+
+// add adds an image to its laptop, the first image of a laptop is primary
+func (catalog *imageCatalog) add(image *ImageInfo) {
+	image.Primary = len(catalog.laptopImages[image.LaptopID]) == 0
+	catalog.images[image.ID] = image
+	catalog.laptopImages[image.LaptopID] = append(catalog.laptopImages[image.LaptopID], image.ID)
+}
+
+// find returns a copy of an image
+func (catalog *imageCatalog) find(imageID string) (*ImageInfo, error) {
+	image := catalog.images[imageID]
+	if image == nil {
+		return nil, fmt.Errorf("image with id %s: %w", imageID, ErrNotFound)
+	}
+
+	other := *image
+	return &other, nil
+}
+
+// list returns copies of the images of a laptop in upload order
+func (catalog *imageCatalog) list(laptopID string) []*ImageInfo {
+	images := make([]*ImageInfo, 0, len(catalog.laptopImages[laptopID]))
+	for _, imageID := range catalog.laptopImages[laptopID] {
+		other := *catalog.images[imageID]
+		images = append(images, &other)
+	}
+	return images
+}
+
+// remove removes an image and returns it, or nil if there is none.
+// If it is the primary one the next image of the laptop becomes primary
+func (catalog *imageCatalog) remove(imageID string) *ImageInfo {
+	image := catalog.images[imageID]
+	if image == nil {
+		return nil
+	}
+
+	delete(catalog.images, imageID)
+	var remaining []string
+	for _, id := range catalog.laptopImages[image.LaptopID] {
+		if id != imageID {
+			remaining = append(remaining, id)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(catalog.laptopImages, image.LaptopID)
+		return image
+	}
+
+	catalog.laptopImages[image.LaptopID] = remaining
+	if image.Primary {
+		catalog.images[remaining[0]].Primary = true
+	}
+	return image
+}
+
+// setPrimary makes an image the primary one of its laptop and returns a copy of it
+func (catalog *imageCatalog) setPrimary(imageID string) (*ImageInfo, error) {
+	image := catalog.images[imageID]
+	if image == nil {
+		return nil, fmt.Errorf("image with id %s: %w", imageID, ErrNotFound)
+	}
+
+	for _, id := range catalog.laptopImages[image.LaptopID] {
+		catalog.images[id].Primary = id == imageID
+	}
+
+	other := *image
+	return &other, nil
+}
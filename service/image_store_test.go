@@ -0,0 +1,155 @@
+package service_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"pcbook/service"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testWebP is a lossless WebP image of 1x1 pixel
+var testWebP = []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+// newTestImage returns an image of random pixels encoded in the format, jpeg, png or gif
+func newTestImage(t *testing.T, format string, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	_, err := rand.Read(img.Pix)
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buffer, img, nil)
+	case "png":
+		err = png.Encode(&buffer, img)
+	case "gif":
+		err = gif.Encode(&buffer, img, nil)
+	default:
+		t.Fatalf("unknown image format %s", format)
+	}
+	require.NoError(t, err)
+	return buffer.Bytes()
+}
+
+func TestDiskImageStoreCheckImage(t *testing.T) {
+	t.Parallel()
+
+	pngData := newTestImage(t, "png", 300, 100)
+	testCases := []struct {
+		name      string
+		imageType string
+		data      []byte
+		err       error
+	}{
+		{"jpeg", ".jpeg", newTestImage(t, "jpeg", 30, 20), nil},
+		{"png", ".PNG", pngData, nil},
+		{"gif", ".gif", newTestImage(t, "gif", 20, 30), nil},
+		{"webp", ".webp", testWebP, nil},
+		{"type mismatch", ".jpg", pngData, service.ErrInvalidImage},
+		{"not an image", ".png", []byte("not an image"), service.ErrInvalidImage},
+		{"empty", ".png", nil, service.ErrInvalidImage},
+		{"unsupported type", ".bmp", pngData, service.ErrInvalidImage},
+		{"truncated header", ".png", pngData[:20], service.ErrInvalidImage},
+		{"too wide", ".png", newTestImage(t, "png", 301, 10), service.ErrImageTooLarge},
+		{"too high", ".png", newTestImage(t, "png", 10, 201), service.ErrImageTooLarge},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			folder := t.TempDir()
+			store := service.NewDiskImageStoreWithConfig(service.DiskImageStoreConfig{Folder: folder, MaxWidth: 300, MaxHeight: 200})
+
+			_, err := store.Save("laptop1", tc.imageType, bytes.NewReader(tc.data), "admin1")
+			entries, readErr := os.ReadDir(folder)
+			require.NoError(t, readErr)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				require.Empty(t, entries)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, entries, 3)
+		})
+	}
+}
+
+func TestDiskImageStoreVariants(t *testing.T) {
+	t.Parallel()
+
+	original, err := os.ReadFile("../tmp/laptop.jpg")
+	require.NoError(t, err)
+	require.Contains(t, string(original[:64]), "Exif")
+	config, err := jpeg.DecodeConfig(bytes.NewReader(original))
+	require.NoError(t, err)
+
+	folder := t.TempDir()
+	store := service.NewDiskImageStore(folder)
+	imageID, err := store.Save("laptop1", ".jpg", bytes.NewReader(original), "admin1")
+	require.NoError(t, err)
+
+	info, err := store.Find(imageID)
+	require.NoError(t, err)
+	require.Equal(t, config.Width, info.Width)
+	require.Equal(t, config.Height, info.Height)
+	require.Len(t, info.Variants, 2)
+
+	for _, tc := range []struct {
+		variant string
+		size    int
+	}{{service.ImageThumbnail, 128}, {service.ImageMedium, 640}} {
+		_, file, err := store.Open(imageID, tc.variant)
+		require.NoError(t, err)
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		// the metadata of the original is not copied
+		require.NotContains(t, string(data), "Exif")
+		img, format, err := image.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, "jpeg", format)
+
+		width, height := img.Bounds().Dx(), img.Bounds().Dy()
+		require.LessOrEqual(t, width, tc.size)
+		require.LessOrEqual(t, height, tc.size)
+		if config.Width > tc.size || config.Height > tc.size {
+			require.True(t, width == tc.size || height == tc.size)
+		}
+		require.InDelta(t, float64(config.Width)/float64(config.Height), float64(width)/float64(height), 0.05)
+
+		for _, variant := range info.Variants {
+			if variant.Name == tc.variant {
+				require.Equal(t, "image/jpeg", variant.ContentType)
+				require.EqualValues(t, len(data), variant.Size)
+				require.Equal(t, width, variant.Width)
+				require.Equal(t, height, variant.Height)
+			}
+		}
+	}
+
+	_, file, err := store.Open(imageID, "")
+	require.NoError(t, err)
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.Equal(t, original, data)
+
+	_, _, err = store.Open(imageID, "large")
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	require.NoError(t, store.Delete(imageID))
+	entries, err := os.ReadDir(folder)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
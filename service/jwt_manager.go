@@ -1,63 +1,63 @@
-package service
-
-import (
-	"fmt"
-	"time"
-
-	"github.com/golang-jwt/jwt"
-)
-
-type JWTMaganer struct {
-	secretKey     string
-	tokenDuration time.Duration
-}
-
-type UserClaims struct {
-	jwt.StandardClaims
-	Username string `json:"username"`
-	Role     string `json:"role"`
-}
-
-func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTMaganer {
-	return &JWTMaganer{
-		secretKey:     secretKey,
-		tokenDuration: tokenDuration,
-	}
-}
-
-func (manager *JWTMaganer) Generate(user *User) (string, error) {
-	claims := UserClaims{
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(manager.tokenDuration).Unix(),
-		},
-		Username: user.Username,
-		Role:     user.Role,
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(manager.secretKey))
-}
-
-func (manager *JWTMaganer) Verify(accessToken string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(
-		accessToken,
-		&UserClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			_, ok := token.Method.(*jwt.SigningMethodHMAC)
-			if !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return []byte(manager.secretKey), nil
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
-	}
-
-	claims, ok := token.Claims.(*UserClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
-	}
-
-	return claims, nil
-}
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type JWTMaganer struct {
+	secretKey     string
+	tokenDuration time.Duration
+}
+
+type UserClaims struct {
+	jwt.StandardClaims
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTMaganer {
+	return &JWTMaganer{
+		secretKey:     secretKey,
+		tokenDuration: tokenDuration,
+	}
+}
+
+func (manager *JWTMaganer) Generate(user *User) (string, error) {
+	claims := UserClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(manager.tokenDuration).Unix(),
+		},
+		Username: user.Username,
+		Role:     user.Role,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(manager.secretKey))
+}
+
+func (manager *JWTMaganer) Verify(accessToken string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(
+		accessToken,
+		&UserClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			_, ok := token.Method.(*jwt.SigningMethodHMAC)
+			if !ok {
+				return nil, fmt.Errorf("unexpected signing method")
+			}
+			return []byte(manager.secretKey), nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+	"pcbook/pb"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var termsFacetFields = map[string]func(laptop *pb.Laptop) string{
+	"brand": func(laptop *pb.Laptop) string {
+		return laptop.GetBrand()
+	},
+	"keyboard.layout": func(laptop *pb.Laptop) string {
+		return laptop.GetKeyboard().GetLayout().String()
+	},
+	"screen.panel": func(laptop *pb.Laptop) string {
+		return laptop.GetScreen().GetPanel().String()
+	},
+}
+
+var rangeFacetFields = map[string]func(laptop *pb.Laptop) float64{
+	"price_usd": func(laptop *pb.Laptop) float64 {
+		return laptop.GetPriceUsd()
+	},
+	"ram": func(laptop *pb.Laptop) float64 {
+		return float64(toBit(laptop.GetRam())) / float64(toBit(&pb.Memory{Value: 1, Unit: pb.Memory_GIGABYTE}))
+	},
+	"release_year": func(laptop *pb.Laptop) float64 {
+		return float64(laptop.GetReleaseYear())
+	},
+}
+
+// facet counts the laptops per bucket
+type facet interface {
+	add(laptop *pb.Laptop)
+	result() *pb.FacetResult
+}
+
+// parseFacet parses a facet spec like "brand" or "price_usd:500,1000,2000"
+func parseFacet(spec string) (facet, error) {
+	field, bounds, isRange := strings.Cut(spec, ":")
+	if !isRange {
+		value, ok := termsFacetFields[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown terms facet %q", field)
+		}
+		return &termsFacet{spec: spec, value: value, counts: make(map[string]uint64)}, nil
+	}
+
+	value, ok := rangeFacetFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown range facet %q", field)
+	}
+
+	facet := &rangeFacet{spec: spec, value: value}
+	for _, text := range strings.Split(bounds, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bound %q of facet %q", text, spec)
+		}
+		if n := len(facet.bounds); n > 0 && bound <= facet.bounds[n-1] {
+			return nil, fmt.Errorf("bounds of facet %q must be ascending", spec)
+		}
+		facet.bounds = append(facet.bounds, bound)
+	}
+	facet.counts = make([]uint64, len(facet.bounds)+1)
+	return facet, nil
+}
+
+type termsFacet struct {
+	spec   string
+	value  func(laptop *pb.Laptop) string
+	counts map[string]uint64
+}
+
+func (facet *termsFacet) add(laptop *pb.Laptop) {
+	facet.counts[facet.value(laptop)]++
+}
+
+// result returns the buckets by descending count
+func (facet *termsFacet) result() *pb.FacetResult {
+	buckets := make([]*pb.FacetBucket, 0, len(facet.counts))
+	for key, count := range facet.counts {
+		buckets = append(buckets, &pb.FacetBucket{Key: key, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].Key < buckets[j].Key
+	})
+	return &pb.FacetResult{Facet: facet.spec, Buckets: buckets}
+}
+
+// rangeFacet has a bucket below the first bound, one between each pair of bounds and one from the last bound
+type rangeFacet struct {
+	spec   string
+	value  func(laptop *pb.Laptop) float64
+	bounds []float64
+	counts []uint64
+}
+
+func (facet *rangeFacet) add(laptop *pb.Laptop) {
+	value := facet.value(laptop)
+	i := sort.Search(len(facet.bounds), func(i int) bool {
+		return facet.bounds[i] > value
+	})
+	facet.counts[i]++
+}
+
+func (facet *rangeFacet) result() *pb.FacetResult {
+	buckets := make([]*pb.FacetBucket, len(facet.counts))
+	for i, count := range facet.counts {
+		bucket := &pb.FacetBucket{Count: count}
+		from, to := "*", "*"
+		if i > 0 {
+			bucket.From = &facet.bounds[i-1]
+			from = strconv.FormatFloat(facet.bounds[i-1], 'f', -1, 64)
+		}
+		if i < len(facet.bounds) {
+			bucket.To = &facet.bounds[i]
+			to = strconv.FormatFloat(facet.bounds[i], 'f', -1, 64)
+		}
+		bucket.Key = from + "-" + to
+		buckets[i] = bucket
+	}
+	return &pb.FacetResult{Facet: facet.spec, Buckets: buckets}
+}
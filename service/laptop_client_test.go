@@ -1,258 +1,912 @@
-package service_test
-
-import (
-	"bufio"
-	"context"
-	"fmt"
-	"io"
-	"net"
-	"os"
-	"path/filepath"
-	"pcbook/pb"
-	"pcbook/sample"
-	"pcbook/serializer"
-	"pcbook/service"
-	"testing"
-	"time"
-
-	"github.com/stretchr/testify/require"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-)
-
-func TestClientCreateLaptop(t *testing.T) {
-	t.Parallel()
-
-	laptopStore := service.NewInMemoryLaptopStore()
-	_, serverAddress := startTestLaptopServer(t, laptopStore, nil, nil)
-	laptopClient := newTestLaptopClient(t, serverAddress)
-
-	laptop := sample.NewLaptop()
-	expectedID := laptop.Id
-	req := &pb.CreateLaptopRequest{
-		Laptop: laptop,
-	}
-
-	res, err := laptopClient.CreateLaptop(context.Background(), req)
-	require.NoError(t, err)
-	require.NotNil(t, res)
-	require.Equal(t, expectedID, res.Id)
-
-	other, err := laptopStore.Find(res.Id)
-	require.NoError(t, err)
-	require.NotNil(t, other)
-	requireSameLaptop(t, laptop, other)
-}
-
-func TestClientSearchLaptop(t *testing.T) {
-	t.Parallel()
-
-	filter := pb.Filter{
-		MaxPriceUsd: 2500,
-		MinCpuCores: 4,
-		MinCpuGhz:   2.5,
-		MinRam:      &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE},
-	}
-
-	store := service.NewInMemoryLaptopStore()
-	exprctedIds := make(map[string]bool)
-
-	for i := 0; i < 6; i++ {
-		laptop := sample.NewLaptop()
-		switch i {
-		case 0: //false
-			laptop.PriceUsd = 3000
-		case 1: //false
-			laptop.Cpu.NumberCores = 2
-		case 2: //false
-			laptop.Cpu.MinGhz = 1.5
-		case 3: //false
-			laptop.Ram = &pb.Memory{Value: 4096, Unit: pb.Memory_MEGABYTE}
-		case 4: //true
-			laptop.PriceUsd = 2500
-			laptop.Cpu.NumberCores = 4
-			laptop.Cpu.MinGhz = 2.5
-			laptop.Ram = &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE}
-			exprctedIds[laptop.Id] = true
-		case 5: //true
-			laptop.PriceUsd = 2100
-			laptop.Cpu.NumberCores = 8
-			laptop.Cpu.MinGhz = 3.5
-			laptop.Ram = &pb.Memory{Value: 32, Unit: pb.Memory_GIGABYTE}
-			exprctedIds[laptop.Id] = true
-		}
-		err := store.Save(laptop)
-		require.NoError(t, err)
-	}
-	_, serverAddress := startTestLaptopServer(t, store, nil, nil)
-	laptopClient := newTestLaptopClient(t, serverAddress)
-	req := &pb.SearchLaptopRequest{
-		Filter: &filter,
-	}
-	stream, err := laptopClient.SearchLaptop(context.Background(), req)
-	require.NoError(t, err)
-
-	found := 0
-	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		require.NoError(t, err)
-		require.Contains(t, exprctedIds, res.GetLaptop().GetId())
-		found++
-	}
-	require.Equal(t, len(exprctedIds), found)
-}
-
-func TestClientUploadImage(t *testing.T) {
-	t.Parallel()
-
-	testImageFolder := "../tmp"
-
-	laptopStore := service.NewInMemoryLaptopStore()
-	imageStore := service.NewDiskImageStore(testImageFolder)
-
-	_, serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
-	laptopClient := newTestLaptopClient(t, serverAddress)
-
-	imagePath := fmt.Sprintf("%s/%s", testImageFolder, "laptop.jpg")
-	file, err := os.Open(imagePath)
-	require.NoError(t, err)
-	defer file.Close()
-
-	laptop := sample.NewLaptop()
-	err = laptopStore.Save(laptop)
-	require.NoError(t, err)
-
-	laptopId := laptop.GetId()
-	imageType := filepath.Ext(imagePath)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	stream, err := laptopClient.UploadImage(ctx)
-	require.NoError(t, err)
-
-	req := &pb.UploadImageRequest{
-		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptopId, ImageType: imageType}},
-	}
-	err = stream.Send(req)
-	require.NoError(t, err)
-
-	reader := bufio.NewReader(file)
-	buffer := make([]byte, 1024)
-	size := 0
-	for {
-		n, err := reader.Read(buffer)
-		if err == io.EOF {
-			break
-		}
-		require.NoError(t, err)
-		size += n
-
-		err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: buffer[:n]}})
-		require.NoError(t, err)
-	}
-	res, err := stream.CloseAndRecv()
-	require.NoError(t, err)
-	require.EqualValues(t, size, res.GetSize())
-	require.NotZero(t, res.GetId())
-
-	savedImagePath := fmt.Sprintf("%s/%s%s", testImageFolder, res.GetId(), imageType)
-	require.FileExists(t, savedImagePath)
-	time.Sleep(time.Millisecond * 200)
-	require.NoError(t, os.Remove(savedImagePath))
-}
-
-func TestClientRateLaptop(t *testing.T) {
-	t.Parallel()
-
-	laptopStore := service.NewInMemoryLaptopStore()
-	ratingStore := service.NewInMemoryRatingStore()
-
-	_, serverAddress := startTestLaptopServer(t, laptopStore, nil, ratingStore)
-	laptopClient := newTestLaptopClient(t, serverAddress)
-
-	n := 4
-	laptopIds := make([]string, n)
-	ratings := make([][3]float64, n)
-	averages := make([]float64, n)
-
-	for i := 0; i < n; i++ {
-		laptop := sample.NewLaptop()
-		laptopIds[i] = laptop.GetId()
-		err := laptopStore.Save(laptop)
-		require.NoError(t, err)
-
-		ratings[i][0] = sample.NewRating()
-		ratings[i][1] = sample.NewRating()
-		ratings[i][2] = sample.NewRating()
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Second)
-	defer cancel()
-
-	//send 3 times
-	for j := 0; j < 3; j++ {
-		//
-		stream, err := laptopClient.RateLaptop(ctx)
-		require.NoError(t, err)
-
-		//send request
-		for i, laptopId := range laptopIds {
-			req := &pb.RateLaptopRequest{
-				LaptopId: laptopId,
-				Rating:   ratings[i][j],
-			}
-			err := stream.Send(req)
-			require.NoError(t, err)
-		}
-
-		//close stream
-		err = stream.CloseSend()
-		require.NoError(t, err)
-
-		for i := 0; ; i++ {
-			res, err := stream.Recv()
-			if err == io.EOF {
-				require.Equal(t, i, n)
-				break
-			}
-			require.NoError(t, err)
-			require.Equal(t, laptopIds[i], res.GetLaptopId())
-			require.Equal(t, uint32(j+1), res.GetRatedCount())
-			averages[i] = (averages[i]*float64(j) + ratings[i][j]) / float64(j+1)
-			require.Equal(t, averages[i], res.GetAverageRating())
-		}
-	}
-}
-
-func startTestLaptopServer(t *testing.T, laptopStore service.LaptopStore, imageStore service.ImageStore, ratingStore service.RatingStore) (*service.LaptopServer, string) {
-	laptopServer := service.NewLaptopServer(laptopStore, imageStore, ratingStore)
-	grpcServer := grpc.NewServer()
-
-	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
-
-	listener, err := net.Listen("tcp", ":0") //random avaliable port
-	require.NoError(t, err)
-	go grpcServer.Serve(listener)
-
-	return laptopServer, listener.Addr().String()
-}
-
-func newTestLaptopClient(t *testing.T, serverAddress string) pb.LaptopServiceClient {
-	conn, err := grpc.Dial(serverAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	require.NoError(t, err)
-	return pb.NewLaptopServiceClient(conn)
-}
-
-func requireSameLaptop(t *testing.T, laptop1, laptop2 *pb.Laptop) {
-	json1, err := serializer.ProtobufToJSON(laptop1)
-	require.NoError(t, err)
-
-	json2, err := serializer.ProtobufToJSON(laptop2)
-	require.NoError(t, err)
-
-	require.Equal(t, json1, json2)
-}
+package service_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"pcbook/client"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/serializer"
+	"pcbook/service"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientCreateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	_, serverAddress := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	laptop := sample.NewLaptop()
+	expectedID := laptop.Id
+	req := &pb.CreateLaptopRequest{
+		Laptop: laptop,
+	}
+
+	res, err := laptopClient.CreateLaptop(context.Background(), req)
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	require.Equal(t, expectedID, res.Id)
+
+	other, err := laptopStore.Find(res.Id)
+	require.NoError(t, err)
+	require.NotNil(t, other)
+	requireSameLaptop(t, laptop, other)
+}
+
+func TestClientBulkCreateLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	existing := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(existing))
+
+	_, serverAddress := startTestLaptopServer(t, laptopStore, nil, nil)
+	conn, err := grpc.Dial(serverAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	laptopClient := client.NewLaptopClient(conn)
+
+	newBatch := func() []*pb.Laptop {
+		laptops := make([]*pb.Laptop, 5)
+		for i := range laptops {
+			laptops[i] = sample.NewLaptop()
+		}
+		laptops[1].Id = ""
+		laptops[2].Id = "invalid-uuid"
+		laptops[3].Id = existing.Id
+		return laptops
+	}
+
+	laptops := newBatch()
+	results, err := laptopClient.BulkCreateLaptops(laptops, 2, false)
+	require.NoError(t, err)
+	require.Len(t, results, len(laptops))
+
+	expectedCodes := []codes.Code{codes.OK, codes.OK, codes.InvalidArgument, codes.AlreadyExists, codes.OK}
+	for i, result := range results {
+		require.Equal(t, int32(expectedCodes[i]), result.GetStatus().GetCode(), i)
+		if expectedCodes[i] == codes.OK {
+			_, err := laptopStore.Find(result.GetId())
+			require.NoError(t, err)
+		}
+	}
+	require.Equal(t, laptops[0].Id, results[0].GetId())
+	require.NotEmpty(t, results[1].GetId())
+
+	// the whole batch fails because of the existing laptop
+	laptops = newBatch()
+	laptops[2].Id = ""
+	results, err = laptopClient.BulkCreateLaptops(laptops, 10, true)
+	require.NoError(t, err)
+	require.Len(t, results, len(laptops))
+	for i, result := range results {
+		expected := codes.Aborted
+		if i == 3 {
+			expected = codes.AlreadyExists
+		}
+		require.Equal(t, int32(expected), result.GetStatus().GetCode(), i)
+		if i != 3 {
+			_, err := laptopStore.Find(result.GetId())
+			require.ErrorIs(t, err, service.ErrNotFound, i)
+		}
+	}
+
+	// every result of a rejected batch has the id of its laptop
+	laptops = newBatch()
+	laptops[3].Id = ""
+	results, err = laptopClient.BulkCreateLaptops(laptops, 10, true)
+	require.NoError(t, err)
+	expectedCodes = []codes.Code{codes.Aborted, codes.Aborted, codes.InvalidArgument, codes.Aborted, codes.Aborted}
+	for i, result := range results {
+		require.Equal(t, int32(expectedCodes[i]), result.GetStatus().GetCode(), i)
+		require.NotEmpty(t, result.GetId(), i)
+		if laptops[i].Id != "" {
+			require.Equal(t, laptops[i].Id, result.GetId(), i)
+		}
+	}
+
+	laptops = newBatch()
+	laptops[2].Id = ""
+	laptops[3].Id = ""
+	results, err = laptopClient.BulkCreateLaptops(laptops, 10, true)
+	require.NoError(t, err)
+	for _, result := range results {
+		require.Equal(t, int32(codes.OK), result.GetStatus().GetCode())
+		_, err := laptopStore.Find(result.GetId())
+		require.NoError(t, err)
+	}
+}
+
+func TestClientSearchLaptop(t *testing.T) {
+	t.Parallel()
+
+	filter := pb.Filter{
+		MaxPriceUsd: 2500,
+		MinCpuCores: 4,
+		MinCpuGhz:   2.5,
+		MinRam:      &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE},
+	}
+
+	store := service.NewInMemoryLaptopStore()
+	exprctedIds := make(map[string]bool)
+
+	for i := 0; i < 6; i++ {
+		laptop := sample.NewLaptop()
+		switch i {
+		case 0: //false
+			laptop.PriceUsd = 3000
+		case 1: //false
+			laptop.Cpu.NumberCores = 2
+		case 2: //false
+			laptop.Cpu.MinGhz = 1.5
+		case 3: //false
+			laptop.Ram = &pb.Memory{Value: 4096, Unit: pb.Memory_MEGABYTE}
+		case 4: //true
+			laptop.PriceUsd = 2500
+			laptop.Cpu.NumberCores = 4
+			laptop.Cpu.MinGhz = 2.5
+			laptop.Ram = &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE}
+			exprctedIds[laptop.Id] = true
+		case 5: //true
+			laptop.PriceUsd = 2100
+			laptop.Cpu.NumberCores = 8
+			laptop.Cpu.MinGhz = 3.5
+			laptop.Ram = &pb.Memory{Value: 32, Unit: pb.Memory_GIGABYTE}
+			exprctedIds[laptop.Id] = true
+		}
+		err := store.Save(laptop)
+		require.NoError(t, err)
+	}
+	_, serverAddress := startTestLaptopServer(t, store, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+	req := &pb.SearchLaptopRequest{
+		Filter: &filter,
+	}
+	stream, err := laptopClient.SearchLaptop(context.Background(), req)
+	require.NoError(t, err)
+
+	found := 0
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Contains(t, exprctedIds, res.GetLaptop().GetId())
+		found++
+	}
+	require.Equal(t, len(exprctedIds), found)
+}
+
+func TestClientSearchLaptopOrder(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	n := 10
+	laptops := make([]*pb.Laptop, n)
+	for i := 0; i < n; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(1000 + i%4*100)
+		err := laptopStore.Save(laptop)
+		require.NoError(t, err)
+		_, err = ratingStore.Save(laptop.Id, "user1", float64(i))
+		require.NoError(t, err)
+		laptops[i] = laptop
+	}
+
+	_, serverAddress := startTestLaptopServer(t, laptopStore, nil, ratingStore)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	search := func(req *pb.SearchLaptopRequest) []string {
+		stream, err := laptopClient.SearchLaptop(context.Background(), req)
+		require.NoError(t, err)
+
+		var ids []string
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return ids
+			}
+			require.NoError(t, err)
+			ids = append(ids, res.GetLaptop().GetId())
+		}
+	}
+
+	sort.Slice(laptops, func(i, j int) bool {
+		if laptops[i].PriceUsd != laptops[j].PriceUsd {
+			return laptops[i].PriceUsd > laptops[j].PriceUsd
+		}
+		return laptops[i].Id < laptops[j].Id
+	})
+	expectedIds := make([]string, 4)
+	for i := range expectedIds {
+		expectedIds[i] = laptops[i].Id
+	}
+	ids := search(&pb.SearchLaptopRequest{OrderBy: "price_usd desc", MaxResults: 4})
+	require.Equal(t, expectedIds, ids)
+
+	ids = search(&pb.SearchLaptopRequest{OrderBy: "average_rating desc", MaxResults: 1})
+	require.Len(t, ids, 1)
+	rating, err := ratingStore.Find(ids[0])
+	require.NoError(t, err)
+	require.Equal(t, float64(n-1), rating.Average())
+
+	// a single top rating ranks below many good ones with the prior
+	top := laptops[0].Id
+	_, err = ratingStore.Save(top, "user1", 10)
+	require.NoError(t, err)
+	for i := 1; i <= 20; i++ {
+		_, err = ratingStore.Save(laptops[1].Id, fmt.Sprintf("user%d", i), 9)
+		require.NoError(t, err)
+	}
+	ids = search(&pb.SearchLaptopRequest{OrderBy: "average_rating desc", MaxResults: 1})
+	require.Equal(t, []string{top}, ids)
+	ids = search(&pb.SearchLaptopRequest{OrderBy: "bayesian_rating desc", MaxResults: 1})
+	require.Equal(t, []string{laptops[1].Id}, ids)
+	ids = search(&pb.SearchLaptopRequest{OrderBy: "decayed_rating desc", MaxResults: 1})
+	require.Equal(t, []string{laptops[1].Id}, ids)
+	ids = search(&pb.SearchLaptopRequest{OrderBy: "rated_count desc", MaxResults: 1})
+	require.Equal(t, []string{laptops[1].Id}, ids)
+
+	// a limit without order_by returns the first laptops by id
+	sortedIds := make([]string, n)
+	for i, laptop := range laptops {
+		sortedIds[i] = laptop.Id
+	}
+	sort.Strings(sortedIds)
+	ids = search(&pb.SearchLaptopRequest{MaxResults: 3})
+	require.Equal(t, sortedIds[:3], ids)
+
+	ids = search(&pb.SearchLaptopRequest{OrderBy: "release_year"})
+	require.Len(t, ids, n)
+
+	stream, err := laptopClient.SearchLaptop(context.Background(), &pb.SearchLaptopRequest{OrderBy: "brand"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestClientSearchLaptopExpression(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	expectedIds := make(map[string]bool)
+	for i := 0; i < 6; i++ {
+		laptop := sample.NewLaptop()
+		laptop.Cpu.NumberCores = uint32(4 + i%2*4)
+		laptop.PriceUsd = 2000
+		if i < 2 {
+			laptop.PriceUsd = 3000
+		}
+		if laptop.Cpu.NumberCores >= 8 && laptop.PriceUsd <= 2500 {
+			expectedIds[laptop.Id] = true
+		}
+		err := store.Save(laptop)
+		require.NoError(t, err)
+	}
+
+	_, serverAddress := startTestLaptopServer(t, store, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	req := &pb.SearchLaptopRequest{
+		Filter:     &pb.Filter{MaxPriceUsd: 2500},
+		Expression: "cpu.number_cores >= 8 && gpus.exists(g, g.memory.value > 0)",
+	}
+	stream, err := laptopClient.SearchLaptop(context.Background(), req)
+	require.NoError(t, err)
+
+	found := 0
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Contains(t, expectedIds, res.GetLaptop().GetId())
+		found++
+	}
+	require.Equal(t, len(expectedIds), found)
+
+	req.Expression = "cpu.number_cores >= "
+	stream, err = laptopClient.SearchLaptop(context.Background(), req)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), "column 21")
+}
+
+func TestClientUploadImage(t *testing.T) {
+	t.Parallel()
+
+	testImageFolder := "../tmp"
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(testImageFolder)
+
+	_, serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	imagePath := fmt.Sprintf("%s/%s", testImageFolder, "laptop.jpg")
+	file, err := os.Open(imagePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	laptop := sample.NewLaptop()
+	err = laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	laptopId := laptop.GetId()
+	imageType := filepath.Ext(imagePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := laptopClient.UploadImage(ctx)
+	require.NoError(t, err)
+
+	req := &pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptopId, ImageType: imageType}},
+	}
+	err = stream.Send(req)
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(file)
+	buffer := make([]byte, 1024)
+	size := 0
+	for {
+		n, err := reader.Read(buffer)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		size += n
+
+		err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: buffer[:n]}})
+		require.NoError(t, err)
+	}
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.EqualValues(t, size, res.GetSize())
+	require.NotZero(t, res.GetId())
+
+	savedImagePath := fmt.Sprintf("%s/%s%s", testImageFolder, res.GetId(), imageType)
+	require.FileExists(t, savedImagePath)
+	time.Sleep(time.Millisecond * 200)
+	require.NoError(t, imageStore.Delete(res.GetId()))
+	require.NoFileExists(t, savedImagePath)
+}
+
+func uploadTestImage(t *testing.T, laptopClient pb.LaptopServiceClient, laptopId string, imageType string, data []byte) string {
+	stream, err := laptopClient.UploadImage(context.Background())
+	require.NoError(t, err)
+
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptopId, ImageType: imageType}},
+	})
+	require.NoError(t, err)
+
+	for start := 0; start < len(data); start += 1024 {
+		end := start + 1024
+		if end > len(data) {
+			end = len(data)
+		}
+		err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: data[start:end]}})
+		require.NoError(t, err)
+	}
+
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	return res.GetId()
+}
+
+func TestClientImages(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+	_, serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	front := newTestImage(t, "jpeg", 400, 300)
+	back := newTestImage(t, "png", 60, 80)
+	frontId := uploadTestImage(t, laptopClient, laptop.Id, ".jpg", front)
+	backId := uploadTestImage(t, laptopClient, laptop.Id, ".png", back)
+
+	ctx := context.Background()
+	list, err := laptopClient.ListImages(ctx, &pb.ListImagesRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.Len(t, list.GetImages(), 2)
+	require.Equal(t, frontId, list.GetImages()[0].GetId())
+	require.True(t, list.GetImages()[0].GetPrimary())
+	require.Equal(t, "image/jpeg", list.GetImages()[0].GetContentType())
+	require.EqualValues(t, len(front), list.GetImages()[0].GetSize())
+	require.Equal(t, backId, list.GetImages()[1].GetId())
+	require.False(t, list.GetImages()[1].GetPrimary())
+	require.Equal(t, "image/png", list.GetImages()[1].GetContentType())
+	require.NotNil(t, list.GetImages()[1].GetUploadedAt())
+	require.EqualValues(t, 60, list.GetImages()[1].GetWidth())
+	require.EqualValues(t, 80, list.GetImages()[1].GetHeight())
+	require.Len(t, list.GetImages()[1].GetVariants(), 2)
+
+	stream, err := laptopClient.DownloadImage(ctx, &pb.DownloadImageRequest{ImageId: frontId})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, frontId, res.GetInfo().GetId())
+	var data []byte
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data = append(data, res.GetChunkData()...)
+	}
+	require.Equal(t, front, data)
+
+	stream, err = laptopClient.DownloadImage(ctx, &pb.DownloadImageRequest{ImageId: frontId, Size: pb.Image_THUMBNAIL})
+	require.NoError(t, err)
+	res, err = stream.Recv()
+	require.NoError(t, err)
+	variants := res.GetInfo().GetVariants()
+	require.Len(t, variants, 2)
+	require.Equal(t, pb.Image_THUMBNAIL, variants[0].GetVariant())
+	require.EqualValues(t, 128, variants[0].GetWidth())
+	require.EqualValues(t, 96, variants[0].GetHeight())
+	require.Equal(t, pb.Image_MEDIUM, variants[1].GetVariant())
+	require.EqualValues(t, 400, variants[1].GetWidth())
+	data = nil
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data = append(data, res.GetChunkData()...)
+	}
+	require.EqualValues(t, variants[0].GetSize(), len(data))
+	thumbnail, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, 128, thumbnail.Width)
+
+	// an image of another type than its data is refused
+	upload, err := laptopClient.UploadImage(ctx)
+	require.NoError(t, err)
+	require.NoError(t, upload.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptop.Id, ImageType: ".jpg"}},
+	}))
+	require.NoError(t, upload.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: back}}))
+	_, err = upload.CloseAndRecv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	primary, err := laptopClient.SetPrimaryImage(ctx, &pb.SetPrimaryImageRequest{ImageId: backId})
+	require.NoError(t, err)
+	require.True(t, primary.GetImage().GetPrimary())
+
+	_, err = laptopClient.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: backId})
+	require.NoError(t, err)
+	_, err = laptopClient.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: backId})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err = laptopClient.ListImages(ctx, &pb.ListImagesRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.Len(t, list.GetImages(), 1)
+	require.True(t, list.GetImages()[0].GetPrimary())
+
+	stream, err = laptopClient.DownloadImage(ctx, &pb.DownloadImageRequest{ImageId: backId})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = laptopClient.ListImages(ctx, &pb.ListImagesRequest{LaptopId: uuid.New().String()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestClientUploadImageLimit(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStoreWithConfig(service.DiskImageStoreConfig{Folder: imageFolder, MaxImageSize: 4096})
+	_, serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	small := newTestImage(t, "png", 16, 16)
+	require.LessOrEqual(t, len(small), 4096)
+	imageId := uploadTestImage(t, laptopClient, laptop.Id, ".png", small)
+	require.FileExists(t, filepath.Join(imageFolder, imageId+".png"))
+
+	large := newTestImage(t, "png", 64, 64)
+	require.Greater(t, len(large), 5*1024)
+	stream, err := laptopClient.UploadImage(context.Background())
+	require.NoError(t, err)
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptop.Id, ImageType: ".png"}},
+	})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: large[i*1024 : (i+1)*1024]}})
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// a cancelled upload leaves no partial file
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err = laptopClient.UploadImage(ctx)
+	require.NoError(t, err)
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptop.Id, ImageType: ".png"}},
+	})
+	require.NoError(t, err)
+	err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: large[:1024]}})
+	require.NoError(t, err)
+
+	// the server writes the partial file while it waits for the next chunk
+	tempFiles := func() []string {
+		matches, err := filepath.Glob(filepath.Join(imageFolder, "*.tmp"))
+		require.NoError(t, err)
+		return matches
+	}
+	require.Eventually(t, func() bool {
+		return len(tempFiles()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	require.Eventually(t, func() bool {
+		return len(tempFiles()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	entries, err := os.ReadDir(imageFolder)
+	require.NoError(t, err)
+	// the image and its two variants
+	require.Len(t, entries, 3)
+
+	images, err := imageStore.List(laptop.Id)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+}
+
+// interruptedServerStream fails to receive after a number of messages, like a dropped connection
+type interruptedServerStream struct {
+	grpc.ServerStream
+	remaining int
+}
+
+func (stream *interruptedServerStream) RecvMsg(m interface{}) error {
+	if stream.remaining == 0 {
+		return status.Error(codes.Unavailable, "connection reset")
+	}
+	stream.remaining--
+	return stream.ServerStream.RecvMsg(m)
+}
+
+func TestClientUploadImageDigest(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore, err := service.NewContentImageStore(service.ContentImageStoreConfig{Folder: t.TempDir()})
+	require.NoError(t, err)
+	defer imageStore.Close()
+	_, serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	data := newTestImage(t, "png", 32, 32)
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	upload := func(expected string) (*pb.UploadImageResponse, error) {
+		stream, err := laptopClient.UploadImage(context.Background())
+		require.NoError(t, err)
+		err = stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_Info{Info: &pb.ImageInfo{LaptopId: laptop.Id, ImageType: ".png", Sha256: expected}},
+		})
+		require.NoError(t, err)
+		err = stream.Send(&pb.UploadImageRequest{Data: &pb.UploadImageRequest_ChunkData{ChunkData: data}})
+		require.NoError(t, err)
+		return stream.CloseAndRecv()
+	}
+
+	res, err := upload(strings.ToUpper(digest))
+	require.NoError(t, err)
+	require.Equal(t, digest, res.GetSha256())
+
+	res, err = upload("")
+	require.NoError(t, err)
+	require.Equal(t, digest, res.GetSha256())
+
+	wrong := sha256.Sum256([]byte("other"))
+	_, err = upload(hex.EncodeToString(wrong[:]))
+	require.Equal(t, codes.DataLoss, status.Code(err))
+
+	list, err := laptopClient.ListImages(context.Background(), &pb.ListImagesRequest{LaptopId: laptop.Id})
+	require.NoError(t, err)
+	require.Len(t, list.GetImages(), 2)
+	for _, image := range list.GetImages() {
+		require.Equal(t, digest, image.GetSha256())
+	}
+}
+
+func TestClientUploadImageResume(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStoreWithConfig(service.DiskImageStoreConfig{Folder: imageFolder, MaxImageSize: 1 << 20})
+	uploadStore, err := service.NewUploadSessionStore(service.UploadSessionConfig{Folder: t.TempDir(), MaxImageSize: 1 << 20})
+	require.NoError(t, err)
+	defer uploadStore.Close()
+	laptopServer := service.NewLaptopServerWithUploads(laptopStore, imageStore, nil, uploadStore)
+
+	// the first chunk stream breaks after two chunks
+	var interrupted int32
+	interceptor := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if info.FullMethod != "/my.pcbook.LaptopService/UploadChunks" || !atomic.CompareAndSwapInt32(&interrupted, 0, 1) {
+			return handler(srv, ss)
+		}
+		handler(srv, &interruptedServerStream{ServerStream: ss, remaining: 2})
+		return status.Error(codes.Unavailable, "connection reset")
+	}
+	grpcServer := grpc.NewServer(grpc.StreamInterceptor(interceptor))
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	laptopClient := client.NewLaptopClient(conn)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	data := newTestImage(t, "png", 300, 300)
+	require.Greater(t, len(data), 256<<10)
+	imagePath := filepath.Join(t.TempDir(), "laptop.png")
+	require.NoError(t, os.WriteFile(imagePath, data, 0644))
+
+	image, err := laptopClient.UploadImage(laptop.Id, imagePath)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&interrupted))
+	require.EqualValues(t, len(data), image.GetSize())
+
+	saved, err := os.ReadFile(filepath.Join(imageFolder, image.GetId()+".png"))
+	require.NoError(t, err)
+	require.Equal(t, data, saved)
+}
+
+func TestClientRateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	interceptor := service.NewAuthInterceptor(jwtManager, map[string][]string{
+		"/my.pcbook.LaptopService/RateLaptop":   {"user"},
+		"/my.pcbook.LaptopService/DeleteRating": {"user"},
+		"/my.pcbook.LaptopService/GetMyRatings": {"user"},
+	})
+
+	laptopServer := service.NewLaptopServer(laptopStore, nil, ratingStore)
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()), grpc.StreamInterceptor(interceptor.Stream()))
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	laptopClient := newTestLaptopClient(t, listener.Addr().String())
+
+	n := 4
+	laptopIds := make([]string, n)
+	for i := range laptopIds {
+		laptop := sample.NewLaptop()
+		laptopIds[i] = laptop.GetId()
+		require.NoError(t, laptopStore.Save(laptop))
+	}
+
+	userContext := func(username string) context.Context {
+		token := newTestToken(t, jwtManager, username, "user")
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", token)
+	}
+
+	// rate sends the ratings of the laptops and checks the count and the average of the responses
+	rate := func(ctx context.Context, ratings []float64, counts []uint32, averages []float64) {
+		stream, err := laptopClient.RateLaptop(ctx)
+		require.NoError(t, err)
+		for i, laptopId := range laptopIds {
+			err := stream.Send(&pb.RateLaptopRequest{LaptopId: laptopId, Rating: ratings[i]})
+			require.NoError(t, err)
+		}
+		require.NoError(t, stream.CloseSend())
+
+		for i := 0; ; i++ {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				require.Equal(t, n, i)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, laptopIds[i], res.GetLaptopId())
+			require.Equal(t, counts[i], res.GetRatedCount())
+			require.InDelta(t, averages[i], res.GetAverageRating(), 1e-9)
+		}
+	}
+
+	user1, user2 := userContext("user1"), userContext("user2")
+	rate(user1, []float64{1, 2, 3, 4}, []uint32{1, 1, 1, 1}, []float64{1, 2, 3, 4})
+	// a repeat rating of the same user replaces the previous one
+	rate(user1, []float64{5, 4, 3, 2}, []uint32{1, 1, 1, 1}, []float64{5, 4, 3, 2})
+	rate(user2, []float64{3, 3, 3, 3}, []uint32{2, 2, 2, 2}, []float64{4, 3.5, 3, 2.5})
+
+	res, err := laptopClient.GetMyRatings(user1, &pb.GetMyRatingsRequest{})
+	require.NoError(t, err)
+	require.Len(t, res.GetRatings(), n)
+	for _, rating := range res.GetRatings() {
+		require.Contains(t, laptopIds, rating.GetLaptopId())
+		require.NotNil(t, rating.GetRatedAt())
+	}
+
+	deleted, err := laptopClient.DeleteRating(user2, &pb.DeleteRatingRequest{LaptopId: laptopIds[0]})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), deleted.GetRatedCount())
+	require.Equal(t, 5.0, deleted.GetAverageRating())
+	_, err = laptopClient.DeleteRating(user2, &pb.DeleteRatingRequest{LaptopId: laptopIds[0]})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	res, err = laptopClient.GetMyRatings(user2, &pb.GetMyRatingsRequest{})
+	require.NoError(t, err)
+	require.Len(t, res.GetRatings(), n-1)
+
+	_, err = laptopClient.GetMyRatings(context.Background(), &pb.GetMyRatingsRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	summary, err := laptopClient.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{LaptopId: laptopIds[1]})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), summary.GetSummary().GetRatedCount())
+	require.Equal(t, 3.5, summary.GetSummary().GetMedianRating())
+	require.Len(t, summary.GetSummary().GetDistribution(), 19)
+	_, err = laptopClient.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{LaptopId: uuid.New().String()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// the ratings must be steps of the default scale
+	for _, rating := range []float64{0, 10.5, -1, 3.3, math.NaN(), math.Inf(1)} {
+		stream, err := laptopClient.RateLaptop(user1)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&pb.RateLaptopRequest{LaptopId: laptopIds[0], Rating: rating}))
+		_, err = stream.Recv()
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "rating %v", rating)
+	}
+}
+
+func TestClientWatchLaptops(t *testing.T) {
+	t.Parallel()
+
+	eventLog := service.NewLaptopEventLog(4)
+	laptopStore := service.NewInMemoryLaptopStoreWithEventLog(eventLog)
+	_, serverAddress := startTestLaptopServer(t, laptopStore, nil, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	cheap := sample.NewLaptop()
+	cheap.PriceUsd = 1000
+	require.NoError(t, laptopStore.Save(cheap))
+	expensive := sample.NewLaptop()
+	expensive.PriceUsd = 3000
+	require.NoError(t, laptopStore.Save(expensive))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := &pb.Filter{MaxPriceUsd: 2000}
+	stream, err := laptopClient.WatchLaptops(ctx, &pb.WatchLaptopsRequest{Filter: filter, StartRevision: 2})
+	require.NoError(t, err)
+
+	cheap.PriceUsd = 1200
+	_, err = laptopStore.Update(cheap, []string{"price_usd"})
+	require.NoError(t, err)
+	require.NoError(t, laptopStore.NotifyRated(cheap.Id))
+	require.NoError(t, laptopStore.Delete(cheap.Id, "admin1"))
+	expensive.PriceUsd = 1500
+	_, err = laptopStore.Update(expensive, []string{"price_usd"})
+	require.NoError(t, err)
+
+	expected := []struct {
+		eventType pb.LaptopEvent_Type
+		laptopId  string
+		price     float64
+	}{
+		{pb.LaptopEvent_UPDATED, cheap.Id, 1200},
+		{pb.LaptopEvent_RATED, cheap.Id, 1200},
+		{pb.LaptopEvent_DELETED, cheap.Id, 1200},
+		{pb.LaptopEvent_UPDATED, expensive.Id, 1500},
+	}
+	for i, want := range expected {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		event := res.GetEvent()
+		require.Equal(t, uint64(i+3), event.GetRevision())
+		require.Equal(t, want.eventType, event.GetType())
+		require.Equal(t, want.laptopId, event.GetLaptop().GetId())
+		require.Equal(t, want.price, event.GetLaptop().GetPriceUsd())
+		require.NotNil(t, event.GetTime())
+	}
+
+	// the oldest retained revision is 3
+	stream, err = laptopClient.WatchLaptops(ctx, &pb.WatchLaptopsRequest{StartRevision: 5})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), res.GetEvent().GetRevision())
+
+	for _, revision := range []uint64{1, 7} {
+		stream, err = laptopClient.WatchLaptops(ctx, &pb.WatchLaptopsRequest{StartRevision: revision})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.OutOfRange, status.Code(err))
+	}
+}
+
+func startTestLaptopServer(t *testing.T, laptopStore service.LaptopStore, imageStore service.ImageStore, ratingStore service.RatingStore) (*service.LaptopServer, string) {
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, ratingStore)
+	grpcServer := grpc.NewServer()
+
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+
+	listener, err := net.Listen("tcp", ":0") //random avaliable port
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+
+	return laptopServer, listener.Addr().String()
+}
+
+func newTestLaptopClient(t *testing.T, serverAddress string) pb.LaptopServiceClient {
+	conn, err := grpc.Dial(serverAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	return pb.NewLaptopServiceClient(conn)
+}
+
+func requireSameLaptop(t *testing.T, laptop1, laptop2 *pb.Laptop) {
+	json1, err := serializer.ProtobufToJSON(laptop1)
+	require.NoError(t, err)
+
+	json2, err := serializer.ProtobufToJSON(laptop2)
+	require.NoError(t, err)
+
+	require.Equal(t, json1, json2)
+}
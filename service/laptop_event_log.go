@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"pcbook/pb"
+	"sync"
+	"time"
+)
+
+// DefaultEventRetention is the number of events kept by the event log of a laptop store
+const DefaultEventRetention = 10000
+
+var ErrRevisionExpired = errors.New("revision is no longer retained")
+var ErrFutureRevision = errors.New("revision has not been reached yet")
+
+// LaptopEvent is a change of a laptop recorded by the store
+type LaptopEvent struct {
+	Revision uint64
+	Type     pb.LaptopEvent_Type
+	Laptop   *pb.Laptop
+	// Previous is the laptop before an update
+	Previous *pb.Laptop
+	Time     time.Time
+}
+
+// LaptopEventLog keeps the latest events of a store so that watchers can resume after a revision
+type LaptopEventLog struct {
+	mutex     sync.Mutex
+	retention int
+	events    []*LaptopEvent
+	revision  uint64
+	// changed is closed and replaced whenever an event is appended
+	changed chan struct{}
+}
+
+func NewLaptopEventLog(retention int) *LaptopEventLog {
+	return &LaptopEventLog{
+		retention: retention,
+		changed:   make(chan struct{}),
+	}
+}
+
+// Append records an event with the next revision, the laptops must not be modified afterwards
+func (eventLog *LaptopEventLog) Append(eventType pb.LaptopEvent_Type, laptop *pb.Laptop, previous *pb.Laptop) *LaptopEvent {
+	eventLog.mutex.Lock()
+	defer eventLog.mutex.Unlock()
+
+	eventLog.revision++
+	event := &LaptopEvent{
+		Revision: eventLog.revision,
+		Type:     eventType,
+		Laptop:   laptop,
+		Previous: previous,
+		Time:     time.Now(),
+	}
+
+	eventLog.events = append(eventLog.events, event)
+	if len(eventLog.events) > eventLog.retention {
+		eventLog.events[0] = nil
+		eventLog.events = eventLog.events[1:]
+	}
+
+	close(eventLog.changed)
+	eventLog.changed = make(chan struct{})
+	return event
+}
+
+// Revision returns the revision of the last event
+func (eventLog *LaptopEventLog) Revision() uint64 {
+	eventLog.mutex.Lock()
+	defer eventLog.mutex.Unlock()
+
+	return eventLog.revision
+}
+
+// since returns the events after the revision and a channel closed when a new event is appended
+func (eventLog *LaptopEventLog) since(revision uint64) ([]*LaptopEvent, <-chan struct{}, error) {
+	eventLog.mutex.Lock()
+	defer eventLog.mutex.Unlock()
+
+	if revision > eventLog.revision {
+		return nil, nil, ErrFutureRevision
+	}
+	oldest := eventLog.revision + 1 - uint64(len(eventLog.events))
+	if revision+1 < oldest {
+		return nil, nil, ErrRevisionExpired
+	}
+
+	events := eventLog.events[len(eventLog.events)-int(eventLog.revision-revision):]
+	return append([]*LaptopEvent(nil), events...), eventLog.changed, nil
+}
+
+// Watch calls found for every event after the revision until the context is done,
+// a revision of zero watches the events appended from now on
+func (eventLog *LaptopEventLog) Watch(ctx context.Context, revision uint64, found func(event *LaptopEvent) error) error {
+	if revision == 0 {
+		revision = eventLog.Revision()
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		events, changed, err := eventLog.since(revision)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			err := found(event)
+			if err != nil {
+				return err
+			}
+			revision = event.Revision
+		}
+
+		if len(events) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"math"
+	"pcbook/pb"
+	"sort"
+)
+
+// laptopIndexChunkSize is the minimum size of a full chunk, a chunk is split in two when it doubles
+const laptopIndexChunkSize = 512
+
+type indexEntry struct {
+	key float64
+	id  string
+}
+
+func (entry indexEntry) less(other indexEntry) bool {
+	if entry.key != other.key {
+		return entry.key < other.key
+	}
+	return entry.id < other.id
+}
+
+// indexChunk is a sorted part of an index, it may only be changed in its version
+type indexChunk struct {
+	version uint64
+	entries []indexEntry
+}
+
+// laptopIndex keeps the ids of laptops sorted by a key, in chunks so that
+// inserting or removing an entry neither moves nor copies the whole index
+type laptopIndex struct {
+	version uint64
+	key     func(laptop *pb.Laptop) float64
+	chunks  []*indexChunk
+	size    int
+}
+
+func newLaptopIndex(key func(laptop *pb.Laptop) float64) *laptopIndex {
+	return &laptopIndex{key: key}
+}
+
+// clone returns a copy of the index to be changed in the given version,
+// the chunks are shared and copied on write
+func (index *laptopIndex) clone(version uint64) *laptopIndex {
+	other := *index
+	other.version = version
+	other.chunks = append([]*indexChunk(nil), index.chunks...)
+	return &other
+}
+
+// chunk returns the i-th chunk for writing, copying it first if it belongs to an older version
+func (index *laptopIndex) chunk(i int) *indexChunk {
+	chunk := index.chunks[i]
+	if chunk.version != index.version {
+		entries := make([]indexEntry, len(chunk.entries), len(chunk.entries)+1)
+		copy(entries, chunk.entries)
+		chunk = &indexChunk{version: index.version, entries: entries}
+		index.chunks[i] = chunk
+	}
+	return chunk
+}
+
+// chunkOf returns the first chunk whose last entry is not less than the entry
+func (index *laptopIndex) chunkOf(entry indexEntry) int {
+	return sort.Search(len(index.chunks), func(i int) bool {
+		entries := index.chunks[i].entries
+		return !entries[len(entries)-1].less(entry)
+	})
+}
+
+func (index *laptopIndex) add(laptop *pb.Laptop) {
+	entry := indexEntry{key: index.key(laptop), id: laptop.GetId()}
+	index.size++
+
+	if len(index.chunks) == 0 {
+		index.chunks = []*indexChunk{{version: index.version, entries: []indexEntry{entry}}}
+		return
+	}
+
+	i := index.chunkOf(entry)
+	if i == len(index.chunks) {
+		i--
+	}
+
+	chunk := index.chunk(i)
+	entries := chunk.entries
+	j := sort.Search(len(entries), func(j int) bool {
+		return !entries[j].less(entry)
+	})
+	entries = append(entries, indexEntry{})
+	copy(entries[j+1:], entries[j:])
+	entries[j] = entry
+
+	if len(entries) < 2*laptopIndexChunkSize {
+		chunk.entries = entries
+		return
+	}
+
+	half := len(entries) / 2
+	chunk.entries = entries[:half:half]
+	right := &indexChunk{version: index.version, entries: append([]indexEntry(nil), entries[half:]...)}
+	index.chunks = append(index.chunks, nil)
+	copy(index.chunks[i+2:], index.chunks[i+1:])
+	index.chunks[i+1] = right
+}
+
+func (index *laptopIndex) remove(laptop *pb.Laptop) {
+	entry := indexEntry{key: index.key(laptop), id: laptop.GetId()}
+
+	i := index.chunkOf(entry)
+	if i == len(index.chunks) {
+		return
+	}
+
+	entries := index.chunks[i].entries
+	j := sort.Search(len(entries), func(j int) bool {
+		return !entries[j].less(entry)
+	})
+	if j == len(entries) || entries[j] != entry {
+		return
+	}
+
+	index.size--
+	if len(entries) == 1 {
+		index.chunks = append(index.chunks[:i], index.chunks[i+1:]...)
+		return
+	}
+	chunk := index.chunk(i)
+	chunk.entries = append(chunk.entries[:j], chunk.entries[j+1:]...)
+}
+
+// rank returns the number of entries with a key less than the given one,
+// or not greater than it if inclusive is set
+func (index *laptopIndex) rank(key float64, inclusive bool) int {
+	below := func(entry indexEntry) bool {
+		if inclusive {
+			return entry.key <= key
+		}
+		return entry.key < key
+	}
+
+	n := 0
+	for _, chunk := range index.chunks {
+		entries := chunk.entries
+		if below(entries[len(entries)-1]) {
+			n += len(entries)
+			continue
+		}
+		return n + sort.Search(len(entries), func(j int) bool {
+			return !below(entries[j])
+		})
+	}
+	return n
+}
+
+// ascend calls fn for the ids with a key in [min, max] in order
+func (index *laptopIndex) ascend(min, max float64, fn func(id string) error) error {
+	start := sort.Search(len(index.chunks), func(i int) bool {
+		entries := index.chunks[i].entries
+		return entries[len(entries)-1].key >= min
+	})
+
+	for _, chunk := range index.chunks[start:] {
+		entries := chunk.entries
+		j := sort.Search(len(entries), func(j int) bool {
+			return entries[j].key >= min
+		})
+		for _, entry := range entries[j:] {
+			if entry.key > max {
+				return nil
+			}
+			err := fn(entry.id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexRange is the part of an index which may contain the laptops matching a filter
+type indexRange struct {
+	index    *laptopIndex
+	min, max float64
+}
+
+func (r indexRange) count() int {
+	return r.index.rank(r.max, true) - r.index.rank(r.min, false)
+}
+
+func (r indexRange) each(fn func(id string) error) error {
+	return r.index.ascend(r.min, r.max, fn)
+}
+
+// laptopIndexes are the secondary indexes of InMemoryLaptopStore
+type laptopIndexes struct {
+	priceUsd *laptopIndex
+	cpuCores *laptopIndex
+	cpuGhz   *laptopIndex
+	ram      *laptopIndex
+}
+
+func newLaptopIndexes() *laptopIndexes {
+	return &laptopIndexes{
+		priceUsd: newLaptopIndex(laptopOrderKeys["price_usd"]),
+		cpuCores: newLaptopIndex(laptopOrderKeys["cpu.number_cores"]),
+		cpuGhz: newLaptopIndex(func(laptop *pb.Laptop) float64 {
+			return laptop.GetCpu().GetMinGhz()
+		}),
+		ram: newLaptopIndex(laptopOrderKeys["ram"]),
+	}
+}
+
+// clone returns a copy of the indexes to be changed in the given version
+func (indexes *laptopIndexes) clone(version uint64) *laptopIndexes {
+	return &laptopIndexes{
+		priceUsd: indexes.priceUsd.clone(version),
+		cpuCores: indexes.cpuCores.clone(version),
+		cpuGhz:   indexes.cpuGhz.clone(version),
+		ram:      indexes.ram.clone(version),
+	}
+}
+
+func (indexes *laptopIndexes) all() []*laptopIndex {
+	return []*laptopIndex{indexes.priceUsd, indexes.cpuCores, indexes.cpuGhz, indexes.ram}
+}
+
+func (indexes *laptopIndexes) add(laptop *pb.Laptop) {
+	for _, index := range indexes.all() {
+		index.add(laptop)
+	}
+}
+
+func (indexes *laptopIndexes) remove(laptop *pb.Laptop) {
+	for _, index := range indexes.all() {
+		index.remove(laptop)
+	}
+}
+
+// plan returns the range of the most selective index for the filter,
+// or false if no index is better than a full scan.
+// The range may contain laptops not matching the filter, so they must be checked again
+func (indexes *laptopIndexes) plan(filter *pb.Filter) (indexRange, bool) {
+	var ranges []indexRange
+	if filter.GetMinPriceUsd() > 0 || filter.GetMaxPriceUsd() > 0 {
+		max := math.Inf(1)
+		if filter.GetMaxPriceUsd() > 0 {
+			max = filter.GetMaxPriceUsd()
+		}
+		ranges = append(ranges, indexRange{indexes.priceUsd, filter.GetMinPriceUsd(), max})
+	}
+	if filter.GetMinCpuCores() > 0 {
+		ranges = append(ranges, indexRange{indexes.cpuCores, float64(filter.GetMinCpuCores()), math.Inf(1)})
+	}
+	if filter.GetMinCpuGhz() > 0 {
+		ranges = append(ranges, indexRange{indexes.cpuGhz, filter.GetMinCpuGhz(), math.Inf(1)})
+	}
+	if ram := toBit(filter.GetMinRam()); ram > 0 {
+		ranges = append(ranges, indexRange{indexes.ram, float64(ram), math.Inf(1)})
+	}
+
+	best, found := indexRange{}, false
+	bestCount := indexes.priceUsd.size
+	for _, r := range ranges {
+		if count := r.count(); count < bestCount {
+			best, found, bestCount = r, true, count
+		}
+	}
+	return best, found
+}
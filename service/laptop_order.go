@@ -0,0 +1,213 @@
+package service
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"pcbook/pb"
+	"strings"
+)
+
+// laptopOrderKeys maps the supported order_by fields to their sort key
+var laptopOrderKeys = map[string]func(laptop *pb.Laptop) float64{
+	"id": func(laptop *pb.Laptop) float64 {
+		return 0
+	},
+	"price_usd": func(laptop *pb.Laptop) float64 {
+		return laptop.GetPriceUsd()
+	},
+	"release_year": func(laptop *pb.Laptop) float64 {
+		return float64(laptop.GetReleaseYear())
+	},
+	"cpu.number_cores": func(laptop *pb.Laptop) float64 {
+		return float64(laptop.GetCpu().GetNumberCores())
+	},
+	"ram": func(laptop *pb.Laptop) float64 {
+		return float64(toBit(laptop.GetRam()))
+	},
+	"updated_at": func(laptop *pb.Laptop) float64 {
+		return float64(laptop.GetUpdatedAt().AsTime().UnixMicro())
+	},
+}
+
+// ratingOrderKeys maps the order_by fields of the rating summaries to their sort key,
+// they are not supported by LaptopStore.List
+var ratingOrderKeys = map[string]func(summary *RatingSummary) float64{
+	"rated_count": func(summary *RatingSummary) float64 {
+		return float64(summary.Count)
+	},
+	"average_rating": func(summary *RatingSummary) float64 {
+		return summary.Average
+	},
+	"median_rating": func(summary *RatingSummary) float64 {
+		return summary.Median
+	},
+	"bayesian_rating": func(summary *RatingSummary) float64 {
+		return summary.BayesianAverage
+	},
+	"decayed_rating": func(summary *RatingSummary) float64 {
+		return summary.DecayedScore
+	},
+}
+
+// LaptopOrder is the order of listed laptops, ties are broken by id
+type LaptopOrder struct {
+	Field string
+	Desc  bool
+}
+
+// ParseLaptopOrder parses an order_by string like "price_usd desc", an empty string means by id
+func ParseLaptopOrder(orderBy string) (LaptopOrder, error) {
+	parts := strings.Fields(orderBy)
+	if len(parts) == 0 {
+		return LaptopOrder{Field: "id"}, nil
+	}
+
+	order := LaptopOrder{Field: parts[0]}
+	if _, ok := laptopOrderKeys[order.Field]; !ok && !order.byRating() {
+		return LaptopOrder{}, fmt.Errorf("cannot order by %q", order.Field)
+	}
+
+	if len(parts) > 2 {
+		return LaptopOrder{}, fmt.Errorf("invalid order %q", orderBy)
+	}
+	if len(parts) == 2 {
+		switch strings.ToLower(parts[1]) {
+		case "asc":
+		case "desc":
+			order.Desc = true
+		default:
+			return LaptopOrder{}, fmt.Errorf("invalid order direction %q", parts[1])
+		}
+	}
+	return order, nil
+}
+
+func (order LaptopOrder) String() string {
+	if order.Desc {
+		return order.Field + " desc"
+	}
+	return order.Field
+}
+
+// byRating tells if the order is by a key of the rating summaries
+func (order LaptopOrder) byRating() bool {
+	_, ok := ratingOrderKeys[order.Field]
+	return ok
+}
+
+func (order LaptopOrder) key(laptop *pb.Laptop) float64 {
+	keyFunc, ok := laptopOrderKeys[order.Field]
+	if !ok {
+		return 0
+	}
+	return keyFunc(laptop)
+}
+
+// less reports whether the laptop with key1 and id1 goes before the one with key2 and id2
+func (order LaptopOrder) less(key1 float64, id1 string, key2 float64, id2 string) bool {
+	if key1 != key2 {
+		return (key1 < key2) != order.Desc
+	}
+	return id1 < id2
+}
+
+type rankedLaptop struct {
+	key    float64
+	laptop *pb.Laptop
+}
+
+// laptopTopK keeps the first k laptops in order, the last one of them on top of the heap
+type laptopTopK struct {
+	order   LaptopOrder
+	k       int
+	laptops []rankedLaptop
+}
+
+func newLaptopTopK(order LaptopOrder, k int) *laptopTopK {
+	return &laptopTopK{order: order, k: k}
+}
+
+func (topK *laptopTopK) Len() int {
+	return len(topK.laptops)
+}
+
+func (topK *laptopTopK) Less(i, j int) bool {
+	a, b := topK.laptops[i], topK.laptops[j]
+	return topK.order.less(b.key, b.laptop.GetId(), a.key, a.laptop.GetId())
+}
+
+func (topK *laptopTopK) Swap(i, j int) {
+	topK.laptops[i], topK.laptops[j] = topK.laptops[j], topK.laptops[i]
+}
+
+func (topK *laptopTopK) Push(x interface{}) {
+	topK.laptops = append(topK.laptops, x.(rankedLaptop))
+}
+
+func (topK *laptopTopK) Pop() interface{} {
+	n := len(topK.laptops)
+	last := topK.laptops[n-1]
+	topK.laptops = topK.laptops[:n-1]
+	return last
+}
+
+// Add offers a laptop with its sort key, a k of zero keeps every laptop
+func (topK *laptopTopK) Add(key float64, laptop *pb.Laptop) {
+	if topK.k <= 0 || topK.Len() < topK.k {
+		heap.Push(topK, rankedLaptop{key: key, laptop: laptop})
+		return
+	}
+
+	last := topK.laptops[0]
+	if topK.order.less(key, laptop.GetId(), last.key, last.laptop.GetId()) {
+		topK.laptops[0] = rankedLaptop{key: key, laptop: laptop}
+		heap.Fix(topK, 0)
+	}
+}
+
+// Sorted returns the kept laptops in order
+func (topK *laptopTopK) Sorted() []*pb.Laptop {
+	sorted := make([]*pb.Laptop, topK.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(topK).(rankedLaptop).laptop
+	}
+	return sorted
+}
+
+// LaptopCursor points to the last laptop of a page
+type LaptopCursor struct {
+	Order string  `json:"o"`
+	Key   float64 `json:"k"`
+	ID    string  `json:"id"`
+}
+
+func newLaptopCursor(order LaptopOrder, laptop *pb.Laptop) *LaptopCursor {
+	return &LaptopCursor{
+		Order: order.String(),
+		Key:   order.key(laptop),
+		ID:    laptop.GetId(),
+	}
+}
+
+// Encode returns the cursor as an opaque page token
+func (cursor *LaptopCursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeLaptopCursor parses a page token made by LaptopCursor.Encode
+func DecodeLaptopCursor(token string) (*LaptopCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	cursor := &LaptopCursor{}
+	err = json.Unmarshal(data, cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+	return cursor, nil
+}
@@ -1,228 +1,1139 @@
-package service
-
-import (
-	"bytes"
-	"context"
-	"errors"
-	"io"
-	"log"
-	"pcbook/pb"
-
-	"github.com/google/uuid"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-)
-
-//maxsize 1MB
-const maxImageSize = 1 << 20
-
-type LaptopServer struct {
-	laptopStore LaptopStore
-	imageStore  ImageStore
-	ratingStore RatingStore
-}
-
-func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore) *LaptopServer {
-	return &LaptopServer{laptopStore: laptopStore, imageStore: imageStore, ratingStore: ratingStore}
-}
-
-func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLaptopRequest) (*pb.CreateLaptopResponse, error) {
-	laptop := req.GetLaptop()
-	log.Printf("receive a create-laptop request with id: %s", laptop.Id)
-
-	if len(laptop.Id) > 0 {
-		//check if the laptop id is valid
-		_, err := uuid.Parse(laptop.Id)
-		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "laptop ID is invalid: %v", err)
-		}
-	} else {
-		id, err := uuid.NewRandom()
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, "cannot generate a new laotop ID: %v", err)
-		}
-		laptop.Id = id.String()
-	}
-
-	//heavy processing
-	switch ctx.Err() {
-	case context.Canceled:
-		log.Print("CreateLaptop request is cancelled")
-		return nil, status.Errorf(codes.Canceled, "CreateLaptop request is cancelled")
-	case context.DeadlineExceeded:
-		log.Print("CreateLaptop request is timed out")
-		return nil, status.Errorf(codes.DeadlineExceeded, "CreateLaptop request is timed out")
-	default:
-	}
-
-	//save the laptop to store
-	err := server.laptopStore.Save(laptop)
-	if err != nil {
-		code := codes.Internal
-		if errors.Is(err, ErrAlreadyExists) {
-			code = codes.AlreadyExists
-		}
-		return nil, status.Errorf(code, "cannot save laptop to store: %v", err)
-	}
-
-	log.Printf("laptop with id: %s is saved to store", laptop.Id)
-
-	res := &pb.CreateLaptopResponse{
-		Id: laptop.Id,
-	}
-
-	return res, nil
-}
-
-func (server *LaptopServer) SearchLaptop(req *pb.SearchLaptopRequest, stream pb.LaptopService_SearchLaptopServer) error {
-	filter := req.GetFilter()
-	log.Printf("receive a search-laptop request with filter: %v", filter)
-
-	err := server.laptopStore.Search(stream.Context(), filter, func(laptop *pb.Laptop) error {
-		res := &pb.SearchLaptopResponse{Laptop: laptop}
-
-		err := stream.Send(res)
-		if err != nil {
-			return err
-		}
-
-		log.Printf("send laptop with id: %s to client", laptop.GetId())
-		return nil
-	})
-	if err != nil {
-		return status.Errorf(codes.Internal, "cannot search laptop from store: %v", err)
-	}
-	return nil
-}
-
-func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServer) error {
-	req, err := stream.Recv()
-	if err != nil {
-		log.Print(err)
-		return status.Error(codes.Unknown, "cannot receive image")
-	}
-
-	laptopId := req.GetInfo().GetLaptopId()
-	laptopType := req.GetInfo().GetImageType()
-	log.Printf("receive a image upload request with laptopId: %s, imageType: %s", laptopId, laptopType)
-
-	laptop, err := server.laptopStore.Find(laptopId)
-	if err != nil {
-		log.Print(err)
-		return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
-	}
-	if laptop == nil {
-		log.Print(err)
-		return status.Errorf(codes.InvalidArgument, "laptop with id: %s is not found", laptopId)
-	}
-
-	imageData := new(bytes.Buffer)
-	imageSize := 0
-	for {
-		if err := contextError(stream.Context()); err != nil {
-			return err
-		}
-
-		req, err := stream.Recv()
-		if err == io.EOF {
-			log.Print("receive all image data")
-			break
-		} else if err != nil {
-			return status.Error(codes.Unknown, "cannot receive image")
-		}
-
-		chunk := req.GetChunkData()
-		imageSize += len(chunk)
-		// log.Printf("receive a image chunk with size: %d", len(chunk)) //debug
-		if imageSize > maxImageSize {
-			log.Print("image size is too large")
-			return status.Error(codes.InvalidArgument, "image size is too large")
-		}
-		// time.Sleep(time.Second) //debug
-		_, err = imageData.Write(chunk)
-		if err != nil {
-			log.Print(err)
-			return status.Error(codes.Internal, "cannot write image data")
-		}
-	}
-	imageId, err := server.imageStore.Save(laptopId, laptopType, imageData)
-	if err != nil {
-		log.Print(err)
-		return status.Errorf(codes.Internal, "cannot save image to store: %v", err)
-	}
-
-	res := &pb.UploadImageResponse{
-		Id:   imageId,
-		Size: uint32(imageSize),
-	}
-
-	err = stream.SendAndClose(res)
-	if err != nil {
-		log.Print(err)
-		return status.Errorf(codes.Unknown, "cannot send response to client: %v", err)
-	}
-	log.Printf("saved image with id: %s, size%d", imageId, imageSize)
-	return nil
-}
-
-func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer) error {
-	for {
-		err := contextError(stream.Context())
-		if err != nil {
-			return err
-		}
-
-		req, err := stream.Recv()
-		if err == io.EOF {
-			log.Print("receive all ratings")
-			break
-		} else if err != nil {
-			log.Printf("cannot receive rating: %v", err)
-			return status.Errorf(codes.Unknown, "cannot receive request: %v", err)
-		}
-
-		laptopId := req.GetLaptopId()
-		rating := req.GetRating()
-		log.Printf("receive a rating request with laptopId: %s, rating: %f", laptopId, rating)
-
-		found, err := server.laptopStore.Find(laptopId)
-		if err != nil {
-			log.Print(err)
-			return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
-		}
-		if found == nil {
-			log.Print(err)
-			return status.Errorf(codes.NotFound, "laptop with id: %s is not found", laptopId)
-		}
-
-		r, err := server.ratingStore.Add(laptopId, rating)
-		if err != nil {
-			log.Print(err)
-			return status.Errorf(codes.Internal, "cannot add rating: %v", err)
-		}
-		res := &pb.RateLaptopResponse{
-			LaptopId:      laptopId,
-			RatedCount:    r.Count,
-			AverageRating: r.Sum / float64(r.Count),
-		}
-		err = stream.Send(res)
-		if err != nil {
-			log.Print(err)
-			return status.Errorf(codes.Unknown, "cannot send response to client: %v", err)
-		}
-	}
-	return nil
-}
-
-func contextError(ctx context.Context) error {
-	switch ctx.Err() {
-	case context.Canceled:
-		log.Print("request is cancelled")
-		return status.Errorf(codes.Canceled, "request is cancelled")
-	case context.DeadlineExceeded:
-		log.Print("request is timed out")
-		return status.Errorf(codes.DeadlineExceeded, "deadline is exceeded")
-	default:
-		return nil
-	}
-}
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"pcbook/expr"
+	"pcbook/pb"
+	"pcbook/validation"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// imageChunkSize is the size of the data chunks of DownloadImage
+const imageChunkSize = 64 << 10
+
+const (
+	defaultPageSize     = 50
+	maxPageSize         = 1000
+	defaultSuggestLimit = 10
+)
+
+type LaptopServer struct {
+	laptopStore LaptopStore
+	imageStore  ImageStore
+	ratingStore RatingStore
+	// uploadStore keeps the resumable uploads, they are not supported if it is nil
+	uploadStore  *UploadSessionStore
+	reviewStore  ReviewStore
+	ratingConfig RatingConfig
+}
+
+type LaptopServerConfig struct {
+	// UploadStore keeps the resumable uploads, they are not supported if it is nil
+	UploadStore *UploadSessionStore
+	// ReviewStore keeps the reviews, which are deleted with their laptop if it is set
+	ReviewStore ReviewStore
+	Rating      RatingConfig
+}
+
+func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore) *LaptopServer {
+	return NewLaptopServerWithConfig(laptopStore, imageStore, ratingStore, LaptopServerConfig{})
+}
+
+func NewLaptopServerWithUploads(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore, uploadStore *UploadSessionStore) *LaptopServer {
+	return NewLaptopServerWithConfig(laptopStore, imageStore, ratingStore, LaptopServerConfig{UploadStore: uploadStore})
+}
+
+func NewLaptopServerWithConfig(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore, config LaptopServerConfig) *LaptopServer {
+	return &LaptopServer{
+		laptopStore:  laptopStore,
+		imageStore:   imageStore,
+		ratingStore:  ratingStore,
+		uploadStore:  config.UploadStore,
+		reviewStore:  config.ReviewStore,
+		ratingConfig: config.Rating.withDefaults(),
+	}
+}
+
+func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLaptopRequest) (*pb.CreateLaptopResponse, error) {
+	laptop := req.GetLaptop()
+	log.Printf("receive a create-laptop request with id: %s", laptop.Id)
+
+	err := assignLaptopID(laptop)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validation.ValidateLaptop(laptop).Err("laptop")
+	if err != nil {
+		return nil, err
+	}
+
+	//heavy processing
+	switch ctx.Err() {
+	case context.Canceled:
+		log.Print("CreateLaptop request is cancelled")
+		return nil, status.Errorf(codes.Canceled, "CreateLaptop request is cancelled")
+	case context.DeadlineExceeded:
+		log.Print("CreateLaptop request is timed out")
+		return nil, status.Errorf(codes.DeadlineExceeded, "CreateLaptop request is timed out")
+	default:
+	}
+
+	//save the laptop to store
+	err = server.laptopStore.Save(laptop)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrAlreadyExists) {
+			code = codes.AlreadyExists
+		}
+		return nil, status.Errorf(code, "cannot save laptop to store: %v", err)
+	}
+
+	log.Printf("laptop with id: %s is saved to store", laptop.Id)
+
+	res := &pb.CreateLaptopResponse{
+		Id: laptop.Id,
+	}
+
+	return res, nil
+}
+
+// assignLaptopID checks the id of the laptop, or generates one if it is empty
+func assignLaptopID(laptop *pb.Laptop) error {
+	if len(laptop.Id) > 0 {
+		//check if the laptop id is valid
+		_, err := uuid.Parse(laptop.Id)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "laptop ID is invalid: %v", err)
+		}
+	} else {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot generate a new laotop ID: %v", err)
+		}
+		laptop.Id = id.String()
+	}
+	return nil
+}
+
+func (server *LaptopServer) BulkCreateLaptops(stream pb.LaptopService_BulkCreateLaptopsServer) error {
+	var atomic bool
+	var laptops []*pb.Laptop
+	res := &pb.BulkCreateLaptopsResponse{}
+
+	for i := 0; ; i++ {
+		err := contextError(stream.Context())
+		if err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Printf("cannot receive laptop: %v", err)
+			return status.Errorf(codes.Unknown, "cannot receive request: %v", err)
+		}
+
+		if options := req.GetOptions(); options != nil {
+			if i > 0 {
+				return status.Errorf(codes.InvalidArgument, "options must be sent before the first laptop")
+			}
+			atomic = options.GetAtomic()
+			log.Printf("receive a bulk-create-laptops request with atomic: %t", atomic)
+			continue
+		}
+
+		laptop := req.GetLaptop()
+		if laptop == nil {
+			return status.Errorf(codes.InvalidArgument, "laptop is missing")
+		}
+
+		// the laptops after a failure of an atomic batch are still checked,
+		// so that every result has the id of its laptop and its own error
+		result := &pb.BulkCreateResult{}
+		res.Results = append(res.Results, result)
+
+		err = assignLaptopID(laptop)
+		if err == nil {
+			err = validation.ValidateLaptop(laptop).Err("laptop")
+		}
+		if err == nil && !atomic {
+			err = server.laptopStore.Save(laptop)
+			if err != nil {
+				code := codes.Internal
+				if errors.Is(err, ErrAlreadyExists) {
+					code = codes.AlreadyExists
+				}
+				err = status.Errorf(code, "cannot save laptop to store: %v", err)
+			}
+		}
+		result.Id = laptop.GetId()
+		result.Status = status.Convert(err).Proto()
+		if err == nil {
+			laptops = append(laptops, laptop)
+		}
+	}
+
+	if atomic {
+		failed := len(laptops) < len(res.Results)
+		if !failed {
+			i, err := server.laptopStore.SaveAll(laptops)
+			if err != nil {
+				code := codes.Internal
+				if errors.Is(err, ErrAlreadyExists) {
+					code = codes.AlreadyExists
+				}
+				res.Results[i].Status = status.Newf(code, "cannot save laptop to store: %v", err).Proto()
+				failed = true
+			}
+		}
+		if failed {
+			for _, result := range res.Results {
+				if result.Status.GetCode() == int32(codes.OK) {
+					result.Status = status.New(codes.Aborted, "batch is rolled back").Proto()
+				}
+			}
+			laptops = nil
+		}
+	}
+
+	res.CreatedCount = uint32(len(laptops))
+	log.Printf("%d of %d laptops are saved to store", res.CreatedCount, len(res.Results))
+	return stream.SendAndClose(res)
+}
+
+func (server *LaptopServer) GetLaptop(ctx context.Context, req *pb.GetLaptopRequest) (*pb.GetLaptopResponse, error) {
+	laptopId := req.GetId()
+	log.Printf("receive a get-laptop request with id: %s", laptopId)
+
+	laptop, err := server.laptopStore.Find(laptopId)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find laptop: %v", err)
+	}
+
+	return &pb.GetLaptopResponse{Laptop: laptop}, nil
+}
+
+func (server *LaptopServer) ListLaptops(ctx context.Context, req *pb.ListLaptopsRequest) (*pb.ListLaptopsResponse, error) {
+	log.Printf("receive a list-laptops request with page_size: %d, order_by: %q", req.GetPageSize(), req.GetOrderBy())
+
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page size must not be negative")
+	} else if pageSize == 0 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	order, err := ParseLaptopOrder(req.GetOrderBy())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "order_by is invalid: %v", err)
+	}
+	if order.byRating() {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot list laptops by %s", order.Field)
+	}
+
+	var cursor *LaptopCursor
+	if len(req.GetPageToken()) > 0 {
+		cursor, err = DecodeLaptopCursor(req.GetPageToken())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if cursor.Order != order.String() {
+			return nil, status.Errorf(codes.InvalidArgument, "page token does not match order_by %q", order)
+		}
+	}
+
+	laptops, err := server.laptopStore.List(ctx, order, cursor, pageSize+1)
+	if err != nil {
+		if err := contextError(ctx); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "cannot list laptops from store: %v", err)
+	}
+
+	res := &pb.ListLaptopsResponse{}
+	if len(laptops) > pageSize {
+		laptops = laptops[:pageSize]
+		res.NextPageToken = newLaptopCursor(order, laptops[pageSize-1]).Encode()
+	}
+	res.Laptops = laptops
+
+	return res, nil
+}
+
+func (server *LaptopServer) UpdateLaptop(ctx context.Context, req *pb.UpdateLaptopRequest) (*pb.UpdateLaptopResponse, error) {
+	laptop := req.GetLaptop()
+	paths := req.GetUpdateMask().GetPaths()
+	log.Printf("receive a update-laptop request with id: %s, paths: %v", laptop.GetId(), paths)
+
+	_, err := uuid.Parse(laptop.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "laptop ID is invalid: %v", err)
+	}
+
+	err = validateFieldMask(laptop, paths)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "update mask is invalid: %v", err)
+	}
+
+	// validate the result of the update, the store rejects it if the laptop has changed since
+	found, err := server.laptopStore.Find(laptop.GetId())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find laptop: %v", err)
+	}
+	err = applyFieldMask(found, laptop, paths)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "update mask is invalid: %v", err)
+	}
+	err = validation.ValidateLaptop(found).Err("laptop")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	updated, err := server.laptopStore.Update(laptop, paths)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		} else if errors.Is(err, ErrConflict) {
+			code = codes.Aborted
+		}
+		return nil, status.Errorf(code, "cannot update laptop: %v", err)
+	}
+
+	log.Printf("laptop with id: %s is updated", updated.Id)
+
+	res := &pb.UpdateLaptopResponse{
+		Laptop: updated,
+	}
+
+	return res, nil
+}
+
+func (server *LaptopServer) DeleteLaptop(ctx context.Context, req *pb.DeleteLaptopRequest) (*pb.DeleteLaptopResponse, error) {
+	laptopId := req.GetId()
+	log.Printf("receive a delete-laptop request with id: %s", laptopId)
+
+	deletedBy := ""
+	if claims, ok := UserClaimsFromContext(ctx); ok {
+		deletedBy = claims.Username
+	}
+
+	// the images, ratings and reviews are deleted before the laptop, so that a failed deletion can be retried
+	_, err := server.laptopStore.Find(laptopId)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find laptop: %v", err)
+	}
+
+	err = server.imageStore.DeleteByLaptop(laptopId)
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(codes.Internal, "cannot delete laptop images: %v", err)
+	}
+
+	err = server.ratingStore.Delete(laptopId)
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(codes.Internal, "cannot delete laptop ratings: %v", err)
+	}
+
+	if server.reviewStore != nil {
+		err = server.reviewStore.DeleteByLaptop(laptopId)
+		if err != nil {
+			log.Print(err)
+			return nil, status.Errorf(codes.Internal, "cannot delete laptop reviews: %v", err)
+		}
+	}
+
+	err = server.laptopStore.Delete(laptopId, deletedBy)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete laptop: %v", err)
+	}
+
+	log.Printf("laptop with id: %s is deleted by: %s", laptopId, deletedBy)
+	return &pb.DeleteLaptopResponse{}, nil
+}
+
+func (server *LaptopServer) PurgeDeleted(ctx context.Context, req *pb.PurgeDeletedRequest) (*pb.PurgeDeletedResponse, error) {
+	olderThan := req.GetOlderThan().AsDuration()
+	log.Printf("receive a purge-deleted request with older_than: %v", olderThan)
+
+	if olderThan < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "older_than must not be negative")
+	}
+
+	purged, err := server.laptopStore.PurgeDeleted(time.Now().Add(-olderThan))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot purge deleted laptops: %v", err)
+	}
+
+	log.Printf("purged %d deleted laptops", purged)
+	return &pb.PurgeDeletedResponse{PurgedCount: uint32(purged)}, nil
+}
+
+func (server *LaptopServer) SearchLaptop(req *pb.SearchLaptopRequest, stream pb.LaptopService_SearchLaptopServer) error {
+	filter := req.GetFilter()
+	log.Printf("receive a search-laptop request with filter: %v, expression: %q, order_by: %q, max_results: %d",
+		filter, req.GetExpression(), req.GetOrderBy(), req.GetMaxResults())
+
+	send := func(laptop *pb.Laptop) error {
+		res := &pb.SearchLaptopResponse{Laptop: laptop}
+
+		err := stream.Send(res)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("send laptop with id: %s to client", laptop.GetId())
+		return nil
+	}
+
+	var program *expr.Program
+	if len(req.GetExpression()) > 0 {
+		var err error
+		program, err = expr.Compile(req.GetExpression(), (&pb.Laptop{}).ProtoReflect().Descriptor())
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "expression is invalid: %v", err)
+		}
+	}
+
+	maxResults := int(req.GetMaxResults())
+	if len(req.GetOrderBy()) == 0 && maxResults == 0 {
+		err := server.laptopStore.Search(stream.Context(), filter, program, send)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot search laptop from store: %v", err)
+		}
+		return nil
+	}
+
+	// a limited search without order_by returns the first laptops by id, not an arbitrary subset
+	order, err := ParseLaptopOrder(req.GetOrderBy())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "order_by is invalid: %v", err)
+	}
+
+	topK := newLaptopTopK(order, maxResults)
+	now := time.Now()
+	err = server.laptopStore.Search(stream.Context(), filter, program, func(laptop *pb.Laptop) error {
+		key, err := server.searchKey(order, laptop, now)
+		if err != nil {
+			return err
+		}
+		topK.Add(key, laptop)
+		return nil
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot search laptop from store: %v", err)
+	}
+
+	for _, laptop := range topK.Sorted() {
+		err := send(laptop)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchKey returns the sort key of a laptop, including the keys of the rating summary at the time
+func (server *LaptopServer) searchKey(order LaptopOrder, laptop *pb.Laptop, now time.Time) (float64, error) {
+	if !order.byRating() {
+		return order.key(laptop), nil
+	}
+
+	summary, err := server.ratingSummary(laptop.GetId(), now)
+	if err != nil {
+		return 0, err
+	}
+	return ratingOrderKeys[order.Field](summary), nil
+}
+
+// ratingSummary returns the summary of the ratings of a laptop at the time
+func (server *LaptopServer) ratingSummary(laptopId string, now time.Time) (*RatingSummary, error) {
+	rating, err := server.ratingStore.Find(laptopId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find rating: %w", err)
+	}
+	ratings, err := server.ratingStore.ListByLaptop(laptopId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list ratings: %w", err)
+	}
+	return server.ratingConfig.summarize(rating, ratings, now), nil
+}
+
+func (server *LaptopServer) TextSearchLaptop(req *pb.TextSearchLaptopRequest, stream pb.LaptopService_TextSearchLaptopServer) error {
+	log.Printf("receive a text-search-laptop request with query: %q, filter: %v", req.GetQuery(), req.GetFilter())
+
+	err := server.laptopStore.TextSearch(stream.Context(), req.GetQuery(), req.GetFilter(), int(req.GetMaxResults()), func(laptop *pb.Laptop, score float64) error {
+		res := &pb.TextSearchLaptopResponse{Laptop: laptop, Score: score}
+
+		err := stream.Send(res)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("send laptop with id: %s, score: %f to client", laptop.GetId(), score)
+		return nil
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot search laptop from store: %v", err)
+	}
+	return nil
+}
+
+func (server *LaptopServer) Suggest(ctx context.Context, req *pb.SuggestRequest) (*pb.SuggestResponse, error) {
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultSuggestLimit
+	}
+
+	suggestions, err := server.laptopStore.Suggest(req.GetPrefix(), limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot suggest from store: %v", err)
+	}
+
+	return &pb.SuggestResponse{Suggestions: suggestions}, nil
+}
+
+func (server *LaptopServer) AggregateLaptops(ctx context.Context, req *pb.AggregateLaptopsRequest) (*pb.AggregateLaptopsResponse, error) {
+	log.Printf("receive a aggregate-laptops request with filter: %v, facets: %v", req.GetFilter(), req.GetFacets())
+
+	facets := make([]facet, len(req.GetFacets()))
+	for i, spec := range req.GetFacets() {
+		var err error
+		facets[i], err = parseFacet(spec)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "facet is invalid: %v", err)
+		}
+	}
+
+	res := &pb.AggregateLaptopsResponse{}
+	err := server.laptopStore.Search(ctx, req.GetFilter(), nil, func(laptop *pb.Laptop) error {
+		res.TotalCount++
+		for _, facet := range facets {
+			facet.add(laptop)
+		}
+		return nil
+	})
+	if err != nil {
+		if err := contextError(ctx); err != nil {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "cannot aggregate laptops from store: %v", err)
+	}
+
+	for _, facet := range facets {
+		res.Facets = append(res.Facets, facet.result())
+	}
+	return res, nil
+}
+
+func (server *LaptopServer) WatchLaptops(req *pb.WatchLaptopsRequest, stream pb.LaptopService_WatchLaptopsServer) error {
+	log.Printf("receive a watch-laptops request with filter: %v, start revision: %d", req.GetFilter(), req.GetStartRevision())
+
+	err := server.laptopStore.Watch(stream.Context(), req.GetStartRevision(), req.GetFilter(), func(event *LaptopEvent) error {
+		res := &pb.WatchLaptopsResponse{
+			Event: &pb.LaptopEvent{
+				Revision: event.Revision,
+				Type:     event.Type,
+				Laptop:   event.Laptop,
+				Time:     timestamppb.New(event.Time),
+			},
+		}
+		err := stream.Send(res)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("sent %v event of laptop with id: %s, revision: %d", event.Type, event.Laptop.GetId(), event.Revision)
+		return nil
+	})
+	if errors.Is(err, ErrRevisionExpired) || errors.Is(err, ErrFutureRevision) {
+		return status.Errorf(codes.OutOfRange, "cannot watch from revision %d: %v", req.GetStartRevision(), err)
+	}
+	if err := contextError(stream.Context()); err != nil {
+		return err
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot watch laptops: %v", err)
+	}
+	return nil
+}
+
+func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		log.Print(err)
+		return status.Error(codes.Unknown, "cannot receive image")
+	}
+
+	laptopId := req.GetInfo().GetLaptopId()
+	laptopType := req.GetInfo().GetImageType()
+	log.Printf("receive a image upload request with laptopId: %s, imageType: %s", laptopId, laptopType)
+
+	laptop, err := server.laptopStore.Find(laptopId)
+	if err != nil {
+		log.Print(err)
+		return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+	}
+	if laptop == nil {
+		log.Print(err)
+		return status.Errorf(codes.InvalidArgument, "laptop with id: %s is not found", laptopId)
+	}
+
+	uploadedBy := ""
+	if claims, ok := UserClaimsFromContext(stream.Context()); ok {
+		uploadedBy = claims.Username
+	}
+
+	imageData := &imageUploadReader{stream: stream, hash: sha256.New(), digest: req.GetInfo().GetSha256()}
+	imageId, err := server.imageStore.Save(laptopId, laptopType, imageData, uploadedBy)
+	if imageData.err != nil {
+		return imageData.err
+	}
+	if errors.Is(err, ErrImageTooLarge) {
+		log.Print(err)
+		return status.Errorf(codes.InvalidArgument, "image size is too large: %v", err)
+	}
+	if errors.Is(err, ErrInvalidImage) {
+		log.Print(err)
+		return status.Errorf(codes.InvalidArgument, "image is invalid: %v", err)
+	}
+	if err != nil {
+		log.Print(err)
+		return status.Errorf(codes.Internal, "cannot save image to store: %v", err)
+	}
+	log.Print("receive all image data")
+	imageSize := imageData.size
+
+	res := &pb.UploadImageResponse{
+		Id:     imageId,
+		Size:   uint32(imageSize),
+		Sha256: hex.EncodeToString(imageData.hash.Sum(nil)),
+	}
+
+	err = stream.SendAndClose(res)
+	if err != nil {
+		log.Print(err)
+		return status.Errorf(codes.Unknown, "cannot send response to client: %v", err)
+	}
+	log.Printf("saved image with id: %s, size%d", imageId, imageSize)
+	return nil
+}
+
+func (server *LaptopServer) StartUpload(ctx context.Context, req *pb.StartUploadRequest) (*pb.StartUploadResponse, error) {
+	if server.uploadStore == nil {
+		return nil, status.Error(codes.Unimplemented, "resumable uploads are not enabled")
+	}
+
+	laptopId := req.GetInfo().GetLaptopId()
+	imageType := req.GetInfo().GetImageType()
+	log.Printf("receive a start-upload request with laptopId: %s, imageType: %s", laptopId, imageType)
+
+	_, err := server.laptopStore.Find(laptopId)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find laptop: %v", err)
+	}
+
+	uploadedBy := ""
+	if claims, ok := UserClaimsFromContext(ctx); ok {
+		uploadedBy = claims.Username
+	}
+
+	session, err := server.uploadStore.Start(laptopId, imageType, uploadedBy)
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(codes.Internal, "cannot start upload: %v", err)
+	}
+
+	res := &pb.StartUploadResponse{
+		UploadId:  session.ID,
+		ExpiresAt: timestamppb.New(session.ExpiresAt),
+	}
+	return res, nil
+}
+
+func (server *LaptopServer) UploadChunks(stream pb.LaptopService_UploadChunksServer) error {
+	if server.uploadStore == nil {
+		return status.Error(codes.Unimplemented, "resumable uploads are not enabled")
+	}
+
+	var committed int64
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Print(err)
+			return status.Error(codes.Unknown, "cannot receive chunk")
+		}
+
+		committed, err = server.uploadStore.Write(req.GetUploadId(), int64(req.GetOffset()), req.GetChunkData())
+		if err != nil {
+			log.Print(err)
+			return status.Errorf(uploadErrorCode(err), "cannot write chunk: %v", err)
+		}
+	}
+
+	return stream.SendAndClose(&pb.UploadChunksResponse{CommittedSize: uint64(committed)})
+}
+
+func (server *LaptopServer) QueryUpload(ctx context.Context, req *pb.QueryUploadRequest) (*pb.QueryUploadResponse, error) {
+	if server.uploadStore == nil {
+		return nil, status.Error(codes.Unimplemented, "resumable uploads are not enabled")
+	}
+
+	session, err := server.uploadStore.Find(req.GetUploadId())
+	if err != nil {
+		return nil, status.Errorf(uploadErrorCode(err), "cannot find upload: %v", err)
+	}
+
+	res := &pb.QueryUploadResponse{
+		CommittedSize: uint64(session.Size),
+		ExpiresAt:     timestamppb.New(session.ExpiresAt),
+	}
+	return res, nil
+}
+
+func (server *LaptopServer) FinishUpload(ctx context.Context, req *pb.FinishUploadRequest) (*pb.FinishUploadResponse, error) {
+	if server.uploadStore == nil {
+		return nil, status.Error(codes.Unimplemented, "resumable uploads are not enabled")
+	}
+
+	uploadId := req.GetUploadId()
+	log.Printf("receive a finish-upload request with uploadId: %s, size: %d", uploadId, req.GetSize())
+
+	var imageId string
+	err := server.uploadStore.Finish(uploadId, int64(req.GetSize()), req.GetSha256(), func(session *UploadSession, data io.Reader) error {
+		var err error
+		imageId, err = server.imageStore.Save(session.LaptopID, session.ImageType, data, session.UploadedBy)
+		return err
+	})
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(uploadErrorCode(err), "cannot finish upload: %v", err)
+	}
+
+	image, err := server.imageStore.Find(imageId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find image: %v", err)
+	}
+
+	log.Printf("saved image with id: %s, size: %d", imageId, image.Size)
+	return &pb.FinishUploadResponse{Image: toImageProto(image)}, nil
+}
+
+// uploadErrorCode returns the status code of an upload session error
+func uploadErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, ErrOffsetMismatch):
+		return codes.OutOfRange
+	case errors.Is(err, ErrImageTooLarge), errors.Is(err, ErrInvalidImage):
+		return codes.InvalidArgument
+	case errors.Is(err, ErrSizeMismatch):
+		return codes.FailedPrecondition
+	case errors.Is(err, ErrChecksumMismatch):
+		return codes.DataLoss
+	default:
+		return codes.Internal
+	}
+}
+
+// imageUploadReader reads the image data from the chunks of an upload stream and hashes it,
+// at the end it fails if the data does not match the expected digest. err keeps the status of a failure
+type imageUploadReader struct {
+	stream pb.LaptopService_UploadImageServer
+	chunk  []byte
+	size   int
+	hash   hash.Hash
+	digest string
+	err    error
+}
+
+func (reader *imageUploadReader) Read(p []byte) (int, error) {
+	for len(reader.chunk) == 0 {
+		if err := contextError(reader.stream.Context()); err != nil {
+			reader.err = err
+			return 0, err
+		}
+
+		req, err := reader.stream.Recv()
+		if err == io.EOF {
+			digest := hex.EncodeToString(reader.hash.Sum(nil))
+			if reader.digest != "" && !strings.EqualFold(reader.digest, digest) {
+				reader.err = status.Errorf(codes.DataLoss, "image digest %s does not match the expected %s", digest, reader.digest)
+				return 0, ErrChecksumMismatch
+			}
+			return 0, io.EOF
+		} else if err != nil {
+			log.Print(err)
+			reader.err = status.Error(codes.Unknown, "cannot receive image")
+			return 0, reader.err
+		}
+		reader.chunk = req.GetChunkData()
+	}
+
+	n := copy(p, reader.chunk)
+	reader.hash.Write(p[:n])
+	reader.chunk = reader.chunk[n:]
+	reader.size += n
+	return n, nil
+}
+
+func (server *LaptopServer) ListImages(ctx context.Context, req *pb.ListImagesRequest) (*pb.ListImagesResponse, error) {
+	laptopId := req.GetLaptopId()
+	log.Printf("receive a list-images request with laptopId: %s", laptopId)
+
+	_, err := server.laptopStore.Find(laptopId)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find laptop: %v", err)
+	}
+
+	images, err := server.imageStore.List(laptopId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list images: %v", err)
+	}
+
+	res := &pb.ListImagesResponse{}
+	for _, image := range images {
+		res.Images = append(res.Images, toImageProto(image))
+	}
+	return res, nil
+}
+
+func (server *LaptopServer) DownloadImage(req *pb.DownloadImageRequest, stream pb.LaptopService_DownloadImageServer) error {
+	imageId := req.GetImageId()
+	log.Printf("receive a download-image request with imageId: %s, size: %s", imageId, req.GetSize())
+
+	variant, ok := imageVariantNames[req.GetSize()]
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "image size %s is not supported", req.GetSize())
+	}
+
+	image, data, err := server.imageStore.Open(imageId, variant)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return status.Errorf(code, "cannot open image: %v", err)
+	}
+	defer data.Close()
+
+	err = stream.Send(&pb.DownloadImageResponse{Data: &pb.DownloadImageResponse_Info{Info: toImageProto(image)}})
+	if err != nil {
+		return status.Errorf(codes.Unknown, "cannot send image info: %v", err)
+	}
+
+	buffer := make([]byte, imageChunkSize)
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		n, err := data.Read(buffer)
+		if n > 0 {
+			err := stream.Send(&pb.DownloadImageResponse{Data: &pb.DownloadImageResponse_ChunkData{ChunkData: buffer[:n]}})
+			if err != nil {
+				return status.Errorf(codes.Unknown, "cannot send image chunk: %v", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Print(err)
+			return status.Errorf(codes.Internal, "cannot read image data: %v", err)
+		}
+	}
+
+	log.Printf("sent image with id: %s, size: %d", imageId, image.Size)
+	return nil
+}
+
+func (server *LaptopServer) DeleteImage(ctx context.Context, req *pb.DeleteImageRequest) (*pb.DeleteImageResponse, error) {
+	imageId := req.GetImageId()
+	log.Printf("receive a delete-image request with imageId: %s", imageId)
+
+	err := server.imageStore.Delete(imageId)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete image: %v", err)
+	}
+	return &pb.DeleteImageResponse{}, nil
+}
+
+func (server *LaptopServer) SetPrimaryImage(ctx context.Context, req *pb.SetPrimaryImageRequest) (*pb.SetPrimaryImageResponse, error) {
+	imageId := req.GetImageId()
+	log.Printf("receive a set-primary-image request with imageId: %s", imageId)
+
+	image, err := server.imageStore.SetPrimary(imageId)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot set primary image: %v", err)
+	}
+	return &pb.SetPrimaryImageResponse{Image: toImageProto(image)}, nil
+}
+
+func toImageProto(image *ImageInfo) *pb.Image {
+	res := &pb.Image{
+		Id:          image.ID,
+		LaptopId:    image.LaptopID,
+		ImageType:   image.Type,
+		ContentType: image.ContentType,
+		Size:        uint64(image.Size),
+		UploadedAt:  timestamppb.New(image.UploadedAt),
+		UploadedBy:  image.UploadedBy,
+		Primary:     image.Primary,
+		Width:       uint32(image.Width),
+		Height:      uint32(image.Height),
+		Sha256:      image.Digest,
+	}
+	for _, variant := range image.Variants {
+		res.Variants = append(res.Variants, &pb.ImageVariant{
+			Variant:     imageVariants[variant.Name],
+			ContentType: variant.ContentType,
+			Size:        uint64(variant.Size),
+			Width:       uint32(variant.Width),
+			Height:      uint32(variant.Height),
+		})
+	}
+	return res
+}
+
+// imageVariantNames are the store variants of the requested sizes
+var imageVariantNames = map[pb.Image_Variant]string{
+	pb.Image_ORIGINAL:  "",
+	pb.Image_THUMBNAIL: ImageThumbnail,
+	pb.Image_MEDIUM:    ImageMedium,
+}
+
+var imageVariants = map[string]pb.Image_Variant{
+	ImageThumbnail: pb.Image_THUMBNAIL,
+	ImageMedium:    pb.Image_MEDIUM,
+}
+
+// RateLaptop records the ratings of the authorized user, a repeat rating of a laptop replaces the previous one
+func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer) error {
+	claims, ok := UserClaimsFromContext(stream.Context())
+	if !ok {
+		return status.Errorf(codes.Unauthenticated, "rating needs an authorized user")
+	}
+
+	for {
+		err := contextError(stream.Context())
+		if err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			log.Print("receive all ratings")
+			break
+		} else if err != nil {
+			log.Printf("cannot receive rating: %v", err)
+			return status.Errorf(codes.Unknown, "cannot receive request: %v", err)
+		}
+
+		laptopId := req.GetLaptopId()
+		rating := req.GetRating()
+		log.Printf("receive a rating request with laptopId: %s, rating: %f, username: %s", laptopId, rating, claims.Username)
+
+		err = server.ratingConfig.check(rating)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "rating is invalid: %v", err)
+		}
+
+		found, err := server.laptopStore.Find(laptopId)
+		if err != nil {
+			log.Print(err)
+			return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+		}
+		if found == nil {
+			log.Print(err)
+			return status.Errorf(codes.NotFound, "laptop with id: %s is not found", laptopId)
+		}
+
+		r, err := server.ratingStore.Save(laptopId, claims.Username, rating)
+		if err != nil {
+			log.Print(err)
+			return status.Errorf(codes.Internal, "cannot save rating: %v", err)
+		}
+
+		err = server.laptopStore.NotifyRated(laptopId)
+		if err != nil {
+			log.Print(err)
+			return status.Errorf(codes.Internal, "cannot record rating event: %v", err)
+		}
+
+		res := &pb.RateLaptopResponse{
+			LaptopId:      laptopId,
+			RatedCount:    r.Count,
+			AverageRating: r.Average(),
+		}
+		err = stream.Send(res)
+		if err != nil {
+			log.Print(err)
+			return status.Errorf(codes.Unknown, "cannot send response to client: %v", err)
+		}
+	}
+	return nil
+}
+
+// DeleteRating removes the rating of a laptop by the authorized user
+func (server *LaptopServer) DeleteRating(ctx context.Context, req *pb.DeleteRatingRequest) (*pb.DeleteRatingResponse, error) {
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "rating needs an authorized user")
+	}
+	laptopId := req.GetLaptopId()
+	log.Printf("receive a delete-rating request with laptopId: %s, username: %s", laptopId, claims.Username)
+
+	r, err := server.ratingStore.Remove(laptopId, claims.Username)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot delete rating: %v", err)
+	}
+
+	err = server.laptopStore.NotifyRated(laptopId)
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(codes.Internal, "cannot record rating event: %v", err)
+	}
+
+	return &pb.DeleteRatingResponse{
+		LaptopId:      laptopId,
+		RatedCount:    r.Count,
+		AverageRating: r.Average(),
+	}, nil
+}
+
+// GetMyRatings returns the ratings of the authorized user
+func (server *LaptopServer) GetMyRatings(ctx context.Context, req *pb.GetMyRatingsRequest) (*pb.GetMyRatingsResponse, error) {
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "rating needs an authorized user")
+	}
+	log.Printf("receive a get-my-ratings request with username: %s", claims.Username)
+
+	ratings, err := server.ratingStore.ListByUser(claims.Username)
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(codes.Internal, "cannot list ratings: %v", err)
+	}
+
+	res := &pb.GetMyRatingsResponse{}
+	for _, r := range ratings {
+		res.Ratings = append(res.Ratings, &pb.UserRating{
+			LaptopId: r.LaptopID,
+			Rating:   r.Score,
+			RatedAt:  timestamppb.New(r.RatedAt),
+		})
+	}
+	return res, nil
+}
+
+// GetRatingSummary returns the distribution and the averages of the ratings of a laptop
+func (server *LaptopServer) GetRatingSummary(ctx context.Context, req *pb.GetRatingSummaryRequest) (*pb.GetRatingSummaryResponse, error) {
+	laptopId := req.GetLaptopId()
+	log.Printf("receive a get-rating-summary request with laptopId: %s", laptopId)
+
+	_, err := server.laptopStore.Find(laptopId)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find laptop: %v", err)
+	}
+
+	summary, err := server.ratingSummary(laptopId, time.Now())
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(codes.Internal, "cannot summarize ratings: %v", err)
+	}
+
+	res := &pb.RatingSummary{
+		LaptopId:       laptopId,
+		RatedCount:     summary.Count,
+		AverageRating:  summary.Average,
+		MedianRating:   summary.Median,
+		BayesianRating: summary.BayesianAverage,
+		DecayedRating:  summary.DecayedScore,
+	}
+	for _, bucket := range summary.Distribution {
+		res.Distribution = append(res.Distribution, &pb.RatingBucket{Rating: bucket.Score, Count: bucket.Count})
+	}
+	return &pb.GetRatingSummaryResponse{Summary: res}, nil
+}
+
+func contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		log.Print("request is cancelled")
+		return status.Errorf(codes.Canceled, "request is cancelled")
+	case context.DeadlineExceeded:
+		log.Print("request is timed out")
+		return status.Errorf(codes.DeadlineExceeded, "deadline is exceeded")
+	default:
+		return nil
+	}
+}
@@ -1,84 +1,422 @@
-package service_test
-
-import (
-	"context"
-	"pcbook/pb"
-	"pcbook/sample"
-	"pcbook/service"
-	"testing"
-
-	"github.com/stretchr/testify/require"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
-)
-
-func TestServerCreateLaptop(t *testing.T) {
-	t.Parallel()
-
-	laptopWithoutID := sample.NewLaptop()
-	laptopWithoutID.Id = ""
-
-	laptopInvalidID := sample.NewLaptop()
-	laptopInvalidID.Id = "invalid-uuid"
-
-	laptopDuplicateID := sample.NewLaptop()
-	storeDulicateID := service.NewInMemoryLaptopStore()
-	err := storeDulicateID.Save(laptopDuplicateID)
-	require.NoError(t, err)
-
-	testCase := []struct {
-		name   string
-		laptop *pb.Laptop
-		store  service.LaptopStore
-		code   codes.Code
-	}{
-		{
-			name:   "sucess_with_id",
-			laptop: sample.NewLaptop(),
-			store:  service.NewInMemoryLaptopStore(),
-			code:   codes.OK,
-		}, {
-			name:   "success_without_id",
-			laptop: laptopWithoutID,
-			store:  service.NewInMemoryLaptopStore(),
-			code:   codes.OK,
-		}, {
-			name:   "failture_invalid_id",
-			laptop: laptopInvalidID,
-			store:  service.NewInMemoryLaptopStore(),
-			code:   codes.InvalidArgument,
-		}, {
-			name:   "failture_duplicate_id",
-			laptop: laptopDuplicateID,
-			store:  storeDulicateID,
-			code:   codes.AlreadyExists,
-		},
-	}
-
-	for i := range testCase {
-		tc := testCase[i]
-		t.Run(tc.name, func(t *testing.T) {
-			t.Parallel()
-			req := &pb.CreateLaptopRequest{
-				Laptop: tc.laptop,
-			}
-
-			server := service.NewLaptopServer(tc.store, nil, nil)
-			res, err := server.CreateLaptop(context.Background(), req)
-			if tc.code == codes.OK {
-				require.NoError(t, err)
-				require.NotNil(t, res)
-				require.NotEmpty(t, res.Id)
-				if len(tc.laptop.Id) > 0 {
-					require.Equal(t, tc.laptop.Id, res.Id)
-				}
-			} else {
-				require.Error(t, err)
-				require.Nil(t, res)
-				st, ok := status.FromError(err)
-				require.True(t, ok)
-				require.Equal(t, tc.code, st.Code())
-			}
-		})
-	}
-}
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestServerCreateLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopWithoutID := sample.NewLaptop()
+	laptopWithoutID.Id = ""
+
+	laptopInvalidID := sample.NewLaptop()
+	laptopInvalidID.Id = "invalid-uuid"
+
+	laptopInvalidCPU := sample.NewLaptop()
+	laptopInvalidCPU.Cpu.MaxGhz = laptopInvalidCPU.Cpu.MinGhz - 1
+
+	laptopDuplicateID := sample.NewLaptop()
+	storeDulicateID := service.NewInMemoryLaptopStore()
+	err := storeDulicateID.Save(laptopDuplicateID)
+	require.NoError(t, err)
+
+	testCase := []struct {
+		name   string
+		laptop *pb.Laptop
+		store  service.LaptopStore
+		code   codes.Code
+	}{
+		{
+			name:   "sucess_with_id",
+			laptop: sample.NewLaptop(),
+			store:  service.NewInMemoryLaptopStore(),
+			code:   codes.OK,
+		}, {
+			name:   "success_without_id",
+			laptop: laptopWithoutID,
+			store:  service.NewInMemoryLaptopStore(),
+			code:   codes.OK,
+		}, {
+			name:   "failture_invalid_id",
+			laptop: laptopInvalidID,
+			store:  service.NewInMemoryLaptopStore(),
+			code:   codes.InvalidArgument,
+		}, {
+			name:   "failture_invalid_cpu",
+			laptop: laptopInvalidCPU,
+			store:  service.NewInMemoryLaptopStore(),
+			code:   codes.InvalidArgument,
+		}, {
+			name:   "failture_duplicate_id",
+			laptop: laptopDuplicateID,
+			store:  storeDulicateID,
+			code:   codes.AlreadyExists,
+		},
+	}
+
+	for i := range testCase {
+		tc := testCase[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := &pb.CreateLaptopRequest{
+				Laptop: tc.laptop,
+			}
+
+			server := service.NewLaptopServer(tc.store, nil, nil)
+			res, err := server.CreateLaptop(context.Background(), req)
+			if tc.code == codes.OK {
+				require.NoError(t, err)
+				require.NotNil(t, res)
+				require.NotEmpty(t, res.Id)
+				if len(tc.laptop.Id) > 0 {
+					require.Equal(t, tc.laptop.Id, res.Id)
+				}
+			} else {
+				require.Error(t, err)
+				require.Nil(t, res)
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, st.Code())
+			}
+		})
+	}
+}
+
+func TestServerUpdateLaptop(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := store.Save(laptop)
+	require.NoError(t, err)
+
+	stale := proto.Clone(laptop).(*pb.Laptop)
+	stale.UpdatedAt = timestamppb.New(laptop.UpdatedAt.AsTime().Add(-time.Hour))
+
+	testCase := []struct {
+		name   string
+		laptop *pb.Laptop
+		paths  []string
+		code   codes.Code
+	}{
+		{
+			name:   "success",
+			laptop: &pb.Laptop{Id: laptop.Id, PriceUsd: 999, Brand: "ignored", Cpu: &pb.CPU{MaxGhz: 6}, UpdatedAt: laptop.UpdatedAt},
+			paths:  []string{"price_usd", "cpu.max_ghz"},
+			code:   codes.OK,
+		}, {
+			name:   "failure_invalid",
+			laptop: &pb.Laptop{Id: laptop.Id, PriceUsd: -1, UpdatedAt: laptop.UpdatedAt},
+			paths:  []string{"price_usd", "cpu.min_ghz"},
+			code:   codes.InvalidArgument,
+		}, {
+			name:   "failure_stale",
+			laptop: stale,
+			paths:  []string{"price_usd"},
+			code:   codes.Aborted,
+		}, {
+			name:   "failure_not_found",
+			laptop: sample.NewLaptop(),
+			paths:  []string{"price_usd"},
+			code:   codes.NotFound,
+		}, {
+			name:   "failure_unknown_field",
+			laptop: laptop,
+			paths:  []string{"cpu.unknown"},
+			code:   codes.InvalidArgument,
+		}, {
+			name:   "failure_readonly_field",
+			laptop: laptop,
+			paths:  []string{"id"},
+			code:   codes.InvalidArgument,
+		},
+	}
+
+	server := service.NewLaptopServer(store, nil, nil)
+	for i := range testCase {
+		tc := testCase[i]
+		t.Run(tc.name, func(t *testing.T) {
+			req := &pb.UpdateLaptopRequest{
+				Laptop:     tc.laptop,
+				UpdateMask: &field_mask.FieldMask{Paths: tc.paths},
+			}
+
+			res, err := server.UpdateLaptop(context.Background(), req)
+			if tc.code == codes.OK {
+				require.NoError(t, err)
+				require.Equal(t, tc.laptop.PriceUsd, res.GetLaptop().GetPriceUsd())
+				require.Equal(t, 6.0, res.GetLaptop().GetCpu().GetMaxGhz())
+				require.Equal(t, laptop.Cpu.MinGhz, res.GetLaptop().GetCpu().GetMinGhz())
+				require.Equal(t, laptop.Brand, res.GetLaptop().GetBrand())
+				require.True(t, res.GetLaptop().GetUpdatedAt().AsTime().After(laptop.UpdatedAt.AsTime()))
+
+				_, err = server.UpdateLaptop(context.Background(), req)
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, codes.Aborted, st.Code())
+			} else {
+				require.Error(t, err)
+				require.Nil(t, res)
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				require.Equal(t, tc.code, st.Code())
+			}
+		})
+	}
+}
+
+func TestServerDeleteLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStore(imageFolder)
+	ratingStore := service.NewInMemoryRatingStore()
+	reviewStore := service.NewInMemoryReviewStore()
+	server := service.NewLaptopServerWithConfig(laptopStore, imageStore, ratingStore, service.LaptopServerConfig{ReviewStore: reviewStore})
+
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	review := newTestReview(laptop.Id, "user1", time.Now())
+	require.NoError(t, reviewStore.Save(review))
+	imageId, err := imageStore.Save(laptop.Id, ".jpg", bytes.NewReader(newTestImage(t, "jpeg", 16, 16)), "admin1")
+	require.NoError(t, err)
+	_, err = ratingStore.Save(laptop.Id, "user1", 5)
+	require.NoError(t, err)
+
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+
+	_, err = laptopStore.Find(laptop.Id)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.NoFileExists(t, filepath.Join(imageFolder, imageId+".jpg"))
+	rating, err := ratingStore.Save(laptop.Id, "user1", 5)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, rating.Count)
+	_, err = reviewStore.Find(review.Id)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	err = laptopStore.Save(laptop)
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+
+	res, err := server.PurgeDeleted(context.Background(), &pb.PurgeDeletedRequest{OlderThan: durationpb.New(time.Hour)})
+	require.NoError(t, err)
+	require.Zero(t, res.GetPurgedCount())
+
+	res, err = server.PurgeDeleted(context.Background(), &pb.PurgeDeletedRequest{})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res.GetPurgedCount())
+
+	err = laptopStore.Save(laptop)
+	require.NoError(t, err)
+}
+
+// failingRatingStore fails to delete the ratings of a laptop while fail is set
+type failingRatingStore struct {
+	service.RatingStore
+	fail bool
+}
+
+func (store *failingRatingStore) Delete(laptopId string) error {
+	if store.fail {
+		return errors.New("rating store is unavailable")
+	}
+	return store.RatingStore.Delete(laptopId)
+}
+
+func TestServerDeleteLaptopRetry(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := &failingRatingStore{RatingStore: service.NewInMemoryRatingStore(), fail: true}
+	server := service.NewLaptopServer(laptopStore, service.NewDiskImageStore(t.TempDir()), ratingStore)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	_, err := ratingStore.Save(laptop.Id, "user1", 5)
+	require.NoError(t, err)
+
+	// the laptop is kept when its ratings can not be deleted, so the deletion can be retried
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.Internal, status.Code(err))
+	_, err = laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+
+	ratingStore.fail = false
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	_, err = laptopStore.Find(laptop.Id)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	rating, err := ratingStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Zero(t, rating.Count)
+}
+
+// TestOrderByDocumentation checks that the proto, which is all the gateway users see, lists every order_by field
+func TestOrderByDocumentation(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("../proto/laptop_service.proto")
+	require.NoError(t, err)
+	message := func(name string) string {
+		start := strings.Index(string(data), "message "+name+" {")
+		require.NotEqual(t, -1, start, name)
+		end := strings.Index(string(data[start:]), "\n}")
+		return string(data[start : start+end])
+	}
+	search, list := message("SearchLaptopRequest"), message("ListLaptopsRequest")
+
+	laptopFields, ratingFields := service.LaptopOrderFields()
+	for _, field := range laptopFields {
+		require.Contains(t, search, field)
+		require.Contains(t, list, field)
+	}
+	for _, field := range ratingFields {
+		require.Contains(t, search, field)
+	}
+}
+
+func TestServerGetLaptop(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	err := store.Save(laptop)
+	require.NoError(t, err)
+
+	server := service.NewLaptopServer(store, nil, nil)
+	res, err := server.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+	requireSameLaptop(t, laptop, res.GetLaptop())
+
+	_, err = server.GetLaptop(context.Background(), &pb.GetLaptopRequest{Id: sample.NewLaptop().Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServerListLaptops(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	n := 7
+	for i := 0; i < n; i++ {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = float64(1000 + i%3*500)
+		err := store.Save(laptop)
+		require.NoError(t, err)
+	}
+
+	server := service.NewLaptopServer(store, nil, nil)
+	req := &pb.ListLaptopsRequest{PageSize: 3, OrderBy: "price_usd desc"}
+
+	var laptops []*pb.Laptop
+	pages := 0
+	for {
+		res, err := server.ListLaptops(context.Background(), req)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(res.GetLaptops()), 3)
+		laptops = append(laptops, res.GetLaptops()...)
+		pages++
+
+		if len(res.GetNextPageToken()) == 0 {
+			break
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+	require.Equal(t, 3, pages)
+	require.Len(t, laptops, n)
+
+	for i := 1; i < n; i++ {
+		prev, cur := laptops[i-1], laptops[i]
+		require.GreaterOrEqual(t, prev.PriceUsd, cur.PriceUsd)
+		if prev.PriceUsd == cur.PriceUsd {
+			require.Less(t, prev.Id, cur.Id)
+		}
+	}
+
+	req.OrderBy = "release_year"
+	_, err := server.ListLaptops(context.Background(), req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.ListLaptops(context.Background(), &pb.ListLaptopsRequest{PageToken: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.ListLaptops(context.Background(), &pb.ListLaptopsRequest{OrderBy: "brand"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerAggregateLaptops(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	brands := []string{"Dell", "Dell", "Dell", "Lenovo", "Lenovo", "HP"}
+	for i, brand := range brands {
+		laptop := sample.NewLaptop()
+		laptop.Brand = brand
+		laptop.PriceUsd = float64(500 + i*400)
+		laptop.Ram = &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE}
+		err := store.Save(laptop)
+		require.NoError(t, err)
+	}
+
+	server := service.NewLaptopServer(store, nil, nil)
+	req := &pb.AggregateLaptopsRequest{
+		Filter: &pb.Filter{MaxPriceUsd: 2000},
+		Facets: []string{"brand", "price_usd:1000,1500", "ram:8,16"},
+	}
+	res, err := server.AggregateLaptops(context.Background(), req)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, res.GetTotalCount())
+	require.Len(t, res.GetFacets(), 3)
+
+	terms := res.GetFacets()[0]
+	require.Equal(t, "brand", terms.GetFacet())
+	require.Len(t, terms.GetBuckets(), 2)
+	require.Equal(t, "Dell", terms.GetBuckets()[0].GetKey())
+	require.EqualValues(t, 3, terms.GetBuckets()[0].GetCount())
+	require.Equal(t, "Lenovo", terms.GetBuckets()[1].GetKey())
+	require.EqualValues(t, 1, terms.GetBuckets()[1].GetCount())
+
+	prices := res.GetFacets()[1].GetBuckets()
+	require.Len(t, prices, 3)
+	require.Equal(t, "*-1000", prices[0].GetKey())
+	require.Nil(t, prices[0].From)
+	require.EqualValues(t, 2, prices[0].GetCount())
+	require.Equal(t, "1000-1500", prices[1].GetKey())
+	require.EqualValues(t, 1, prices[1].GetCount())
+	require.Equal(t, "1500-*", prices[2].GetKey())
+	require.EqualValues(t, 1500, prices[2].GetFrom())
+	require.Nil(t, prices[2].To)
+	require.EqualValues(t, 1, prices[2].GetCount())
+
+	rams := res.GetFacets()[2].GetBuckets()
+	require.EqualValues(t, []uint64{0, 0, 4}, []uint64{rams[0].GetCount(), rams[1].GetCount(), rams[2].GetCount()})
+
+	for _, spec := range []string{"name", "price_usd:", "price_usd:2,1", "cpu.number_cores:4"} {
+		_, err = server.AggregateLaptops(context.Background(), &pb.AggregateLaptopsRequest{Facets: []string{spec}})
+		require.Equal(t, codes.InvalidArgument, status.Code(err), spec)
+	}
+}
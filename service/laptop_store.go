@@ -1,143 +1,649 @@
-package service
-
-import (
-	"context"
-	"errors"
-	"fmt"
-	"log"
-	"pcbook/pb"
-	"sync"
-
-	"github.com/jinzhu/copier"
-)
-
-var ErrAlreadyExists = errors.New("record already exists")
-
-type LaptopStore interface {
-	Save(laptop *pb.Laptop) error
-	Find(id string) (*pb.Laptop, error)
-	Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
-}
-
-type InMemoryLaptopStore struct {
-	mutex sync.RWMutex
-	data  map[string]*pb.Laptop
-}
-
-func NewInMemoryLaptopStore() *InMemoryLaptopStore {
-	return &InMemoryLaptopStore{
-		data: make(map[string]*pb.Laptop),
-	}
-}
-
-func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
-	store.mutex.Lock()
-	defer store.mutex.Unlock()
-
-	if store.data[laptop.Id] != nil {
-		return ErrAlreadyExists
-	}
-
-	other, err := deepCopy(laptop)
-	if err != nil {
-		return err
-	}
-
-	store.data[laptop.Id] = other
-	return nil
-}
-
-func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
-	store.mutex.RLock()
-	defer store.mutex.RUnlock()
-
-	laptop := store.data[id]
-	if laptop == nil {
-		return nil, fmt.Errorf("laptop with id %s not found", id)
-	}
-
-	return deepCopy(laptop)
-}
-
-func (store *InMemoryLaptopStore) Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error {
-	store.mutex.RLock()
-	defer store.mutex.RUnlock()
-
-	for _, laptop := range store.data {
-		// time.Sleep(time.Second * 1)
-		// log.Print("checking laptop id:", laptop.GetId())
-
-		switch ctx.Err() {
-		case context.Canceled:
-			log.Print("CreateLaptop request is cancelled")
-			return errors.New("cancelled")
-		case context.DeadlineExceeded:
-			log.Print("CreateLaptop request is timed out")
-			return errors.New("timed out")
-		default:
-		}
-
-		if isQualified(filter, laptop) {
-			other, err := deepCopy(laptop)
-			if err != nil {
-				return err
-			}
-
-			err = found(other)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
-}
-
-func isQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
-	if laptop.GetPriceUsd() > filter.GetMaxPriceUsd() {
-		return false
-	}
-
-	if laptop.GetCpu().GetNumberCores() < filter.GetMinCpuCores() {
-		return false
-	}
-
-	if laptop.GetCpu().GetMinGhz() < filter.GetMinCpuGhz() {
-		return false
-	}
-
-	if toBit(laptop.GetRam()) < toBit(filter.GetMinRam()) {
-		return false
-	}
-
-	return true
-}
-
-func toBit(ram *pb.Memory) uint64 {
-	var shift int
-	switch ram.Unit {
-	case pb.Memory_BIT:
-		shift = 0
-	case pb.Memory_BYTE:
-		shift = 3
-	case pb.Memory_KILOBYTE:
-		shift = 13
-	case pb.Memory_MEGABYTE:
-		shift = 23
-	case pb.Memory_GIGABYTE:
-		shift = 33
-	case pb.Memory_TERABYTE:
-		shift = 43
-	default:
-		return 0
-	}
-	return ram.GetValue() << shift
-}
-
-func deepCopy(laptop *pb.Laptop) (*pb.Laptop, error) {
-	other := &pb.Laptop{}
-	err := copier.Copy(other, laptop)
-	if err != nil {
-		return nil, fmt.Errorf("conot copy laptop: %w", err)
-	}
-	return other, nil
-}
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"pcbook/expr"
+	"pcbook/pb"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var ErrAlreadyExists = errors.New("record already exists")
+var ErrNotFound = errors.New("record not found")
+var ErrConflict = errors.New("record has been modified")
+
+type LaptopStore interface {
+	Save(laptop *pb.Laptop) error
+	SaveAll(laptops []*pb.Laptop) (int, error)
+	Find(id string) (*pb.Laptop, error)
+	Update(laptop *pb.Laptop, paths []string) (*pb.Laptop, error)
+	Delete(id string, deletedBy string) error
+	PurgeDeleted(before time.Time) (int, error)
+	Search(ctx context.Context, filter *pb.Filter, program *expr.Program, found func(laptop *pb.Laptop) error) error
+	List(ctx context.Context, order LaptopOrder, after *LaptopCursor, limit int) ([]*pb.Laptop, error)
+	TextSearch(ctx context.Context, query string, filter *pb.Filter, limit int, found func(laptop *pb.Laptop, score float64) error) error
+	Suggest(prefix string, limit int) ([]string, error)
+	NotifyRated(id string) error
+	Watch(ctx context.Context, revision uint64, filter *pb.Filter, found func(event *LaptopEvent) error) error
+}
+
+// Tombstone keeps a deleted laptop until it is purged
+type Tombstone struct {
+	Laptop    *pb.Laptop
+	DeletedAt time.Time
+	DeletedBy string
+}
+
+// InMemoryLaptopStore publishes every write as a new immutable view, so reading laptops never
+// waits for writers and writers never wait for readers. The mutex serializes the writers and
+// guards the tombstones and the text index
+type InMemoryLaptopStore struct {
+	mutex      sync.RWMutex
+	current    atomic.Value
+	tombstones map[string]*Tombstone
+	textIndex  *textIndex
+	events     *LaptopEventLog
+	// journal is called with every mutation before it is published, under the mutex,
+	// the mutation is dropped if it fails
+	journal func(mutation *pb.LaptopMutation) error
+}
+
+func NewInMemoryLaptopStore() *InMemoryLaptopStore {
+	return NewInMemoryLaptopStoreWithEventLog(NewLaptopEventLog(DefaultEventRetention))
+}
+
+func NewInMemoryLaptopStoreWithEventLog(events *LaptopEventLog) *InMemoryLaptopStore {
+	store := &InMemoryLaptopStore{
+		tombstones: make(map[string]*Tombstone),
+		textIndex:  newTextIndex(),
+		events:     events,
+	}
+	store.current.Store(newLaptopView())
+	return store
+}
+
+// view returns the latest published view of the laptops
+func (store *InMemoryLaptopStore) view() *laptopView {
+	return store.current.Load().(*laptopView)
+}
+
+// record passes the mutation to the journal, the caller must hold the mutex
+func (store *InMemoryLaptopStore) record(mutation *pb.LaptopMutation) error {
+	if store.journal == nil {
+		return nil
+	}
+	return store.journal(mutation)
+}
+
+func (store *InMemoryLaptopStore) Save(laptop *pb.Laptop) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	view := store.view()
+	if view.find(laptop.Id) != nil || store.tombstones[laptop.Id] != nil {
+		return ErrAlreadyExists
+	}
+
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return err
+	}
+	err = store.record(&pb.LaptopMutation{
+		Mutation: &pb.LaptopMutation_Save{Save: &pb.LaptopBatch{Laptops: []*pb.Laptop{other}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	next := view.edit()
+	next.put(other)
+	store.current.Store(next)
+	store.textIndex.add(other.Id, laptopTexts(other)...)
+	store.events.Append(pb.LaptopEvent_CREATED, other, nil)
+	return nil
+}
+
+// SaveAll saves all laptops or none of them, on failure it returns the index of the laptop that can not be saved
+func (store *InMemoryLaptopStore) SaveAll(laptops []*pb.Laptop) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	view := store.view()
+	others := make([]*pb.Laptop, len(laptops))
+	ids := make(map[string]bool, len(laptops))
+	for i, laptop := range laptops {
+		if view.find(laptop.Id) != nil || store.tombstones[laptop.Id] != nil || ids[laptop.Id] {
+			return i, fmt.Errorf("laptop with id %s: %w", laptop.Id, ErrAlreadyExists)
+		}
+		ids[laptop.Id] = true
+
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return i, err
+		}
+		others[i] = other
+	}
+	err := store.record(&pb.LaptopMutation{
+		Mutation: &pb.LaptopMutation_Save{Save: &pb.LaptopBatch{Laptops: others}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	next := view.edit()
+	for _, other := range others {
+		next.put(other)
+	}
+	store.current.Store(next)
+
+	for _, other := range others {
+		store.textIndex.add(other.Id, laptopTexts(other)...)
+		store.events.Append(pb.LaptopEvent_CREATED, other, nil)
+	}
+	return 0, nil
+}
+
+func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
+	laptop := store.view().find(id)
+	if laptop == nil {
+		return nil, fmt.Errorf("laptop with id %s: %w", id, ErrNotFound)
+	}
+
+	return deepCopy(laptop)
+}
+
+// Update applies the fields in paths from laptop to the stored record,
+// laptop.UpdatedAt must match the stored one, otherwise ErrConflict is returned
+func (store *InMemoryLaptopStore) Update(laptop *pb.Laptop, paths []string) (*pb.Laptop, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	view := store.view()
+	stored := view.find(laptop.Id)
+	if stored == nil {
+		return nil, fmt.Errorf("laptop with id %s: %w", laptop.Id, ErrNotFound)
+	}
+
+	if !proto.Equal(stored.GetUpdatedAt(), laptop.GetUpdatedAt()) {
+		return nil, ErrConflict
+	}
+
+	updated := proto.Clone(stored).(*pb.Laptop)
+	err := applyFieldMask(updated, proto.Clone(laptop), paths)
+	if err != nil {
+		return nil, err
+	}
+	updated.UpdatedAt = timestamppb.Now()
+	err = store.record(&pb.LaptopMutation{
+		Mutation: &pb.LaptopMutation_Update{Update: updated},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	next := view.edit()
+	next.put(updated)
+	store.current.Store(next)
+	store.textIndex.add(updated.Id, laptopTexts(updated)...)
+	store.events.Append(pb.LaptopEvent_UPDATED, updated, stored)
+	return deepCopy(updated)
+}
+
+// Delete hides the laptop from Find and Search and keeps a tombstone for it
+func (store *InMemoryLaptopStore) Delete(id string, deletedBy string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	view := store.view()
+	laptop := view.find(id)
+	if laptop == nil {
+		return fmt.Errorf("laptop with id %s: %w", id, ErrNotFound)
+	}
+
+	tombstone := &Tombstone{
+		Laptop:    laptop,
+		DeletedAt: time.Now(),
+		DeletedBy: deletedBy,
+	}
+	err := store.record(&pb.LaptopMutation{
+		Mutation: &pb.LaptopMutation_Delete{Delete: toTombstoneProto(tombstone)},
+	})
+	if err != nil {
+		return err
+	}
+
+	next := view.edit()
+	next.remove(id)
+	store.current.Store(next)
+	store.textIndex.remove(id)
+	store.tombstones[id] = tombstone
+	store.events.Append(pb.LaptopEvent_DELETED, laptop, nil)
+	return nil
+}
+
+// PurgeDeleted permanently removes the tombstones deleted before the given time
+func (store *InMemoryLaptopStore) PurgeDeleted(before time.Time) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	var purged []string
+	for id, tombstone := range store.tombstones {
+		if tombstone.DeletedAt.Before(before) {
+			purged = append(purged, id)
+		}
+	}
+	if len(purged) == 0 {
+		return 0, nil
+	}
+	err := store.record(&pb.LaptopMutation{
+		Mutation: &pb.LaptopMutation_PurgeBefore{PurgeBefore: timestamppb.New(before)},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range purged {
+		delete(store.tombstones, id)
+	}
+	return len(purged), nil
+}
+
+// Search calls found for every laptop matching both the filter and the program, a nil program matches all.
+// It walks the most selective secondary index for the filter, or all laptops if there is none.
+// The laptops come from the view at the time of the call, no lock is held while found runs
+func (store *InMemoryLaptopStore) Search(ctx context.Context, filter *pb.Filter, program *expr.Program, found func(laptop *pb.Laptop) error) error {
+	view := store.view()
+
+	r, ok := view.indexes.plan(filter)
+	if !ok {
+		return view.each(func(laptop *pb.Laptop) error {
+			return matchLaptop(ctx, laptop, filter, program, found)
+		})
+	}
+
+	return r.each(func(id string) error {
+		return matchLaptop(ctx, view.find(id), filter, program, found)
+	})
+}
+
+// matchLaptop calls found with a copy of the laptop if it matches both the filter and the program
+func matchLaptop(ctx context.Context, laptop *pb.Laptop, filter *pb.Filter, program *expr.Program, found func(laptop *pb.Laptop) error) error {
+	// time.Sleep(time.Second * 1)
+	// log.Print("checking laptop id:", laptop.GetId())
+
+	switch ctx.Err() {
+	case context.Canceled:
+		log.Print("CreateLaptop request is cancelled")
+		return errors.New("cancelled")
+	case context.DeadlineExceeded:
+		log.Print("CreateLaptop request is timed out")
+		return errors.New("timed out")
+	default:
+	}
+
+	if !isQualified(filter, laptop) || (program != nil && !program.Match(laptop)) {
+		return nil
+	}
+
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return err
+	}
+	return found(other)
+}
+
+// List returns at most limit laptops in the given order, starting after the cursor
+func (store *InMemoryLaptopStore) List(ctx context.Context, order LaptopOrder, after *LaptopCursor, limit int) ([]*pb.Laptop, error) {
+	view := store.view()
+
+	type entry struct {
+		key    float64
+		laptop *pb.Laptop
+	}
+
+	entries := make([]entry, 0, view.size)
+	view.each(func(laptop *pb.Laptop) error {
+		key := order.key(laptop)
+		if after == nil || order.less(after.Key, after.ID, key, laptop.Id) {
+			entries = append(entries, entry{key: key, laptop: laptop})
+		}
+		return nil
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return order.less(entries[i].key, entries[i].laptop.Id, entries[j].key, entries[j].laptop.Id)
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	laptops := make([]*pb.Laptop, 0, len(entries))
+	for _, entry := range entries {
+		other, err := deepCopy(entry.laptop)
+		if err != nil {
+			return nil, err
+		}
+		laptops = append(laptops, other)
+	}
+	return laptops, nil
+}
+
+// TextSearch calls found for the laptops matching the query and the filter, the best ranked first
+func (store *InMemoryLaptopStore) TextSearch(ctx context.Context, query string, filter *pb.Filter, limit int, found func(laptop *pb.Laptop, score float64) error) error {
+	store.mutex.RLock()
+	results := store.textIndex.search(query)
+	view := store.view()
+	store.mutex.RUnlock()
+
+	sent := 0
+	for _, result := range results {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		laptop := view.find(result.id)
+		if !isQualified(filter, laptop) {
+			continue
+		}
+
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return err
+		}
+
+		err = found(other, result.score)
+		if err != nil {
+			return err
+		}
+
+		sent++
+		if limit > 0 && sent >= limit {
+			break
+		}
+	}
+	return nil
+}
+
+// NotifyRated records a RATED event for the laptop
+func (store *InMemoryLaptopStore) NotifyRated(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	laptop := store.view().find(id)
+	if laptop == nil {
+		return fmt.Errorf("laptop with id %s: %w", id, ErrNotFound)
+	}
+
+	store.events.Append(pb.LaptopEvent_RATED, laptop, nil)
+	return nil
+}
+
+// Watch calls found for the events after the revision of the laptops matching the filter,
+// until the context is done or the revision falls out of the retention window
+func (store *InMemoryLaptopStore) Watch(ctx context.Context, revision uint64, filter *pb.Filter, found func(event *LaptopEvent) error) error {
+	return store.events.Watch(ctx, revision, func(event *LaptopEvent) error {
+		if !isQualified(filter, event.Laptop) && (event.Previous == nil || !isQualified(filter, event.Previous)) {
+			return nil
+		}
+
+		other := *event
+		other.Laptop = proto.Clone(event.Laptop).(*pb.Laptop)
+		if event.Previous != nil {
+			other.Previous = proto.Clone(event.Previous).(*pb.Laptop)
+		}
+		return found(&other)
+	})
+}
+
+// Suggest returns at most limit completions of the prefix
+func (store *InMemoryLaptopStore) Suggest(prefix string, limit int) ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.textIndex.suggest(prefix, limit), nil
+}
+
+// laptopTexts returns the texts of a laptop for full-text search
+func laptopTexts(laptop *pb.Laptop) []string {
+	texts := []string{laptop.GetBrand(), laptop.GetName(), laptop.GetCpu().GetName()}
+	for _, gpu := range laptop.GetGpus() {
+		texts = append(texts, gpu.GetName())
+	}
+	return texts
+}
+
+func isQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
+	if filter.GetMaxPriceUsd() > 0 && laptop.GetPriceUsd() > filter.GetMaxPriceUsd() {
+		return false
+	}
+
+	if laptop.GetPriceUsd() < filter.GetMinPriceUsd() {
+		return false
+	}
+
+	if len(filter.GetBrands()) > 0 && !containsFold(filter.GetBrands(), laptop.GetBrand()) {
+		return false
+	}
+
+	if laptop.GetReleaseYear() < filter.GetMinReleaseYear() {
+		return false
+	}
+
+	if filter.GetMaxReleaseYear() > 0 && laptop.GetReleaseYear() > filter.GetMaxReleaseYear() {
+		return false
+	}
+
+	if laptop.GetCpu().GetNumberCores() < filter.GetMinCpuCores() {
+		return false
+	}
+
+	if laptop.GetCpu().GetMinGhz() < filter.GetMinCpuGhz() {
+		return false
+	}
+
+	if toBit(laptop.GetRam()) < toBit(filter.GetMinRam()) {
+		return false
+	}
+
+	return isGPUQualified(filter, laptop) &&
+		isStorageQualified(filter, laptop) &&
+		isScreenQualified(filter, laptop) &&
+		isKeyboardQualified(filter, laptop) &&
+		isWeightQualified(filter, laptop)
+}
+
+func isGPUQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
+	if len(filter.GetGpuBrands()) == 0 && filter.GetMinGpuMemory() == nil {
+		return true
+	}
+
+	for _, gpu := range laptop.GetGpus() {
+		if len(filter.GetGpuBrands()) > 0 && !containsFold(filter.GetGpuBrands(), gpu.GetBrand()) {
+			continue
+		}
+		if toBit(gpu.GetMemory()) < toBit(filter.GetMinGpuMemory()) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func isStorageQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
+	var ssd, hdd uint64
+	for _, storage := range laptop.GetStorages() {
+		switch storage.GetDriver() {
+		case pb.Storage_SDD:
+			ssd += toBit(storage.GetMemory())
+		case pb.Storage_HDD:
+			hdd += toBit(storage.GetMemory())
+		}
+	}
+
+	return ssd >= toBit(filter.GetMinSsdCapacity()) && hdd >= toBit(filter.GetMinHddCapacity())
+}
+
+func isScreenQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
+	screen := laptop.GetScreen()
+
+	if screen.GetSizeInch() < filter.GetMinScreenSizeInch() {
+		return false
+	}
+
+	if filter.GetMaxScreenSizeInch() > 0 && screen.GetSizeInch() > filter.GetMaxScreenSizeInch() {
+		return false
+	}
+
+	if screen.GetResolution().GetWidth() < filter.GetMinScreenResolution().GetWidth() ||
+		screen.GetResolution().GetHeight() < filter.GetMinScreenResolution().GetHeight() {
+		return false
+	}
+
+	if len(filter.GetScreenPanels()) > 0 && !contains(filter.GetScreenPanels(), screen.GetPanel()) {
+		return false
+	}
+
+	if filter != nil && filter.Multitouch != nil && screen.GetMulttouch() != filter.GetMultitouch() {
+		return false
+	}
+
+	return true
+}
+
+func isKeyboardQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
+	keyboard := laptop.GetKeyboard()
+
+	if len(filter.GetKeyboardLayouts()) > 0 && !contains(filter.GetKeyboardLayouts(), keyboard.GetLayout()) {
+		return false
+	}
+
+	if filter != nil && filter.KeyboardBacklit != nil && keyboard.GetBacklit() != filter.GetKeyboardBacklit() {
+		return false
+	}
+
+	return true
+}
+
+func isWeightQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
+	if filter.GetMaxWeightKg() <= 0 {
+		return true
+	}
+
+	weight, ok := weightKg(laptop)
+	return ok && weight <= filter.GetMaxWeightKg()
+}
+
+// weightKg returns the weight of the laptop in kilograms, whichever unit it is stored in
+func weightKg(laptop *pb.Laptop) (float64, bool) {
+	switch weight := laptop.GetWeight().(type) {
+	case *pb.Laptop_WeightKg:
+		return weight.WeightKg, true
+	case *pb.Laptop_WeightLb:
+		return weight.WeightLb * kgPerLb, true
+	default:
+		return 0, false
+	}
+}
+
+const kgPerLb = 0.45359237
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func toBit(ram *pb.Memory) uint64 {
+	var shift int
+	switch ram.GetUnit() {
+	case pb.Memory_BIT:
+		shift = 0
+	case pb.Memory_BYTE:
+		shift = 3
+	case pb.Memory_KILOBYTE:
+		shift = 13
+	case pb.Memory_MEGABYTE:
+		shift = 23
+	case pb.Memory_GIGABYTE:
+		shift = 33
+	case pb.Memory_TERABYTE:
+		shift = 43
+	default:
+		return 0
+	}
+	return ram.GetValue() << shift
+}
+
+// snapshot returns the stored laptops and tombstones, which must not be modified
+func (store *InMemoryLaptopStore) snapshot() ([]*pb.Laptop, []*Tombstone) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	view := store.view()
+	laptops := make([]*pb.Laptop, 0, view.size)
+	view.each(func(laptop *pb.Laptop) error {
+		laptops = append(laptops, laptop)
+		return nil
+	})
+	tombstones := make([]*Tombstone, 0, len(store.tombstones))
+	for _, tombstone := range store.tombstones {
+		tombstones = append(tombstones, tombstone)
+	}
+	return laptops, tombstones
+}
+
+// restore puts the laptops as they are, without recording events
+func (store *InMemoryLaptopStore) restore(laptops ...*pb.Laptop) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	next := store.view().edit()
+	for _, laptop := range laptops {
+		next.put(laptop)
+		store.textIndex.add(laptop.Id, laptopTexts(laptop)...)
+	}
+	store.current.Store(next)
+}
+
+// restoreTombstone replaces a laptop by its tombstone, without recording an event
+func (store *InMemoryLaptopStore) restoreTombstone(tombstone *Tombstone) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	id := tombstone.Laptop.GetId()
+	next := store.view().edit()
+	next.remove(id)
+	store.current.Store(next)
+	store.textIndex.remove(id)
+	store.tombstones[id] = tombstone
+}
+
+// deepCopy clones the laptop, reflection based copiers are an order of magnitude slower for messages
+func deepCopy(laptop *pb.Laptop) (*pb.Laptop, error) {
+	return proto.Clone(laptop).(*pb.Laptop), nil
+}
@@ -0,0 +1,351 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"pcbook/expr"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func newFilterTestLaptop() *pb.Laptop {
+	laptop := sample.NewLaptop()
+	laptop.Brand = "Dell"
+	laptop.PriceUsd = 1500
+	laptop.ReleaseYear = 2020
+	laptop.Cpu.NumberCores = 4
+	laptop.Cpu.MinGhz = 2.5
+	laptop.Ram = &pb.Memory{Value: 16, Unit: pb.Memory_GIGABYTE}
+	laptop.Gpus = []*pb.GPU{
+		{Brand: "AMD", Memory: &pb.Memory{Value: 2, Unit: pb.Memory_GIGABYTE}},
+		{Brand: "NVIDIA", Memory: &pb.Memory{Value: 8, Unit: pb.Memory_GIGABYTE}},
+	}
+	laptop.Storages = []*pb.Storage{
+		{Driver: pb.Storage_SDD, Memory: &pb.Memory{Value: 512, Unit: pb.Memory_GIGABYTE}},
+		{Driver: pb.Storage_SDD, Memory: &pb.Memory{Value: 512, Unit: pb.Memory_GIGABYTE}},
+		{Driver: pb.Storage_HDD, Memory: &pb.Memory{Value: 2, Unit: pb.Memory_TERABYTE}},
+	}
+	laptop.Screen = &pb.Screen{
+		SizeInch:   15.6,
+		Resolution: &pb.Screen_Resolution{Width: 1920, Height: 1080},
+		Panel:      pb.Screen_IPS,
+		Multtouch:  true,
+	}
+	laptop.Keyboard = &pb.Keyboard{Layout: pb.Keyboard_QWERTY, Backlit: false}
+	laptop.Weight = &pb.Laptop_WeightLb{WeightLb: 4.4}
+	return laptop
+}
+
+func TestInMemoryLaptopStoreSearchFilter(t *testing.T) {
+	t.Parallel()
+	testLaptopStoreSearchFilter(t, service.NewInMemoryLaptopStore())
+}
+
+func testLaptopStoreSearchFilter(t *testing.T, store service.LaptopStore) {
+
+	testCase := []struct {
+		name      string
+		filter    *pb.Filter
+		qualified bool
+	}{
+		{"empty", &pb.Filter{}, true},
+		{"max_price", &pb.Filter{MaxPriceUsd: 1000}, false},
+		{"min_price", &pb.Filter{MinPriceUsd: 1500}, true},
+		{"brands", &pb.Filter{Brands: []string{"apple", "dell"}}, true},
+		{"brands_mismatch", &pb.Filter{Brands: []string{"Apple"}}, false},
+		{"release_year", &pb.Filter{MinReleaseYear: 2019, MaxReleaseYear: 2020}, true},
+		{"release_year_mismatch", &pb.Filter{MaxReleaseYear: 2019}, false},
+		{"min_ram", &pb.Filter{MinRam: &pb.Memory{Value: 32, Unit: pb.Memory_GIGABYTE}}, false},
+		{"gpu", &pb.Filter{GpuBrands: []string{"NVIDIA"}, MinGpuMemory: &pb.Memory{Value: 6, Unit: pb.Memory_GIGABYTE}}, true},
+		{"gpu_mismatch", &pb.Filter{GpuBrands: []string{"AMD"}, MinGpuMemory: &pb.Memory{Value: 6, Unit: pb.Memory_GIGABYTE}}, false},
+		{"ssd_total", &pb.Filter{MinSsdCapacity: &pb.Memory{Value: 1, Unit: pb.Memory_TERABYTE}}, true},
+		{"hdd_total", &pb.Filter{MinHddCapacity: &pb.Memory{Value: 3, Unit: pb.Memory_TERABYTE}}, false},
+		{"screen_size", &pb.Filter{MinScreenSizeInch: 14, MaxScreenSizeInch: 16}, true},
+		{"screen_size_mismatch", &pb.Filter{MaxScreenSizeInch: 14}, false},
+		{"screen_resolution", &pb.Filter{MinScreenResolution: &pb.Screen_Resolution{Width: 2560}}, false},
+		{"screen_panels", &pb.Filter{ScreenPanels: []pb.Screen_Panel{pb.Screen_IPS, pb.Screen_OLED}}, true},
+		{"multitouch", &pb.Filter{Multitouch: proto.Bool(false)}, false},
+		{"keyboard_layouts", &pb.Filter{KeyboardLayouts: []pb.Keyboard_Layout{pb.Keyboard_AZERTY}}, false},
+		{"keyboard_backlit", &pb.Filter{KeyboardBacklit: proto.Bool(false)}, true},
+		{"max_weight_lb", &pb.Filter{MaxWeightKg: 2.0}, true},
+		{"max_weight_lb_mismatch", &pb.Filter{MaxWeightKg: 1.9}, false},
+	}
+
+	laptop := newFilterTestLaptop()
+	err := store.Save(laptop)
+	require.NoError(t, err)
+
+	for i := range testCase {
+		tc := testCase[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			found := false
+			err := store.Search(context.Background(), tc.filter, nil, func(other *pb.Laptop) error {
+				found = other.Id == laptop.Id
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.qualified, found)
+		})
+	}
+}
+
+var indexedFilters = []*pb.Filter{
+	{MinPriceUsd: 2900},
+	{MinPriceUsd: 1000, MaxPriceUsd: 1200, MinCpuCores: 6},
+	{MaxPriceUsd: 3000, MinCpuCores: 8},
+	{MinCpuGhz: 2.9, Brands: []string{"Apple"}},
+	{MinRam: &pb.Memory{Value: 64, Unit: pb.Memory_GIGABYTE}},
+	{MinRam: &pb.Memory{Value: 8192, Unit: pb.Memory_MEGABYTE}, MinCpuGhz: 2.1},
+	{MinReleaseYear: 2018},
+}
+
+func searchIDs(t testing.TB, search func(context.Context, *pb.Filter, *expr.Program, func(*pb.Laptop) error) error, filter *pb.Filter) []string {
+	var ids []string
+	err := search(context.Background(), filter, nil, func(laptop *pb.Laptop) error {
+		ids = append(ids, laptop.GetId())
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestInMemoryLaptopStoreSearchIndexes(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptops := make([]*pb.Laptop, 3000)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+	}
+	_, err := store.SaveAll(laptops)
+	require.NoError(t, err)
+
+	for _, laptop := range laptops[:300] {
+		laptop.PriceUsd = 2950
+		laptop.Cpu.NumberCores = 8
+		_, err = store.Update(laptop, []string{"price_usd", "cpu.number_cores"})
+		require.NoError(t, err)
+	}
+	for _, laptop := range laptops[300:600] {
+		require.NoError(t, store.Delete(laptop.Id, "admin"))
+	}
+
+	for i, filter := range indexedFilters {
+		filter := filter
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+
+			expected := searchIDs(t, store.SearchScan, filter)
+			require.NotEmpty(t, expected)
+			require.Equal(t, expected, searchIDs(t, store.Search, filter))
+		})
+	}
+}
+
+func TestInMemoryLaptopStoreSearchDoesNotBlockWriters(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewInMemoryLaptopStore()
+	laptops := make([]*pb.Laptop, 10)
+	expected := make([]string, len(laptops))
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		expected[i] = laptops[i].Id
+		require.NoError(t, store.Save(laptops[i]))
+	}
+	sort.Strings(expected)
+
+	stalled := make(chan struct{})
+	resume := make(chan struct{})
+	searched := make(chan []string)
+	var searchErr error
+	go func() {
+		var ids []string
+		searchErr = store.Search(context.Background(), &pb.Filter{}, nil, func(laptop *pb.Laptop) error {
+			if len(ids) == 0 {
+				// a client which does not read its stream
+				close(stalled)
+				<-resume
+			}
+			ids = append(ids, laptop.Id)
+			return nil
+		})
+		sort.Strings(ids)
+		searched <- ids
+	}()
+	<-stalled
+
+	created := sample.NewLaptop()
+	written := make(chan error)
+	go func() {
+		err := store.Save(created)
+		if err == nil {
+			laptops[0].PriceUsd = 999
+			_, err = store.Update(laptops[0], []string{"price_usd"})
+		}
+		if err == nil {
+			err = store.Delete(laptops[1].Id, "admin")
+		}
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes are blocked by the stalled search")
+	}
+
+	other, err := store.Find(laptops[0].Id)
+	require.NoError(t, err)
+	require.Equal(t, 999.0, other.PriceUsd)
+	require.Len(t, searchIDs(t, store.Search, &pb.Filter{}), len(laptops))
+
+	// the stalled search keeps reading the view from before the writes
+	close(resume)
+	require.Equal(t, expected, <-searched)
+	require.NoError(t, searchErr)
+}
+
+func BenchmarkInMemoryLaptopStoreSearch(b *testing.B) {
+	filters := []struct {
+		name   string
+		filter *pb.Filter
+	}{
+		{"price", &pb.Filter{MinPriceUsd: 2990}},
+		{"cores", &pb.Filter{MinCpuCores: 8, MaxPriceUsd: 600}},
+		{"ram", &pb.Filter{MinRam: &pb.Memory{Value: 64, Unit: pb.Memory_GIGABYTE}, MinCpuGhz: 2.95}},
+		{"unindexed", &pb.Filter{MinReleaseYear: 2015, MaxReleaseYear: 2015}},
+	}
+
+	for _, size := range []int{10000, 100000} {
+		store := service.NewInMemoryLaptopStore()
+		laptops := make([]*pb.Laptop, size)
+		for i := range laptops {
+			laptops[i] = sample.NewLaptop()
+		}
+		_, err := store.SaveAll(laptops)
+		require.NoError(b, err)
+
+		for _, tc := range filters {
+			searches := []struct {
+				name   string
+				search func(context.Context, *pb.Filter, *expr.Program, func(*pb.Laptop) error) error
+			}{
+				{"index", store.Search},
+				{"scan", store.SearchScan},
+			}
+			for _, search := range searches {
+				filter, searchFunc := tc.filter, search.search
+				b.Run(fmt.Sprintf("%d/%s/%s", size, tc.name, search.name), func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						err := searchFunc(context.Background(), filter, nil, func(laptop *pb.Laptop) error {
+							return nil
+						})
+						require.NoError(b, err)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestInMemoryLaptopStoreTextSearch(t *testing.T) {
+	t.Parallel()
+	testLaptopStoreTextSearch(t, service.NewInMemoryLaptopStore())
+}
+
+func testLaptopStoreTextSearch(t *testing.T, store service.LaptopStore) {
+	names := map[string]string{
+		"Lenovo": "ThinkPad X1 Carbon",
+		"HP":     "Carbon Elite",
+		"Dell":   "XPS 13",
+	}
+	ids := make(map[string]string)
+	for brand, name := range names {
+		laptop := sample.NewLaptop()
+		laptop.Brand = brand
+		laptop.Name = name
+		err := store.Save(laptop)
+		require.NoError(t, err)
+		ids[brand] = laptop.Id
+	}
+	thinkpad := sample.NewLaptop()
+	thinkpad.Brand = "Lenovo"
+	thinkpad.Name = "ThinkPad T14"
+	err := store.Save(thinkpad)
+	require.NoError(t, err)
+
+	search := func(query string) []string {
+		var found []string
+		err := store.TextSearch(context.Background(), query, nil, 0, func(laptop *pb.Laptop, score float64) error {
+			require.Positive(t, score)
+			found = append(found, laptop.Id)
+			return nil
+		})
+		require.NoError(t, err)
+		return found
+	}
+
+	require.Equal(t, []string{ids["Lenovo"]}, search("thinkpad carbon"))
+	require.Equal(t, []string{ids["Lenovo"]}, search("THINKPAD Carb"))
+	require.ElementsMatch(t, []string{ids["Lenovo"], ids["HP"]}, search("carbon"))
+	require.Len(t, search("think"), 2)
+	require.Empty(t, search("macbook"))
+
+	suggestions, err := store.Suggest("lenovo thi", 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{"lenovo thinkpad"}, suggestions)
+
+	_, err = store.Update(&pb.Laptop{Id: thinkpad.Id, Name: "Legion", UpdatedAt: thinkpad.UpdatedAt}, []string{"name"})
+	require.NoError(t, err)
+	require.Len(t, search("think"), 1)
+
+	err = store.Delete(ids["Lenovo"], "admin")
+	require.NoError(t, err)
+	require.Empty(t, search("think"))
+	require.Equal(t, []string{ids["HP"]}, search("carbon"))
+}
+
+func TestLaptopEventLogWatch(t *testing.T) {
+	t.Parallel()
+
+	eventLog := service.NewLaptopEventLog(3)
+	for i := 0; i < 5; i++ {
+		event := eventLog.Append(pb.LaptopEvent_CREATED, sample.NewLaptop(), nil)
+		require.Equal(t, uint64(i+1), event.Revision)
+	}
+	require.Equal(t, uint64(5), eventLog.Revision())
+
+	err := eventLog.Watch(context.Background(), 1, nil)
+	require.ErrorIs(t, err, service.ErrRevisionExpired)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var revisions []uint64
+	done := make(chan error)
+	go func() {
+		done <- eventLog.Watch(ctx, 3, func(event *service.LaptopEvent) error {
+			revisions = append(revisions, event.Revision)
+			if event.Revision == 6 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	eventLog.Append(pb.LaptopEvent_RATED, sample.NewLaptop(), nil)
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.Equal(t, []uint64{4, 5, 6}, revisions)
+}
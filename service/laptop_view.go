@@ -0,0 +1,115 @@
+package service
+
+import (
+	"pcbook/pb"
+)
+
+// laptopViewShards is the number of maps holding the laptops of a view,
+// a write copies only the shards it changes
+const laptopViewShards = 256
+
+// laptopShard is a part of a view, it may only be changed in its version
+type laptopShard struct {
+	version uint64
+	laptops map[string]*pb.Laptop
+}
+
+// laptopView is an immutable point-in-time view of the stored laptops and their indexes.
+// Writers make the next version with edit, which shares everything it does not change,
+// so readers can keep using an older view without holding any lock.
+// The laptops of a view must not be modified either
+type laptopView struct {
+	version uint64
+	shards  []*laptopShard
+	size    int
+	indexes *laptopIndexes
+}
+
+func newLaptopView() *laptopView {
+	shards := make([]*laptopShard, laptopViewShards)
+	for i := range shards {
+		shards[i] = &laptopShard{laptops: make(map[string]*pb.Laptop)}
+	}
+	return &laptopView{
+		shards:  shards,
+		indexes: newLaptopIndexes(),
+	}
+}
+
+// edit returns the next version of the view, which can be changed until it is published
+func (view *laptopView) edit() *laptopView {
+	version := view.version + 1
+	return &laptopView{
+		version: version,
+		shards:  append([]*laptopShard(nil), view.shards...),
+		size:    view.size,
+		indexes: view.indexes.clone(version),
+	}
+}
+
+// shardOf returns the shard of an id by its FNV-1a hash
+func shardOf(id string) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		hash ^= uint32(id[i])
+		hash *= 16777619
+	}
+	return int(hash % laptopViewShards)
+}
+
+// shard returns the shard of an id for writing, copying it first if it belongs to an older version
+func (view *laptopView) shard(id string) *laptopShard {
+	i := shardOf(id)
+	shard := view.shards[i]
+	if shard.version != view.version {
+		laptops := make(map[string]*pb.Laptop, len(shard.laptops)+1)
+		for id, laptop := range shard.laptops {
+			laptops[id] = laptop
+		}
+		shard = &laptopShard{version: view.version, laptops: laptops}
+		view.shards[i] = shard
+	}
+	return shard
+}
+
+func (view *laptopView) find(id string) *pb.Laptop {
+	return view.shards[shardOf(id)].laptops[id]
+}
+
+// put adds the laptop or replaces the one with the same id
+func (view *laptopView) put(laptop *pb.Laptop) {
+	shard := view.shard(laptop.GetId())
+	if stored := shard.laptops[laptop.GetId()]; stored != nil {
+		view.indexes.remove(stored)
+	} else {
+		view.size++
+	}
+	shard.laptops[laptop.GetId()] = laptop
+	view.indexes.add(laptop)
+}
+
+// remove removes the laptop with the id and returns it, or nil if there is none
+func (view *laptopView) remove(id string) *pb.Laptop {
+	stored := view.find(id)
+	if stored == nil {
+		return nil
+	}
+
+	delete(view.shard(id).laptops, id)
+	view.indexes.remove(stored)
+	view.size--
+	return stored
+}
+
+// each calls fn for every laptop until it returns an error
+func (view *laptopView) each(fn func(laptop *pb.Laptop) error) error {
+	for _, shard := range view.shards {
+		for _, laptop := range shard.laptops {
+			err := fn(laptop)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,39 +1,214 @@
-package service
-
-import "sync"
-
-type RatingStore interface {
-	Add(laptopId string, rating float64) (*Rating, error)
-}
-
-type Rating struct {
-	Count uint32
-	Sum   float64
-}
-
-type InMemoryRatingStore struct {
-	mutex   sync.RWMutex
-	ratings map[string]*Rating
-}
-
-func NewInMemoryRatingStore() *InMemoryRatingStore {
-	return &InMemoryRatingStore{ratings: make(map[string]*Rating)}
-}
-
-func (store *InMemoryRatingStore) Add(laptopId string, rating float64) (*Rating, error) {
-	store.mutex.Lock()
-	defer store.mutex.Unlock()
-
-	r, ok := store.ratings[laptopId]
-	if !ok {
-		r = &Rating{
-			Count: 1,
-			Sum:   rating,
-		}
-	} else {
-		r.Count++
-		r.Sum += rating
-	}
-	store.ratings[laptopId] = r
-	return r, nil
-}
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RatingStore keeps one rating per user and laptop, a repeat rating of a user replaces the previous one
+type RatingStore interface {
+	// Save records the rating of a laptop by a user and returns the rating of the laptop
+	Save(laptopId string, username string, score float64) (*Rating, error)
+	Find(laptopId string) (*Rating, error)
+	// Remove deletes the rating of a laptop by a user and returns the rating of the laptop,
+	// it returns ErrNotFound if the user did not rate the laptop
+	Remove(laptopId string, username string) (*Rating, error)
+	// ListByUser returns the ratings of a user, the most recent first
+	ListByUser(username string) ([]*UserRating, error)
+	// ListByLaptop returns the ratings of a laptop, the most recent first
+	ListByLaptop(laptopId string) ([]*UserRating, error)
+	// Delete removes all the ratings of a laptop
+	Delete(laptopId string) error
+}
+
+// Rating is the summary of the ratings of a laptop
+type Rating struct {
+	Count uint32
+	Sum   float64
+	// Histogram counts the ratings by score
+	Histogram map[float64]uint32
+}
+
+func (rating *Rating) Average() float64 {
+	if rating.Count == 0 {
+		return 0
+	}
+	return rating.Sum / float64(rating.Count)
+}
+
+// Median returns the middle score, or the mean of the two middle scores for an even count
+// of the histogram, legacy ratings without a score are not in it
+func (rating *Rating) Median() float64 {
+	var total uint32
+	scores := make([]float64, 0, len(rating.Histogram))
+	for score, count := range rating.Histogram {
+		scores = append(scores, score)
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Float64s(scores)
+
+	// nth returns the score at the index of the sorted ratings
+	nth := func(index uint32) float64 {
+		for _, score := range scores {
+			if index < rating.Histogram[score] {
+				return score
+			}
+			index -= rating.Histogram[score]
+		}
+		return scores[len(scores)-1]
+	}
+	return (nth((total-1)/2) + nth(total/2)) / 2
+}
+
+func (rating *Rating) clone() *Rating {
+	other := &Rating{Count: rating.Count, Sum: rating.Sum, Histogram: make(map[float64]uint32, len(rating.Histogram))}
+	for score, count := range rating.Histogram {
+		other.Histogram[score] = count
+	}
+	return other
+}
+
+// remove takes a score out of the rating
+func (rating *Rating) remove(score float64) {
+	rating.Count--
+	rating.Sum -= score
+	rating.Histogram[score]--
+	if rating.Histogram[score] == 0 {
+		delete(rating.Histogram, score)
+	}
+}
+
+// UserRating is the rating of a laptop by a user
+type UserRating struct {
+	LaptopID string
+	Username string
+	Score    float64
+	RatedAt  time.Time
+}
+
+type InMemoryRatingStore struct {
+	mutex   sync.RWMutex
+	ratings map[string]*Rating
+	// userRatings maps a laptop ID to the ratings of the laptop by username
+	userRatings map[string]map[string]*UserRating
+}
+
+func NewInMemoryRatingStore() *InMemoryRatingStore {
+	return &InMemoryRatingStore{
+		ratings:     make(map[string]*Rating),
+		userRatings: make(map[string]map[string]*UserRating),
+	}
+}
+
+func (store *InMemoryRatingStore) Save(laptopId string, username string, score float64) (*Rating, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	r, ok := store.ratings[laptopId]
+	if !ok {
+		r = &Rating{Histogram: make(map[float64]uint32)}
+		store.ratings[laptopId] = r
+		store.userRatings[laptopId] = make(map[string]*UserRating)
+	}
+
+	previous, ok := store.userRatings[laptopId][username]
+	if ok {
+		r.remove(previous.Score)
+	}
+	r.Count++
+	r.Sum += score
+	r.Histogram[score]++
+
+	store.userRatings[laptopId][username] = &UserRating{
+		LaptopID: laptopId,
+		Username: username,
+		Score:    score,
+		RatedAt:  time.Now(),
+	}
+	return r.clone(), nil
+}
+
+// Find returns the rating of a laptop, an empty one if it is not rated yet
+func (store *InMemoryRatingStore) Find(laptopId string) (*Rating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	r, ok := store.ratings[laptopId]
+	if !ok {
+		return &Rating{Histogram: map[float64]uint32{}}, nil
+	}
+	return r.clone(), nil
+}
+
+func (store *InMemoryRatingStore) Remove(laptopId string, username string) (*Rating, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	previous, ok := store.userRatings[laptopId][username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(store.userRatings[laptopId], username)
+
+	r := store.ratings[laptopId]
+	r.remove(previous.Score)
+	if r.Count == 0 {
+		delete(store.ratings, laptopId)
+		delete(store.userRatings, laptopId)
+	}
+	return r.clone(), nil
+}
+
+func (store *InMemoryRatingStore) ListByUser(username string) ([]*UserRating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var ratings []*UserRating
+	for _, users := range store.userRatings {
+		if r, ok := users[username]; ok {
+			other := *r
+			ratings = append(ratings, &other)
+		}
+	}
+	sortUserRatings(ratings)
+	return ratings, nil
+}
+
+func (store *InMemoryRatingStore) ListByLaptop(laptopId string) ([]*UserRating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	ratings := make([]*UserRating, 0, len(store.userRatings[laptopId]))
+	for _, r := range store.userRatings[laptopId] {
+		other := *r
+		ratings = append(ratings, &other)
+	}
+	sortUserRatings(ratings)
+	return ratings, nil
+}
+
+func (store *InMemoryRatingStore) Delete(laptopId string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.ratings, laptopId)
+	delete(store.userRatings, laptopId)
+	return nil
+}
+
+// sortUserRatings sorts the ratings the most recent first, ties are broken by laptop ID and username
+func sortUserRatings(ratings []*UserRating) {
+	sort.Slice(ratings, func(i, j int) bool {
+		if !ratings[i].RatedAt.Equal(ratings[j].RatedAt) {
+			return ratings[i].RatedAt.After(ratings[j].RatedAt)
+		}
+		if ratings[i].LaptopID != ratings[j].LaptopID {
+			return ratings[i].LaptopID < ratings[j].LaptopID
+		}
+		return ratings[i].Username < ratings[j].Username
+	})
+}
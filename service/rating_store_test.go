@@ -0,0 +1,118 @@
+package service_test
+
+import (
+	"pcbook/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryRatingStore(t *testing.T) {
+	t.Parallel()
+	testRatingStore(t, service.NewInMemoryRatingStore())
+}
+
+func testRatingStore(t *testing.T, store service.RatingStore) {
+	rating, err := store.Find("laptop1")
+	require.NoError(t, err)
+	require.Zero(t, rating.Count)
+
+	_, err = store.Save("laptop1", "user1", 4)
+	require.NoError(t, err)
+	rating, err = store.Save("laptop1", "user2", 5)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), rating.Count)
+	require.Equal(t, 4.5, rating.Average())
+
+	// a repeat rating replaces the previous one
+	rating, err = store.Save("laptop1", "user1", 2)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), rating.Count)
+	require.Equal(t, 3.5, rating.Average())
+	require.Equal(t, map[float64]uint32{2: 1, 5: 1}, rating.Histogram)
+	require.Equal(t, 3.5, rating.Median())
+
+	_, err = store.Save("laptop1", "user3", 5)
+	require.NoError(t, err)
+	rating, err = store.Find("laptop1")
+	require.NoError(t, err)
+	require.Equal(t, map[float64]uint32{2: 1, 5: 2}, rating.Histogram)
+	require.Equal(t, 5.0, rating.Median())
+	laptopRatings, err := store.ListByLaptop("laptop1")
+	require.NoError(t, err)
+	require.Len(t, laptopRatings, 3)
+	rating, err = store.Remove("laptop1", "user3")
+	require.NoError(t, err)
+	require.Equal(t, map[float64]uint32{2: 1, 5: 1}, rating.Histogram)
+
+	_, err = store.Save("laptop2", "user1", 1)
+	require.NoError(t, err)
+	ratings, err := store.ListByUser("user1")
+	require.NoError(t, err)
+	require.Len(t, ratings, 2)
+	require.False(t, ratings[0].RatedAt.Before(ratings[1].RatedAt))
+	scores := map[string]float64{}
+	for _, r := range ratings {
+		require.Equal(t, "user1", r.Username)
+		require.False(t, r.RatedAt.IsZero())
+		scores[r.LaptopID] = r.Score
+	}
+	require.Equal(t, map[string]float64{"laptop1": 2, "laptop2": 1}, scores)
+
+	rating, err = store.Remove("laptop1", "user1")
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), rating.Count)
+	require.Equal(t, 5.0, rating.Average())
+	_, err = store.Remove("laptop1", "user1")
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	ratings, err = store.ListByUser("user1")
+	require.NoError(t, err)
+	require.Len(t, ratings, 1)
+	ratings, err = store.ListByUser("user3")
+	require.NoError(t, err)
+	require.Empty(t, ratings)
+
+	require.NoError(t, store.Delete("laptop1"))
+	rating, err = store.Find("laptop1")
+	require.NoError(t, err)
+	require.Zero(t, rating.Count)
+	ratings, err = store.ListByUser("user2")
+	require.NoError(t, err)
+	require.Empty(t, ratings)
+}
+
+func TestRatingSummary(t *testing.T) {
+	t.Parallel()
+
+	config := service.RatingConfig{Min: 1, Max: 5, Precision: 1, PriorMean: 3, PriorWeight: 2, HalfLife: time.Hour}
+	now := time.Now()
+	rating := &service.Rating{Count: 4, Sum: 16, Histogram: map[float64]uint32{3: 1, 4: 1, 5: 2}}
+	ratings := []*service.UserRating{
+		{Score: 5, RatedAt: now},
+		{Score: 5, RatedAt: now},
+		{Score: 4, RatedAt: now.Add(-time.Hour)},
+		{Score: 3, RatedAt: now.Add(-2 * time.Hour)},
+	}
+
+	summary := service.SummarizeRatings(config, rating, ratings, now)
+	require.Equal(t, uint32(4), summary.Count)
+	require.Equal(t, 4.0, summary.Average)
+	require.Equal(t, 4.5, summary.Median)
+	require.Equal(t, (2*3+16)/6.0, summary.BayesianAverage)
+	require.InDelta(t, (2*3+5+5+0.5*4+0.25*3)/(2+1+1+0.5+0.25), summary.DecayedScore, 1e-9)
+	require.Equal(t, []service.RatingBucket{{Score: 1}, {Score: 2}, {Score: 3, Count: 1}, {Score: 4, Count: 1}, {Score: 5, Count: 2}}, summary.Distribution)
+
+	// ratings which are long gone leave the prior
+	summary = service.SummarizeRatings(config, rating, ratings, now.Add(1000*time.Hour))
+	require.InDelta(t, 3, summary.DecayedScore, 1e-9)
+
+	// the prior mean is the middle of the scale unless it is set
+	summary = service.SummarizeRatings(service.RatingConfig{Min: 1, Max: 5}, &service.Rating{}, nil, now)
+	require.Equal(t, 3.0, summary.BayesianAverage)
+	require.Equal(t, 3.0, summary.DecayedScore)
+	require.Zero(t, summary.Average)
+	require.Zero(t, summary.Median)
+	require.Len(t, summary.Distribution, 9)
+}
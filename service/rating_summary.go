@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	DefaultRatingMin         = 1
+	DefaultRatingMax         = 10
+	DefaultRatingPrecision   = 0.5
+	DefaultRatingPriorWeight = 5
+	DefaultRatingHalfLife    = 180 * 24 * time.Hour
+)
+
+// ErrInvalidRating is returned for a rating out of the scale or not a step of its precision
+var ErrInvalidRating = errors.New("invalid rating")
+
+// RatingConfig is the rating scale and the parameters of the rating summaries, a zero field takes its default
+type RatingConfig struct {
+	// Min and Max are the bounds of the rating scale
+	Min float64
+	Max float64
+	// Precision is the step of the ratings from Min, like 0.5 for half stars
+	Precision float64
+	// PriorMean and PriorWeight are the prior of the Bayesian average, which counts as PriorWeight ratings of PriorMean.
+	// PriorMean is the middle of the scale unless it is set
+	PriorMean   float64
+	PriorWeight float64
+	// HalfLife is the age at which a rating weighs half in the time-decayed score
+	HalfLife time.Duration
+}
+
+func (config RatingConfig) withDefaults() RatingConfig {
+	if config.Min == 0 && config.Max == 0 {
+		config.Min, config.Max = DefaultRatingMin, DefaultRatingMax
+	}
+	if config.Precision <= 0 {
+		config.Precision = DefaultRatingPrecision
+	}
+	if config.PriorMean == 0 {
+		config.PriorMean = (config.Min + config.Max) / 2
+	}
+	if config.PriorWeight <= 0 {
+		config.PriorWeight = DefaultRatingPriorWeight
+	}
+	if config.HalfLife <= 0 {
+		config.HalfLife = DefaultRatingHalfLife
+	}
+	return config
+}
+
+// check returns ErrInvalidRating if the score is out of the scale or is not a step of the precision
+func (config RatingConfig) check(score float64) error {
+	// NaN fails both comparisons
+	if !(score >= config.Min && score <= config.Max) {
+		return fmt.Errorf("rating %v is out of the scale %v to %v: %w", score, config.Min, config.Max, ErrInvalidRating)
+	}
+	steps := (score - config.Min) / config.Precision
+	if math.Abs(steps-math.Round(steps)) > 1e-9 {
+		return fmt.Errorf("rating %v is not a multiple of %v: %w", score, config.Precision, ErrInvalidRating)
+	}
+	return nil
+}
+
+// RatingSummary describes the ratings of a laptop
+type RatingSummary struct {
+	Count   uint32
+	Average float64
+	Median  float64
+	// BayesianAverage pulls the average of few ratings towards the prior mean
+	BayesianAverage float64
+	// DecayedScore is the Bayesian average with the ratings weighing less as they age,
+	// a laptop which is not rated for long drifts towards the prior mean
+	DecayedScore float64
+	// Distribution counts the ratings of every step of the scale
+	Distribution []RatingBucket
+}
+
+type RatingBucket struct {
+	Score float64
+	Count uint32
+}
+
+// summarize returns the summary of the rating of a laptop and of its ratings at the time
+func (config RatingConfig) summarize(rating *Rating, ratings []*UserRating, now time.Time) *RatingSummary {
+	summary := &RatingSummary{
+		Count:           rating.Count,
+		Average:         rating.Average(),
+		Median:          rating.Median(),
+		BayesianAverage: (config.PriorWeight*config.PriorMean + rating.Sum) / (config.PriorWeight + float64(rating.Count)),
+	}
+
+	weight, sum := config.PriorWeight, config.PriorWeight*config.PriorMean
+	for _, r := range ratings {
+		age := now.Sub(r.RatedAt)
+		if age < 0 {
+			age = 0
+		}
+		w := math.Exp2(-float64(age) / float64(config.HalfLife))
+		weight += w
+		sum += w * r.Score
+	}
+	summary.DecayedScore = sum / weight
+
+	steps := int(math.Round((config.Max - config.Min) / config.Precision))
+	summary.Distribution = make([]RatingBucket, steps+1)
+	for i := range summary.Distribution {
+		summary.Distribution[i].Score = config.Min + float64(i)*config.Precision
+	}
+	for score, count := range rating.Histogram {
+		// the scores rated before a change of the scale are left out
+		i := int(math.Round((score - config.Min) / config.Precision))
+		if i >= 0 && i <= steps {
+			summary.Distribution[i].Count += count
+		}
+	}
+	return summary
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"pcbook/pb"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+)
+
+// NewRESTGateway returns the REST gateway proxying the services to the gRPC server at the endpoint.
+// The image handler is mounted next to the services if it is not nil, its stores must be the ones
+// of the gRPC server, so only the process running that server can serve the images
+func NewRESTGateway(ctx context.Context, grpcEndpoint string, dialOptions []grpc.DialOption, imageHandler *ImageHTTPHandler, interceptor *AuthInterceptor) (*runtime.ServeMux, error) {
+	mux := runtime.NewServeMux()
+
+	err := pb.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint, dialOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = pb.RegisterLaptopServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint, dialOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = pb.RegisterReviewServiceHandlerFromEndpoint(ctx, mux, grpcEndpoint, dialOptions)
+	if err != nil {
+		return nil, err
+	}
+	if imageHandler != nil {
+		// images are served and uploaded by plain HTTP handlers with the role checks of the gRPC server
+		err = imageHandler.Register(mux, interceptor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mux, nil
+}
@@ -0,0 +1,198 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientReviews(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	reviewStore := service.NewInMemoryReviewStore()
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	interceptor := service.NewAuthInterceptor(jwtManager, map[string][]string{
+		"/my.pcbook.ReviewService/CreateReview":   {"admin", "user"},
+		"/my.pcbook.ReviewService/VoteReview":     {"admin", "user"},
+		"/my.pcbook.ReviewService/ModerateReview": {"admin"},
+	})
+
+	reviewServer := service.NewReviewServer(reviewStore, laptopStore, service.ReviewServerConfig{
+		Screener:       service.NewBannedWordFilter("scam"),
+		ModeratorRoles: []string{"admin"},
+	})
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()))
+	pb.RegisterReviewServiceServer(grpcServer, reviewServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	reviewClient := pb.NewReviewServiceClient(conn)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	roleContext := func(username string, role string) context.Context {
+		token := newTestToken(t, jwtManager, username, role)
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", token)
+	}
+	user1, user2 := roleContext("user1", "user"), roleContext("user2", "user")
+	admin := roleContext("admin1", "admin")
+	anonymous := context.Background()
+
+	list := func(ctx context.Context, state pb.Review_State) []*pb.Review {
+		res, err := reviewClient.ListReviews(ctx, &pb.ListReviewsRequest{LaptopId: laptop.GetId(), State: state})
+		require.NoError(t, err)
+		return res.GetReviews()
+	}
+	requireCode := func(code codes.Code, err error) {
+		require.Error(t, err)
+		require.Equal(t, code, status.Code(err))
+	}
+
+	_, err = reviewClient.CreateReview(anonymous, &pb.CreateReviewRequest{Review: sample.NewReview(laptop.GetId())})
+	requireCode(codes.Unauthenticated, err)
+
+	written := sample.NewReview(laptop.GetId())
+	written.Author = "someone else"
+	res, err := reviewClient.CreateReview(user1, &pb.CreateReviewRequest{Review: written})
+	require.NoError(t, err)
+	review := res.GetReview()
+	require.NotEmpty(t, review.GetId())
+	require.Equal(t, "user1", review.GetAuthor())
+	require.Equal(t, pb.Review_PENDING, review.GetState())
+
+	_, err = reviewClient.CreateReview(user1, &pb.CreateReviewRequest{Review: sample.NewReview(laptop.GetId())})
+	requireCode(codes.AlreadyExists, err)
+
+	banned := sample.NewReview(laptop.GetId())
+	banned.Cons = []string{"it is a Scam"}
+	_, err = reviewClient.CreateReview(user2, &pb.CreateReviewRequest{Review: banned})
+	requireCode(codes.InvalidArgument, err)
+
+	invalid := sample.NewReview(laptop.GetId())
+	invalid.Rating = 11
+	_, err = reviewClient.CreateReview(user2, &pb.CreateReviewRequest{Review: invalid})
+	requireCode(codes.InvalidArgument, err)
+
+	_, err = reviewClient.CreateReview(user2, &pb.CreateReviewRequest{Review: sample.NewReview(sample.NewLaptop().GetId())})
+	requireCode(codes.NotFound, err)
+
+	// the pending review is listed for its author and the moderators only
+	require.Empty(t, list(anonymous, pb.Review_UNKNOWN))
+	require.Empty(t, list(user2, pb.Review_UNKNOWN))
+	require.Len(t, list(user1, pb.Review_UNKNOWN), 1)
+	require.Len(t, list(admin, pb.Review_PENDING), 1)
+	_, err = reviewClient.ListReviews(user2, &pb.ListReviewsRequest{LaptopId: laptop.GetId(), State: pb.Review_PENDING})
+	requireCode(codes.PermissionDenied, err)
+	_, err = reviewClient.ListReviews(anonymous, &pb.ListReviewsRequest{})
+	requireCode(codes.InvalidArgument, err)
+
+	_, err = reviewClient.VoteReview(user2, &pb.VoteReviewRequest{ReviewId: review.GetId(), Helpful: true})
+	requireCode(codes.NotFound, err)
+
+	_, err = reviewClient.ModerateReview(user2, &pb.ModerateReviewRequest{ReviewId: review.GetId(), State: pb.Review_APPROVED})
+	requireCode(codes.PermissionDenied, err)
+	_, err = reviewClient.ModerateReview(admin, &pb.ModerateReviewRequest{ReviewId: review.GetId(), State: pb.Review_PENDING})
+	requireCode(codes.InvalidArgument, err)
+
+	moderated, err := reviewClient.ModerateReview(admin, &pb.ModerateReviewRequest{ReviewId: review.GetId(), State: pb.Review_APPROVED, Note: "fine"})
+	require.NoError(t, err)
+	require.Equal(t, pb.Review_APPROVED, moderated.GetReview().GetState())
+	require.Equal(t, "admin1", moderated.GetReview().GetModeratedBy())
+	require.Equal(t, "fine", moderated.GetReview().GetModerationNote())
+	require.NotNil(t, moderated.GetReview().GetModeratedAt())
+
+	// the approved and rejected states are final
+	_, err = reviewClient.ModerateReview(admin, &pb.ModerateReviewRequest{ReviewId: review.GetId(), State: pb.Review_REJECTED})
+	requireCode(codes.FailedPrecondition, err)
+
+	reviews := list(anonymous, pb.Review_UNKNOWN)
+	require.Len(t, reviews, 1)
+	require.Equal(t, review.GetId(), reviews[0].GetId())
+	require.Len(t, list(anonymous, pb.Review_APPROVED), 1)
+
+	// a repeat vote replaces the previous one
+	vote, err := reviewClient.VoteReview(user2, &pb.VoteReviewRequest{ReviewId: review.GetId(), Helpful: true})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), vote.GetReview().GetHelpfulCount())
+	vote, err = reviewClient.VoteReview(user2, &pb.VoteReviewRequest{ReviewId: review.GetId(), Helpful: false})
+	require.NoError(t, err)
+	require.Zero(t, vote.GetReview().GetHelpfulCount())
+	require.Equal(t, uint32(1), vote.GetReview().GetUnhelpfulCount())
+	_, err = reviewClient.VoteReview(user1, &pb.VoteReviewRequest{ReviewId: review.GetId(), Helpful: true})
+	requireCode(codes.FailedPrecondition, err)
+	_, err = reviewClient.VoteReview(anonymous, &pb.VoteReviewRequest{ReviewId: review.GetId(), Helpful: true})
+	requireCode(codes.Unauthenticated, err)
+
+	// a rejected review stays hidden from others
+	res, err = reviewClient.CreateReview(user2, &pb.CreateReviewRequest{Review: sample.NewReview(laptop.GetId())})
+	require.NoError(t, err)
+	_, err = reviewClient.ModerateReview(admin, &pb.ModerateReviewRequest{ReviewId: res.GetReview().GetId(), State: pb.Review_REJECTED})
+	require.NoError(t, err)
+	require.Len(t, list(anonymous, pb.Review_UNKNOWN), 1)
+	require.Len(t, list(user2, pb.Review_UNKNOWN), 2)
+	require.Len(t, list(admin, pb.Review_REJECTED), 1)
+}
+
+func TestClientListReviewsPages(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	reviewStore := service.NewInMemoryReviewStore()
+	reviewServer := service.NewReviewServer(reviewStore, laptopStore, service.ReviewServerConfig{})
+	grpcServer := grpc.NewServer()
+	pb.RegisterReviewServiceServer(grpcServer, reviewServer)
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	reviewClient := pb.NewReviewServiceClient(conn)
+
+	laptopId := sample.NewLaptop().GetId()
+	now := time.Now()
+	n := 7
+	for i := 0; i < n; i++ {
+		review := newTestReview(laptopId, "user"+string(rune('0'+i)), now.Add(time.Duration(i)*time.Millisecond))
+		review.State = pb.Review_APPROVED
+		require.NoError(t, reviewStore.Save(review))
+	}
+
+	req := &pb.ListReviewsRequest{LaptopId: laptopId, PageSize: 3}
+	var authors []string
+	for pages := 1; ; pages++ {
+		res, err := reviewClient.ListReviews(context.Background(), req)
+		require.NoError(t, err)
+		for _, review := range res.GetReviews() {
+			authors = append(authors, review.GetAuthor())
+		}
+		if res.GetNextPageToken() == "" {
+			require.Equal(t, 3, pages)
+			break
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+	require.Equal(t, []string{"user6", "user5", "user4", "user3", "user2", "user1", "user0"}, authors)
+
+	req.PageToken = "not a token"
+	_, err = reviewClient.ListReviews(context.Background(), req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
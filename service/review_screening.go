@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrTextRejected is returned by a TextScreener for a text which must not be published
+var ErrTextRejected = errors.New("text is rejected")
+
+// TextScreener checks the text of a review before it is saved,
+// it returns an error wrapping ErrTextRejected to reject the review
+type TextScreener interface {
+	Screen(ctx context.Context, text string) error
+}
+
+// TextScreenerFunc is a function used as a TextScreener
+type TextScreenerFunc func(ctx context.Context, text string) error
+
+func (screen TextScreenerFunc) Screen(ctx context.Context, text string) error {
+	return screen(ctx, text)
+}
+
+// BannedWordFilter rejects the texts containing one of its words, ignoring case
+type BannedWordFilter struct {
+	words map[string]bool
+}
+
+func NewBannedWordFilter(words ...string) *BannedWordFilter {
+	filter := &BannedWordFilter{words: make(map[string]bool)}
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			filter.words[word] = true
+		}
+	}
+	return filter
+}
+
+func (filter *BannedWordFilter) Screen(ctx context.Context, text string) error {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		if filter.words[word] {
+			return fmt.Errorf("word %q is banned: %w", word, ErrTextRejected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"pcbook/pb"
+	"pcbook/validation"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// errReviewModerated is returned for a moderation which is not a transition from the state of the review
+var errReviewModerated = errors.New("review is already moderated")
+
+// reviewTransitions are the moderation state changes, the approved and rejected states are final
+var reviewTransitions = map[pb.Review_State][]pb.Review_State{
+	pb.Review_PENDING: {pb.Review_APPROVED, pb.Review_REJECTED},
+}
+
+func canModerate(from pb.Review_State, to pb.Review_State) bool {
+	for _, state := range reviewTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+type ReviewServerConfig struct {
+	// Screener checks the text of the new reviews, they are not screened if it is nil
+	Screener TextScreener
+	// ModeratorRoles are the roles which can list the reviews of every state,
+	// they should be the roles of ModerateReview
+	ModeratorRoles []string
+	// Rating is the scale of the ratings of the reviews
+	Rating RatingConfig
+}
+
+// ReviewServer serves the written reviews of the laptops, a review is published once an admin approves it
+type ReviewServer struct {
+	reviewStore ReviewStore
+	laptopStore LaptopStore
+	config      ReviewServerConfig
+}
+
+func NewReviewServer(reviewStore ReviewStore, laptopStore LaptopStore, config ReviewServerConfig) *ReviewServer {
+	config.Rating = config.Rating.withDefaults()
+	return &ReviewServer{reviewStore: reviewStore, laptopStore: laptopStore, config: config}
+}
+
+// CreateReview saves a pending review of the authorized user, it is screened first
+func (server *ReviewServer) CreateReview(ctx context.Context, req *pb.CreateReviewRequest) (*pb.CreateReviewResponse, error) {
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "review needs an authorized user")
+	}
+	written := req.GetReview()
+	log.Printf("receive a create-review request with laptopId: %s, author: %s", written.GetLaptopId(), claims.Username)
+
+	err := validation.ValidateReview(written).Err("review")
+	if err != nil {
+		return nil, err
+	}
+	err = server.config.Rating.check(written.GetRating())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "rating is invalid: %v", err)
+	}
+
+	_, err = server.laptopStore.Find(written.GetLaptopId())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find laptop: %v", err)
+	}
+
+	if server.config.Screener != nil {
+		text := []string{written.GetTitle(), written.GetBody()}
+		text = append(text, written.GetPros()...)
+		text = append(text, written.GetCons()...)
+		err = server.config.Screener.Screen(ctx, strings.Join(text, "\n"))
+		if errors.Is(err, ErrTextRejected) {
+			return nil, status.Errorf(codes.InvalidArgument, "review is rejected: %v", err)
+		}
+		if err != nil {
+			log.Print(err)
+			return nil, status.Errorf(codes.Internal, "cannot screen review: %v", err)
+		}
+	}
+
+	review := &pb.Review{
+		Id:        uuid.New().String(),
+		LaptopId:  written.GetLaptopId(),
+		Author:    claims.Username,
+		Title:     written.GetTitle(),
+		Body:      written.GetBody(),
+		Pros:      written.GetPros(),
+		Cons:      written.GetCons(),
+		Rating:    written.GetRating(),
+		State:     pb.Review_PENDING,
+		CreatedAt: timestamppb.Now(),
+	}
+	err = server.reviewStore.Save(review)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrAlreadyExists) {
+			code = codes.AlreadyExists
+		}
+		return nil, status.Errorf(code, "cannot save review: %v", err)
+	}
+
+	log.Printf("review with id: %s is saved, pending moderation", review.GetId())
+	return &pb.CreateReviewResponse{Review: review}, nil
+}
+
+// ListReviews returns a page of the reviews of a laptop, the most recent first.
+// Moderators can list the reviews of any state, others see the approved reviews and their own ones
+func (server *ReviewServer) ListReviews(ctx context.Context, req *pb.ListReviewsRequest) (*pb.ListReviewsResponse, error) {
+	log.Printf("receive a list-reviews request with laptopId: %s, page_size: %d, state: %s", req.GetLaptopId(), req.GetPageSize(), req.GetState())
+
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page size must not be negative")
+	} else if pageSize == 0 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	filter := ReviewFilter{LaptopID: req.GetLaptopId()}
+	if req.GetState() != pb.Review_UNKNOWN {
+		filter.States = []pb.Review_State{req.GetState()}
+	}
+
+	claims, _ := UserClaimsFromContext(ctx)
+	if !server.isModerator(claims) {
+		if filter.LaptopID == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "laptop ID is required")
+		}
+		if req.GetState() != pb.Review_UNKNOWN && req.GetState() != pb.Review_APPROVED {
+			return nil, status.Errorf(codes.PermissionDenied, "only moderators can list %s reviews", req.GetState())
+		}
+		filter.States = []pb.Review_State{pb.Review_APPROVED}
+		if claims != nil {
+			filter.Author = claims.Username
+		}
+	}
+
+	var cursor *ReviewCursor
+	if len(req.GetPageToken()) > 0 {
+		var err error
+		cursor, err = DecodeReviewCursor(req.GetPageToken())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+	}
+
+	reviews, err := server.reviewStore.List(filter, cursor, pageSize+1)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list reviews from store: %v", err)
+	}
+
+	res := &pb.ListReviewsResponse{}
+	if len(reviews) > pageSize {
+		reviews = reviews[:pageSize]
+		res.NextPageToken = newReviewCursor(reviews[pageSize-1]).Encode()
+	}
+	res.Reviews = reviews
+	return res, nil
+}
+
+func (server *ReviewServer) isModerator(claims *UserClaims) bool {
+	if claims == nil {
+		return false
+	}
+	for _, role := range server.config.ModeratorRoles {
+		if role == claims.Role {
+			return true
+		}
+	}
+	return false
+}
+
+// VoteReview records whether the authorized user found an approved review helpful,
+// the authors cannot vote on their own reviews
+func (server *ReviewServer) VoteReview(ctx context.Context, req *pb.VoteReviewRequest) (*pb.VoteReviewResponse, error) {
+	claims, ok := UserClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "vote needs an authorized user")
+	}
+	reviewId := req.GetReviewId()
+	log.Printf("receive a vote-review request with reviewId: %s, helpful: %t, username: %s", reviewId, req.GetHelpful(), claims.Username)
+
+	review, err := server.reviewStore.Find(reviewId)
+	if err == nil && review.GetState() != pb.Review_APPROVED {
+		err = ErrNotFound
+	}
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, status.Errorf(code, "cannot find review: %v", err)
+	}
+	if review.GetAuthor() == claims.Username {
+		return nil, status.Errorf(codes.FailedPrecondition, "authors cannot vote on their own reviews")
+	}
+
+	review, err = server.reviewStore.Vote(reviewId, claims.Username, req.GetHelpful())
+	if err != nil {
+		log.Print(err)
+		return nil, status.Errorf(codes.Internal, "cannot save vote: %v", err)
+	}
+	return &pb.VoteReviewResponse{Review: review}, nil
+}
+
+// ModerateReview approves or rejects a pending review
+func (server *ReviewServer) ModerateReview(ctx context.Context, req *pb.ModerateReviewRequest) (*pb.ModerateReviewResponse, error) {
+	reviewId := req.GetReviewId()
+	state := req.GetState()
+	log.Printf("receive a moderate-review request with reviewId: %s, state: %s", reviewId, state)
+
+	if state != pb.Review_APPROVED && state != pb.Review_REJECTED {
+		return nil, status.Errorf(codes.InvalidArgument, "state must be APPROVED or REJECTED, got %s", state)
+	}
+
+	moderatedBy := ""
+	if claims, ok := UserClaimsFromContext(ctx); ok {
+		moderatedBy = claims.Username
+	}
+
+	review, err := server.reviewStore.Update(reviewId, func(review *pb.Review) error {
+		if !canModerate(review.GetState(), state) {
+			return fmt.Errorf("cannot move a %s review to %s: %w", review.GetState(), state, errReviewModerated)
+		}
+		review.State = state
+		review.ModeratedBy = moderatedBy
+		review.ModerationNote = req.GetNote()
+		review.ModeratedAt = timestamppb.Now()
+		return nil
+	})
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		} else if errors.Is(err, errReviewModerated) {
+			code = codes.FailedPrecondition
+		}
+		return nil, status.Errorf(code, "cannot moderate review: %v", err)
+	}
+
+	log.Printf("review with id: %s is %s by: %s", reviewId, state, moderatedBy)
+	return &pb.ModerateReviewResponse{Review: review}, nil
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"pcbook/pb"
+	"sort"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ReviewStore keeps the reviews of the laptops, one per author and laptop
+type ReviewStore interface {
+	// Save saves a new review, it returns ErrAlreadyExists if the author already reviewed the laptop
+	Save(review *pb.Review) error
+	Find(id string) (*pb.Review, error)
+	// List returns up to limit reviews matching the filter after the cursor, the most recent first
+	List(filter ReviewFilter, after *ReviewCursor, limit int) ([]*pb.Review, error)
+	// Update changes a review with the update function, the review is left unchanged if it returns an error
+	Update(id string, update func(review *pb.Review) error) (*pb.Review, error)
+	// Vote records whether a user found a review helpful, a repeat vote replaces the previous one
+	Vote(id string, username string, helpful bool) (*pb.Review, error)
+	DeleteByLaptop(laptopId string) error
+}
+
+// ReviewFilter selects the reviews of a listing
+type ReviewFilter struct {
+	// LaptopID selects the reviews of a laptop, the reviews of all the laptops if it is empty
+	LaptopID string
+	// States selects the reviews in the states, all the states if it is empty
+	States []pb.Review_State
+	// Author also selects the reviews of the author whatever their state
+	Author string
+}
+
+func (filter ReviewFilter) match(review *pb.Review) bool {
+	if filter.LaptopID != "" && review.GetLaptopId() != filter.LaptopID {
+		return false
+	}
+	if len(filter.States) == 0 || (filter.Author != "" && review.GetAuthor() == filter.Author) {
+		return true
+	}
+	for _, state := range filter.States {
+		if review.GetState() == state {
+			return true
+		}
+	}
+	return false
+}
+
+// ReviewCursor points to the last review of a page
+type ReviewCursor struct {
+	CreatedAt int64  `json:"t"`
+	ID        string `json:"id"`
+}
+
+func newReviewCursor(review *pb.Review) *ReviewCursor {
+	return &ReviewCursor{CreatedAt: review.GetCreatedAt().AsTime().UnixMicro(), ID: review.GetId()}
+}
+
+// Encode returns the cursor as an opaque page token
+func (cursor *ReviewCursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeReviewCursor parses a page token made by ReviewCursor.Encode
+func DecodeReviewCursor(token string) (*ReviewCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	cursor := &ReviewCursor{}
+	err = json.Unmarshal(data, cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+	return cursor, nil
+}
+
+// before reports whether the review goes after the cursor, the most recent first
+func (cursor *ReviewCursor) before(review *pb.Review) bool {
+	createdAt := review.GetCreatedAt().AsTime().UnixMicro()
+	if createdAt != cursor.CreatedAt {
+		return createdAt < cursor.CreatedAt
+	}
+	return review.GetId() < cursor.ID
+}
+
+type reviewAuthor struct {
+	laptopID string
+	author   string
+}
+
+type InMemoryReviewStore struct {
+	mutex   sync.RWMutex
+	reviews map[string]*pb.Review
+	authors map[reviewAuthor]string
+	// votes maps a review ID to the votes by username, true for helpful
+	votes map[string]map[string]bool
+}
+
+func NewInMemoryReviewStore() *InMemoryReviewStore {
+	return &InMemoryReviewStore{
+		reviews: make(map[string]*pb.Review),
+		authors: make(map[reviewAuthor]string),
+		votes:   make(map[string]map[string]bool),
+	}
+}
+
+func (store *InMemoryReviewStore) Save(review *pb.Review) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.reviews[review.GetId()] != nil {
+		return ErrAlreadyExists
+	}
+	key := reviewAuthor{laptopID: review.GetLaptopId(), author: review.GetAuthor()}
+	if _, ok := store.authors[key]; ok {
+		return fmt.Errorf("%s already reviewed laptop %s: %w", review.GetAuthor(), review.GetLaptopId(), ErrAlreadyExists)
+	}
+
+	store.reviews[review.GetId()] = proto.Clone(review).(*pb.Review)
+	store.authors[key] = review.GetId()
+	return nil
+}
+
+func (store *InMemoryReviewStore) Find(id string) (*pb.Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	review := store.reviews[id]
+	if review == nil {
+		return nil, fmt.Errorf("review with id %s: %w", id, ErrNotFound)
+	}
+	return proto.Clone(review).(*pb.Review), nil
+}
+
+func (store *InMemoryReviewStore) List(filter ReviewFilter, after *ReviewCursor, limit int) ([]*pb.Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var reviews []*pb.Review
+	for _, review := range store.reviews {
+		if filter.match(review) && (after == nil || after.before(review)) {
+			reviews = append(reviews, review)
+		}
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		return newReviewCursor(reviews[i]).before(reviews[j])
+	})
+
+	if len(reviews) > limit {
+		reviews = reviews[:limit]
+	}
+	for i, review := range reviews {
+		reviews[i] = proto.Clone(review).(*pb.Review)
+	}
+	return reviews, nil
+}
+
+func (store *InMemoryReviewStore) Update(id string, update func(review *pb.Review) error) (*pb.Review, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	review := store.reviews[id]
+	if review == nil {
+		return nil, fmt.Errorf("review with id %s: %w", id, ErrNotFound)
+	}
+
+	updated := proto.Clone(review).(*pb.Review)
+	err := update(updated)
+	if err != nil {
+		return nil, err
+	}
+	store.reviews[id] = updated
+	return proto.Clone(updated).(*pb.Review), nil
+}
+
+func (store *InMemoryReviewStore) Vote(id string, username string, helpful bool) (*pb.Review, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	review := store.reviews[id]
+	if review == nil {
+		return nil, fmt.Errorf("review with id %s: %w", id, ErrNotFound)
+	}
+
+	votes := store.votes[id]
+	if votes == nil {
+		votes = make(map[string]bool)
+		store.votes[id] = votes
+	}
+	if previous, ok := votes[username]; ok {
+		countVote(review, previous, -1)
+	}
+	votes[username] = helpful
+	countVote(review, helpful, 1)
+	return proto.Clone(review).(*pb.Review), nil
+}
+
+// countVote adds delta to the helpful or the unhelpful count of the review
+func countVote(review *pb.Review, helpful bool, delta int) {
+	if helpful {
+		review.HelpfulCount = uint32(int(review.HelpfulCount) + delta)
+	} else {
+		review.UnhelpfulCount = uint32(int(review.UnhelpfulCount) + delta)
+	}
+}
+
+func (store *InMemoryReviewStore) DeleteByLaptop(laptopId string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, review := range store.reviews {
+		if review.GetLaptopId() == laptopId {
+			delete(store.reviews, id)
+			delete(store.votes, id)
+			delete(store.authors, reviewAuthor{laptopID: laptopId, author: review.GetAuthor()})
+		}
+	}
+	return nil
+}
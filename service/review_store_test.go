@@ -0,0 +1,147 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestInMemoryReviewStore(t *testing.T) {
+	t.Parallel()
+	testReviewStore(t, service.NewInMemoryReviewStore())
+}
+
+func newTestReview(laptopId string, author string, createdAt time.Time) *pb.Review {
+	review := sample.NewReview(laptopId)
+	review.Id = uuid.New().String()
+	review.Author = author
+	review.State = pb.Review_PENDING
+	review.CreatedAt = timestamppb.New(createdAt)
+	return review
+}
+
+func testReviewStore(t *testing.T, store service.ReviewStore) {
+	now := time.Now().Truncate(time.Microsecond)
+	laptop1, laptop2 := uuid.New().String(), uuid.New().String()
+
+	reviews := make([]*pb.Review, 5)
+	for i := range reviews {
+		reviews[i] = newTestReview(laptop1, "user"+string(rune('1'+i)), now.Add(time.Duration(i)*time.Second))
+		require.NoError(t, store.Save(reviews[i]))
+	}
+	require.NoError(t, store.Save(newTestReview(laptop2, "user1", now)))
+
+	// one review per author and laptop
+	err := store.Save(newTestReview(laptop1, "user1", now))
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+
+	found, err := store.Find(reviews[0].GetId())
+	require.NoError(t, err)
+	require.Equal(t, reviews[0].GetTitle(), found.GetTitle())
+	require.Equal(t, reviews[0].GetPros(), found.GetPros())
+	_, err = store.Find(uuid.New().String())
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	// the reviews are listed the most recent first, page by page
+	filter := service.ReviewFilter{LaptopID: laptop1}
+	page, err := store.List(filter, nil, 3)
+	require.NoError(t, err)
+	require.Len(t, page, 3)
+	require.Equal(t, reviews[4].GetId(), page[0].GetId())
+	require.Equal(t, reviews[2].GetId(), page[2].GetId())
+	cursor, err := service.DecodeReviewCursor((&service.ReviewCursor{
+		CreatedAt: page[2].GetCreatedAt().AsTime().UnixMicro(),
+		ID:        page[2].GetId(),
+	}).Encode())
+	require.NoError(t, err)
+	page, err = store.List(filter, cursor, 3)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	require.Equal(t, reviews[1].GetId(), page[0].GetId())
+	require.Equal(t, reviews[0].GetId(), page[1].GetId())
+
+	errUpdate := errors.New("update failed")
+	_, err = store.Update(reviews[1].GetId(), func(review *pb.Review) error {
+		review.State = pb.Review_APPROVED
+		return errUpdate
+	})
+	require.ErrorIs(t, err, errUpdate)
+	found, err = store.Find(reviews[1].GetId())
+	require.NoError(t, err)
+	require.Equal(t, pb.Review_PENDING, found.GetState())
+
+	updated, err := store.Update(reviews[1].GetId(), func(review *pb.Review) error {
+		review.State = pb.Review_APPROVED
+		review.ModeratedBy = "admin1"
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, pb.Review_APPROVED, updated.GetState())
+	_, err = store.Update(uuid.New().String(), func(review *pb.Review) error { return nil })
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	// the author also selects the own reviews whatever their state
+	filter = service.ReviewFilter{LaptopID: laptop1, States: []pb.Review_State{pb.Review_APPROVED}}
+	page, err = store.List(filter, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, "admin1", page[0].GetModeratedBy())
+	filter.Author = "user4"
+	page, err = store.List(filter, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	require.Equal(t, reviews[3].GetId(), page[0].GetId())
+
+	page, err = store.List(service.ReviewFilter{States: []pb.Review_State{pb.Review_PENDING}}, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 5)
+
+	// a repeat vote replaces the previous one
+	voted, err := store.Vote(reviews[1].GetId(), "user3", true)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), voted.GetHelpfulCount())
+	_, err = store.Vote(reviews[1].GetId(), "user4", true)
+	require.NoError(t, err)
+	voted, err = store.Vote(reviews[1].GetId(), "user3", false)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), voted.GetHelpfulCount())
+	require.Equal(t, uint32(1), voted.GetUnhelpfulCount())
+	found, err = store.Find(reviews[1].GetId())
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), found.GetHelpfulCount())
+	require.Equal(t, uint32(1), found.GetUnhelpfulCount())
+	_, err = store.Vote(uuid.New().String(), "user3", true)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	require.NoError(t, store.DeleteByLaptop(laptop1))
+	page, err = store.List(service.ReviewFilter{}, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, laptop2, page[0].GetLaptopId())
+	_, err = store.Find(reviews[1].GetId())
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	// the author can review the laptop again once its reviews are deleted
+	require.NoError(t, store.Save(newTestReview(laptop1, "user1", now)))
+}
+
+func TestBannedWordFilter(t *testing.T) {
+	t.Parallel()
+
+	filter := service.NewBannedWordFilter("scam", " Junk ", "")
+	ctx := context.Background()
+
+	require.NoError(t, filter.Screen(ctx, "A solid machine for the price"))
+	require.NoError(t, filter.Screen(ctx, "no scammers here"))
+	require.ErrorIs(t, filter.Screen(ctx, "Total SCAM, avoid"), service.ErrTextRejected)
+	require.ErrorIs(t, filter.Screen(ctx, "pros:\njunk!"), service.ErrTextRejected)
+	require.NoError(t, service.NewBannedWordFilter().Screen(ctx, "scam"))
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Client is a minimal client of the object API of S3 compatible storages,
+// it addresses the objects by path like <endpoint>/<bucket>/<key> and signs the requests with AWS signature V4
+type s3Client struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// errPreconditionFailed is returned for a conditional write of an object which has changed
+var errPreconditionFailed = errors.New("object has been modified")
+
+// s3Error is the error document of a failed request
+type s3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (err *s3Error) Error() string {
+	return fmt.Sprintf("s3 error %d %s: %s", err.StatusCode, err.Code, err.Message)
+}
+
+// completedPart is a part of a multipart upload in the request completing it
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// do sends a signed request for an object with the body and returns the response,
+// a response with an error status is returned as an s3Error
+func (client *s3Client) do(method string, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	target := *client.endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + client.bucket + "/" + key
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create s3 request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	signS3Request(req, body, client.region, client.accessKey, client.secretKey, time.Now())
+
+	res, err := client.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send s3 request: %w", err)
+	}
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		s3Err := &s3Error{StatusCode: res.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+		xml.Unmarshal(data, s3Err)
+		if res.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("object %s: %v: %w", key, s3Err, ErrNotFound)
+		}
+		if res.StatusCode == http.StatusPreconditionFailed {
+			return nil, fmt.Errorf("object %s: %v: %w", key, s3Err, errPreconditionFailed)
+		}
+		return nil, s3Err
+	}
+	return res, nil
+}
+
+func (client *s3Client) putObject(key string, data []byte, contentType string) error {
+	res, err := client.do(http.MethodPut, key, nil, data, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// putObjectIfMatch puts an object only if its ETag is still etag, or if it does not exist when etag is empty,
+// otherwise it returns errPreconditionFailed
+func (client *s3Client) putObjectIfMatch(key string, data []byte, contentType string, etag string) error {
+	header := http.Header{"Content-Type": {contentType}}
+	if etag == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", etag)
+	}
+	res, err := client.do(http.MethodPut, key, nil, data, header)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// readObject returns the data of a small object and its ETag
+func (client *s3Client) readObject(key string) ([]byte, string, error) {
+	res, err := client.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot read object %s: %w", key, err)
+	}
+	return data, res.Header.Get("ETag"), nil
+}
+
+// getObject returns the data of an object, it must be closed by the caller
+func (client *s3Client) getObject(key string) (io.ReadCloser, error) {
+	res, err := client.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// deleteObject deletes an object, a missing object is not an error
+func (client *s3Client) deleteObject(key string) error {
+	res, err := client.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// createMultipartUpload starts a multipart upload of an object and returns its upload ID
+func (client *s3Client) createMultipartUpload(key string, contentType string) (string, error) {
+	res, err := client.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("cannot decode multipart upload: %w", err)
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart uploads a part of a multipart upload and returns its ETag
+func (client *s3Client) uploadPart(key string, uploadID string, partNumber int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {fmt.Sprint(partNumber)}, "uploadId": {uploadID}}
+	res, err := client.do(http.MethodPut, key, query, data, nil)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	return res.Header.Get("ETag"), nil
+}
+
+func (client *s3Client) completeMultipartUpload(key string, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return fmt.Errorf("cannot encode completed parts: %w", err)
+	}
+
+	res, err := client.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body, http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// the upload can still fail after the status is sent, then the body is an error document
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read multipart upload result: %w", err)
+	}
+	if bytes.Contains(data, []byte("<Error>")) {
+		s3Err := &s3Error{StatusCode: res.StatusCode}
+		xml.Unmarshal(data, s3Err)
+		return s3Err
+	}
+	return nil
+}
+
+func (client *s3Client) abortMultipartUpload(key string, uploadID string) error {
+	res, err := client.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// signS3Request adds the AWS signature V4 of the request to its Authorization header,
+// all the headers set on the request are signed
+func signS3Request(req *http.Request, body []byte, region string, accessKey string, secretKey string, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		canonicalS3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	date := amzDate[:8]
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalS3Query returns the query sorted by name with the names and the values escaped
+func canonicalS3Query(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes every byte but the unreserved characters, and the slashes unless escapeSlash is set
+func s3Escape(s string, escapeSlash bool) string {
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			escaped.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,472 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultS3PartSize is the part size of the multipart uploads unless it is configured,
+// it is the smallest part size S3 accepts
+const DefaultS3PartSize = 5 << 20
+
+// DefaultS3Timeout is the time limit of a request to the storage unless it is configured,
+// it includes reading the response so it bounds the download of an image too
+const DefaultS3Timeout = time.Minute
+
+// s3IndexRetries is how many times an update of a laptop index is tried when another server changes it
+const s3IndexRetries = 10
+
+type S3ImageStoreConfig struct {
+	// Endpoint is the URL of the S3 compatible API, like https://s3.us-east-1.amazonaws.com
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// PartSize is the size of the parts of a multipart upload, a smaller image is uploaded with a single request
+	PartSize int64
+	// TempFolder keeps an upload while its variants are made, it is the system temporary folder if it is empty
+	TempFolder string
+	// MaxImageSize is the size limit of an image in bytes
+	MaxImageSize int64
+	// MaxWidth and MaxHeight are the dimension limits of an image in pixels
+	MaxWidth  int
+	MaxHeight int
+	// Timeout is the time limit of a request, a stalled storage would block the calls forever without it
+	Timeout time.Duration
+	// HTTPClient sends the requests, it is a client with the timeout if it is nil
+	HTTPClient *http.Client
+}
+
+// S3ImageStore keeps the images and their variants as objects of a bucket of an S3 compatible storage,
+// so several servers can share them. The infos are objects of the bucket too and are read on every call:
+// images/<id>.json is the info of an image, laptops/<laptop id>/images.json is the index of the images
+// of a laptop in upload order with the primary one. The index is changed with conditional writes
+type S3ImageStore struct {
+	config S3ImageStoreConfig
+	client *s3Client
+}
+
+// s3ImageIndex is the index object of the images of a laptop
+type s3ImageIndex struct {
+	Images  []*ImageInfo `json:"images"`
+	Primary string       `json:"primary"`
+}
+
+func imageInfoKey(imageID string) string {
+	return "images/" + imageID + ".json"
+}
+
+func imageIndexKey(laptopID string) string {
+	return "laptops/" + laptopID + "/images.json"
+}
+
+func NewS3ImageStore(config S3ImageStoreConfig) (*S3ImageStore, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is not set")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = DefaultS3PartSize
+	}
+	if config.TempFolder == "" {
+		config.TempFolder = os.TempDir()
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultS3Timeout
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: config.Timeout}
+	}
+	limits := DiskImageStoreConfig{MaxImageSize: config.MaxImageSize, MaxWidth: config.MaxWidth, MaxHeight: config.MaxHeight}.withDefaults()
+	config.MaxImageSize, config.MaxWidth, config.MaxHeight = limits.MaxImageSize, limits.MaxWidth, limits.MaxHeight
+
+	return &S3ImageStore{
+		config: config,
+		client: &s3Client{
+			endpoint:  endpoint,
+			bucket:    config.Bucket,
+			region:    config.Region,
+			accessKey: config.AccessKey,
+			secretKey: config.SecretKey,
+			client:    config.HTTPClient,
+		},
+	}, nil
+}
+
+// Save checks the image and spools it to a temporary file to make its variants,
+// then uploads the image and its variants as the objects images/<id><type> and images/<id>_<variant><type>.
+// The image is visible once it is added to the index of its laptop
+func (store *S3ImageStore) Save(laptopID string, imageType string, imageData io.Reader, uploadedBy string) (string, error) {
+	imageID, err := uuid.NewUUID()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate a new image ID: %w", err)
+	}
+
+	data, config, err := checkImage(io.LimitReader(imageData, store.config.MaxImageSize+1), imageType, store.config.MaxWidth, store.config.MaxHeight)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	tempPath, size, err := writeTempFile(store.config.TempFolder, "pcbook-image-*.tmp", io.TeeReader(data, hash), store.config.MaxImageSize)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempPath)
+
+	file, err := os.Open(tempPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot open image file: %w", err)
+	}
+	defer file.Close()
+
+	encoded, err := makeImageVariants(file)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("cannot seek image file: %w", err)
+	}
+
+	image := &ImageInfo{
+		ID:          imageID.String(),
+		LaptopID:    laptopID,
+		Type:        imageType,
+		ContentType: contentType(imageType),
+		Path:        fmt.Sprintf("images/%s%s", imageID, imageType),
+		Size:        size,
+		Digest:      hex.EncodeToString(hash.Sum(nil)),
+		UploadedAt:  time.Now(),
+		UploadedBy:  uploadedBy,
+		Width:       config.Width,
+		Height:      config.Height,
+	}
+
+	err = store.upload(image.Path, file, size, image.ContentType)
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range encoded {
+		e.variant.Path = fmt.Sprintf("images/%s_%s%s", imageID, e.variant.Name, e.variant.Type)
+		err = store.client.putObject(e.variant.Path, e.data, e.variant.ContentType)
+		if err != nil {
+			store.removeObjects(image)
+			return "", fmt.Errorf("cannot upload %s variant: %w", e.variant.Name, err)
+		}
+		image.Variants = append(image.Variants, e.variant)
+	}
+
+	info, err := json.Marshal(image)
+	if err != nil {
+		store.removeObjects(image)
+		return "", fmt.Errorf("cannot encode image info: %w", err)
+	}
+	err = store.client.putObject(imageInfoKey(image.ID), info, "application/json")
+	if err != nil {
+		store.removeObjects(image)
+		return "", fmt.Errorf("cannot upload image info: %w", err)
+	}
+
+	_, err = store.updateIndex(laptopID, func(index *s3ImageIndex) error {
+		if len(index.Images) == 0 {
+			index.Primary = image.ID
+		}
+		index.Images = append(index.Images, image)
+		return nil
+	})
+	if err != nil {
+		store.removeObjects(image)
+		return "", err
+	}
+	return image.ID, nil
+}
+
+// readIndex returns the index of the images of a laptop and its ETag, which is empty if there is no index
+func (store *S3ImageStore) readIndex(laptopID string) (*s3ImageIndex, string, error) {
+	data, etag, err := store.client.readObject(imageIndexKey(laptopID))
+	if errors.Is(err, ErrNotFound) {
+		return &s3ImageIndex{}, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot get image index: %w", err)
+	}
+
+	index := &s3ImageIndex{}
+	err = json.Unmarshal(data, index)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot decode image index of laptop %s: %w", laptopID, err)
+	}
+	return index, etag, nil
+}
+
+// updateIndex changes the index of a laptop with the update function,
+// it is read and updated again if another server has changed it in between
+func (store *S3ImageStore) updateIndex(laptopID string, update func(index *s3ImageIndex) error) (*s3ImageIndex, error) {
+	for attempt := 0; attempt < s3IndexRetries; attempt++ {
+		index, etag, err := store.readIndex(laptopID)
+		if err != nil {
+			return nil, err
+		}
+		err = update(index)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(index)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode image index: %w", err)
+		}
+		err = store.client.putObjectIfMatch(imageIndexKey(laptopID), data, "application/json", etag)
+		if errors.Is(err, errPreconditionFailed) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot upload image index: %w", err)
+		}
+		return index, nil
+	}
+	return nil, fmt.Errorf("image index of laptop %s is changed concurrently: %w", laptopID, errPreconditionFailed)
+}
+
+// readInfo returns the info of an image, without its primary flag which is kept in the index
+func (store *S3ImageStore) readInfo(imageID string) (*ImageInfo, error) {
+	data, _, err := store.client.readObject(imageInfoKey(imageID))
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("image with id %s: %w", imageID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get image info: %w", err)
+	}
+
+	image := &ImageInfo{}
+	err = json.Unmarshal(data, image)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image info of %s: %w", imageID, err)
+	}
+	return image, nil
+}
+
+// upload puts the data as an object, with a multipart upload if it is larger than a part
+func (store *S3ImageStore) upload(key string, data io.Reader, size int64, contentType string) error {
+	if size <= store.config.PartSize {
+		buffer, err := io.ReadAll(data)
+		if err != nil {
+			return fmt.Errorf("cannot read image data: %w", err)
+		}
+		err = store.client.putObject(key, buffer, contentType)
+		if err != nil {
+			return fmt.Errorf("cannot upload image: %w", err)
+		}
+		return nil
+	}
+
+	uploadID, err := store.client.createMultipartUpload(key, contentType)
+	if err != nil {
+		return fmt.Errorf("cannot start multipart upload: %w", err)
+	}
+
+	err = store.uploadParts(key, uploadID, data)
+	if err != nil {
+		if abortErr := store.client.abortMultipartUpload(key, uploadID); abortErr != nil {
+			return fmt.Errorf("%w, cannot abort multipart upload: %v", err, abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (store *S3ImageStore) uploadParts(key string, uploadID string, data io.Reader) error {
+	var parts []completedPart
+	buffer := make([]byte, store.config.PartSize)
+	for {
+		n, err := io.ReadFull(data, buffer)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("cannot read image data: %w", err)
+		}
+
+		partNumber := len(parts) + 1
+		etag, err := store.client.uploadPart(key, uploadID, partNumber, buffer[:n])
+		if err != nil {
+			return fmt.Errorf("cannot upload part %d: %w", partNumber, err)
+		}
+		parts = append(parts, completedPart{PartNumber: partNumber, ETag: etag})
+	}
+
+	err := store.client.completeMultipartUpload(key, uploadID, parts)
+	if err != nil {
+		return fmt.Errorf("cannot complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// removeObjects deletes the objects of an image, of its variants and its info
+func (store *S3ImageStore) removeObjects(image *ImageInfo) error {
+	keys := []string{imageInfoKey(image.ID), image.Path}
+	for _, variant := range image.Variants {
+		keys = append(keys, variant.Path)
+	}
+
+	for _, key := range keys {
+		err := store.client.deleteObject(key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("cannot delete image object: %w", err)
+		}
+	}
+	return nil
+}
+
+// Find returns an image which is in the index of its laptop
+func (store *S3ImageStore) Find(imageID string) (*ImageInfo, error) {
+	image, err := store.readInfo(imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	index, _, err := store.readIndex(image.LaptopID)
+	if err != nil {
+		return nil, err
+	}
+	for _, indexed := range index.Images {
+		if indexed.ID == imageID {
+			indexed.Primary = indexed.ID == index.Primary
+			return indexed, nil
+		}
+	}
+	// the image is being saved or deleted
+	return nil, fmt.Errorf("image with id %s: %w", imageID, ErrNotFound)
+}
+
+// List returns the images of a laptop in upload order
+func (store *S3ImageStore) List(laptopID string) ([]*ImageInfo, error) {
+	index, _, err := store.readIndex(laptopID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, image := range index.Images {
+		image.Primary = image.ID == index.Primary
+	}
+	if index.Images == nil {
+		return []*ImageInfo{}, nil
+	}
+	return index.Images, nil
+}
+
+// Open returns the info of an image and the data of the variant, the data must be closed by the caller
+func (store *S3ImageStore) Open(imageID string, variant string) (*ImageInfo, io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := imageVariantPath(image, variant)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := store.client.getObject(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get image object: %w", err)
+	}
+	return image, data, nil
+}
+
+// Delete removes an image from the index of its laptop then deletes its objects,
+// if it is the primary one the next image of the laptop becomes primary
+func (store *S3ImageStore) Delete(imageID string) error {
+	image, err := store.readInfo(imageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.updateIndex(image.LaptopID, func(index *s3ImageIndex) error {
+		remaining := make([]*ImageInfo, 0, len(index.Images))
+		for _, indexed := range index.Images {
+			if indexed.ID != imageID {
+				remaining = append(remaining, indexed)
+			}
+		}
+		if len(remaining) == len(index.Images) {
+			return fmt.Errorf("image with id %s: %w", imageID, ErrNotFound)
+		}
+
+		index.Images = remaining
+		if index.Primary == imageID {
+			index.Primary = ""
+			if len(remaining) > 0 {
+				index.Primary = remaining[0].ID
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return store.removeObjects(image)
+}
+
+// SetPrimary makes an image the primary one of its laptop
+func (store *S3ImageStore) SetPrimary(imageID string) (*ImageInfo, error) {
+	image, err := store.readInfo(imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = store.updateIndex(image.LaptopID, func(index *s3ImageIndex) error {
+		for _, indexed := range index.Images {
+			if indexed.ID == imageID {
+				index.Primary = imageID
+				return nil
+			}
+		}
+		return fmt.Errorf("image with id %s: %w", imageID, ErrNotFound)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	image.Primary = true
+	return image, nil
+}
+
+// DeleteByLaptop deletes the objects of the images of a laptop then its index
+func (store *S3ImageStore) DeleteByLaptop(laptopID string) error {
+	images, err := store.List(laptopID)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		err := store.removeObjects(image)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = store.client.deleteObject(imageIndexKey(laptopID))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("cannot delete image index: %w", err)
+	}
+	return nil
+}
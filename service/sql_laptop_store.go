@@ -0,0 +1,535 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"pcbook/expr"
+	"pcbook/pb"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// sqlOrderColumns maps the supported order_by fields to the column of their sort key
+var sqlOrderColumns = map[string]string{
+	"id":               "0",
+	"price_usd":        "price_usd",
+	"release_year":     "release_year",
+	"cpu.number_cores": "cpu_cores",
+	"ram":              "ram_bits",
+	"updated_at":       "updated_at",
+}
+
+// SQLLaptopStore keeps the laptops in a database migrated by MigrateSQLDatabase,
+// the change events are only recorded for the writes of this process
+type SQLLaptopStore struct {
+	db     *sql.DB
+	events *LaptopEventLog
+}
+
+func NewSQLLaptopStore(db *sql.DB) *SQLLaptopStore {
+	return &SQLLaptopStore{db: db, events: NewLaptopEventLog(DefaultEventRetention)}
+}
+
+func (store *SQLLaptopStore) Save(laptop *pb.Laptop) error {
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		return insertLaptop(tx, laptop)
+	})
+	if err != nil {
+		return err
+	}
+
+	store.events.Append(pb.LaptopEvent_CREATED, proto.Clone(laptop).(*pb.Laptop), nil)
+	return nil
+}
+
+// SaveAll saves all laptops or none of them, on failure it returns the index of the laptop that can not be saved
+func (store *SQLLaptopStore) SaveAll(laptops []*pb.Laptop) (int, error) {
+	failed := 0
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		for i, laptop := range laptops {
+			err := insertLaptop(tx, laptop)
+			if err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return failed, err
+	}
+
+	for _, laptop := range laptops {
+		store.events.Append(pb.LaptopEvent_CREATED, proto.Clone(laptop).(*pb.Laptop), nil)
+	}
+	return 0, nil
+}
+
+func (store *SQLLaptopStore) Find(id string) (*pb.Laptop, error) {
+	return findLaptop(store.db, id)
+}
+
+// Update applies the fields in paths from laptop to the stored record,
+// laptop.UpdatedAt must match the stored one, otherwise ErrConflict is returned
+func (store *SQLLaptopStore) Update(laptop *pb.Laptop, paths []string) (*pb.Laptop, error) {
+	var stored, updated *pb.Laptop
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		var err error
+		stored, err = findLaptop(tx, laptop.GetId())
+		if err != nil {
+			return err
+		}
+
+		if !proto.Equal(stored.GetUpdatedAt(), laptop.GetUpdatedAt()) {
+			return ErrConflict
+		}
+
+		updated = proto.Clone(stored).(*pb.Laptop)
+		err = applyFieldMask(updated, proto.Clone(laptop), paths)
+		if err != nil {
+			return err
+		}
+		updated.UpdatedAt = timestamppb.Now()
+
+		_, err = tx.Exec(`DELETE FROM laptops WHERE id = ?`, updated.Id)
+		if err != nil {
+			return fmt.Errorf("cannot delete laptop: %w", err)
+		}
+		_, err = tx.Exec(`DELETE FROM laptop_text WHERE id = ?`, updated.Id)
+		if err != nil {
+			return fmt.Errorf("cannot delete laptop text: %w", err)
+		}
+		return insertLaptop(tx, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	store.events.Append(pb.LaptopEvent_UPDATED, updated, stored)
+	return proto.Clone(updated).(*pb.Laptop), nil
+}
+
+// Delete hides the laptop from Find and Search and keeps a tombstone for it
+func (store *SQLLaptopStore) Delete(id string, deletedBy string) error {
+	var laptop *pb.Laptop
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		var err error
+		laptop, err = findLaptop(tx, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE laptops SET deleted_at = ?, deleted_by = ? WHERE id = ?`,
+			time.Now().UnixMicro(), deletedBy, id)
+		if err != nil {
+			return fmt.Errorf("cannot delete laptop: %w", err)
+		}
+		_, err = tx.Exec(`DELETE FROM laptop_text WHERE id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("cannot delete laptop text: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	store.events.Append(pb.LaptopEvent_DELETED, laptop, nil)
+	return nil
+}
+
+// PurgeDeleted permanently removes the tombstones deleted before the given time
+func (store *SQLLaptopStore) PurgeDeleted(before time.Time) (int, error) {
+	result, err := store.db.Exec(`DELETE FROM laptops WHERE deleted_at < ?`, before.UnixMicro())
+	if err != nil {
+		return 0, fmt.Errorf("cannot purge laptops: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("cannot count purged laptops: %w", err)
+	}
+	return int(purged), nil
+}
+
+// Search calls found for every laptop matching both the filter and the program, a nil program matches all,
+// the filter is evaluated by the database
+func (store *SQLLaptopStore) Search(ctx context.Context, filter *pb.Filter, program *expr.Program, found func(laptop *pb.Laptop) error) error {
+	where, args := sqlFilter(filter)
+	rows, err := store.db.QueryContext(ctx, `SELECT data FROM laptops WHERE `+where, args...)
+	if err != nil {
+		return fmt.Errorf("cannot query laptops: %w", err)
+	}
+	defer rows.Close()
+
+	return scanLaptops(rows, func(laptop *pb.Laptop) error {
+		if program != nil && !program.Match(laptop) {
+			return nil
+		}
+		return found(laptop)
+	})
+}
+
+// List returns at most limit laptops in the given order, starting after the cursor
+func (store *SQLLaptopStore) List(ctx context.Context, order LaptopOrder, after *LaptopCursor, limit int) ([]*pb.Laptop, error) {
+	column, ok := sqlOrderColumns[order.Field]
+	if !ok {
+		return nil, fmt.Errorf("cannot order by %q", order.Field)
+	}
+
+	direction, compare := "ASC", ">"
+	if order.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	query := `SELECT data FROM laptops WHERE deleted_at IS NULL`
+	var args []interface{}
+	if after != nil {
+		query += fmt.Sprintf(` AND (%s %s ? OR (%s = ? AND id > ?))`, column, compare, column)
+		args = append(args, after.Key, after.Key, after.ID)
+	}
+	query += fmt.Sprintf(` ORDER BY %s %s, id LIMIT ?`, column, direction)
+	args = append(args, limit)
+
+	rows, err := store.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query laptops: %w", err)
+	}
+	defer rows.Close()
+
+	var laptops []*pb.Laptop
+	err = scanLaptops(rows, func(laptop *pb.Laptop) error {
+		laptops = append(laptops, laptop)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return laptops, nil
+}
+
+// TextSearch calls found for the laptops matching the query and the filter, the best ranked first,
+// the ranking is the BM25 of SQLite full-text search
+func (store *SQLLaptopStore) TextSearch(ctx context.Context, query string, filter *pb.Filter, limit int, found func(laptop *pb.Laptop, score float64) error) error {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	for i, term := range terms {
+		terms[i] = `"` + term + `"`
+	}
+	terms[len(terms)-1] += "*"
+
+	if limit <= 0 {
+		limit = -1
+	}
+
+	where, args := sqlFilter(filter)
+	args = append([]interface{}{strings.Join(terms, " ")}, args...)
+	args = append(args, limit)
+	rows, err := store.db.QueryContext(ctx, `SELECT laptops.data, -bm25(laptop_text) FROM laptop_text
+		JOIN laptops ON laptops.id = laptop_text.id
+		WHERE laptop_text MATCH ? AND `+where+`
+		ORDER BY bm25(laptop_text), laptops.id LIMIT ?`, args...)
+	if err != nil {
+		return fmt.Errorf("cannot query laptops: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		var score float64
+		err := rows.Scan(&data, &score)
+		if err != nil {
+			return fmt.Errorf("cannot scan laptop: %w", err)
+		}
+
+		laptop := &pb.Laptop{}
+		err = proto.Unmarshal(data, laptop)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal laptop: %w", err)
+		}
+
+		err = found(laptop, score)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Suggest returns at most limit completions of the prefix
+func (store *SQLLaptopStore) Suggest(prefix string, limit int) ([]string, error) {
+	words := tokenize(prefix)
+	if len(words) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	last := words[len(words)-1]
+	rows, err := store.db.Query(`SELECT term FROM laptop_terms WHERE substr(term, 1, ?) = ? ORDER BY doc DESC, term LIMIT ?`,
+		len(last), last, limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query terms: %w", err)
+	}
+	defer rows.Close()
+
+	head := strings.Join(words[:len(words)-1], " ")
+	var suggestions []string
+	for rows.Next() {
+		var term string
+		err := rows.Scan(&term)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan term: %w", err)
+		}
+		if len(head) > 0 {
+			term = head + " " + term
+		}
+		suggestions = append(suggestions, term)
+	}
+	return suggestions, rows.Err()
+}
+
+// NotifyRated records a RATED event for the laptop
+func (store *SQLLaptopStore) NotifyRated(id string) error {
+	laptop, err := store.Find(id)
+	if err != nil {
+		return err
+	}
+
+	store.events.Append(pb.LaptopEvent_RATED, laptop, nil)
+	return nil
+}
+
+// Watch calls found for the events after the revision of the laptops matching the filter,
+// until the context is done or the revision falls out of the retention window
+func (store *SQLLaptopStore) Watch(ctx context.Context, revision uint64, filter *pb.Filter, found func(event *LaptopEvent) error) error {
+	return store.events.Watch(ctx, revision, func(event *LaptopEvent) error {
+		if !isQualified(filter, event.Laptop) && (event.Previous == nil || !isQualified(filter, event.Previous)) {
+			return nil
+		}
+
+		other := *event
+		other.Laptop = proto.Clone(event.Laptop).(*pb.Laptop)
+		if event.Previous != nil {
+			other.Previous = proto.Clone(event.Previous).(*pb.Laptop)
+		}
+		return found(&other)
+	})
+}
+
+// queryer is implemented by both sql.DB and sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func findLaptop(db queryer, id string) (*pb.Laptop, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM laptops WHERE id = ? AND deleted_at IS NULL`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("laptop with id %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot query laptop: %w", err)
+	}
+
+	laptop := &pb.Laptop{}
+	err = proto.Unmarshal(data, laptop)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal laptop: %w", err)
+	}
+	return laptop, nil
+}
+
+func scanLaptops(rows *sql.Rows, found func(laptop *pb.Laptop) error) error {
+	for rows.Next() {
+		var data []byte
+		err := rows.Scan(&data)
+		if err != nil {
+			return fmt.Errorf("cannot scan laptop: %w", err)
+		}
+
+		laptop := &pb.Laptop{}
+		err = proto.Unmarshal(data, laptop)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal laptop: %w", err)
+		}
+
+		err = found(laptop)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// insertLaptop inserts the laptop with its GPUs and text, a duplicate id returns ErrAlreadyExists
+func insertLaptop(tx *sql.Tx, laptop *pb.Laptop) error {
+	data, err := proto.Marshal(laptop)
+	if err != nil {
+		return fmt.Errorf("cannot marshal laptop: %w", err)
+	}
+
+	var ssd, hdd uint64
+	for _, storage := range laptop.GetStorages() {
+		switch storage.GetDriver() {
+		case pb.Storage_SDD:
+			ssd += toBit(storage.GetMemory())
+		case pb.Storage_HDD:
+			hdd += toBit(storage.GetMemory())
+		}
+	}
+
+	var weight interface{}
+	if kg, ok := weightKg(laptop); ok {
+		weight = kg
+	}
+
+	screen := laptop.GetScreen()
+	_, err = tx.Exec(`INSERT INTO laptops (id, brand, price_usd, release_year, cpu_cores, cpu_min_ghz, ram_bits,
+		ssd_bits, hdd_bits, screen_size_inch, screen_width, screen_height, screen_panel, multitouch,
+		keyboard_layout, keyboard_backlit, weight_kg, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		laptop.GetId(),
+		laptop.GetBrand(),
+		laptop.GetPriceUsd(),
+		laptop.GetReleaseYear(),
+		laptop.GetCpu().GetNumberCores(),
+		laptop.GetCpu().GetMinGhz(),
+		int64(toBit(laptop.GetRam())),
+		int64(ssd),
+		int64(hdd),
+		float64(screen.GetSizeInch()),
+		screen.GetResolution().GetWidth(),
+		screen.GetResolution().GetHeight(),
+		int32(screen.GetPanel()),
+		screen.GetMulttouch(),
+		int32(laptop.GetKeyboard().GetLayout()),
+		laptop.GetKeyboard().GetBacklit(),
+		weight,
+		laptop.GetUpdatedAt().AsTime().UnixMicro(),
+		data,
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("laptop with id %s: %w", laptop.GetId(), ErrAlreadyExists)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot insert laptop: %w", err)
+	}
+
+	for _, gpu := range laptop.GetGpus() {
+		_, err = tx.Exec(`INSERT INTO laptop_gpus (laptop_id, brand, memory_bits) VALUES (?, ?, ?)`,
+			laptop.GetId(), gpu.GetBrand(), int64(toBit(gpu.GetMemory())))
+		if err != nil {
+			return fmt.Errorf("cannot insert gpu: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO laptop_text (id, text) VALUES (?, ?)`, laptop.GetId(), strings.Join(laptopTexts(laptop), " "))
+	if err != nil {
+		return fmt.Errorf("cannot insert laptop text: %w", err)
+	}
+	return nil
+}
+
+// sqlFilter translates the filter into a condition on the laptops table, unset fields mean no constraint
+func sqlFilter(filter *pb.Filter) (string, []interface{}) {
+	conditions := []string{"laptops.deleted_at IS NULL"}
+	var args []interface{}
+	add := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	if filter.GetMaxPriceUsd() > 0 {
+		add("price_usd <= ?", filter.GetMaxPriceUsd())
+	}
+	if filter.GetMinPriceUsd() > 0 {
+		add("price_usd >= ?", filter.GetMinPriceUsd())
+	}
+	if len(filter.GetBrands()) > 0 {
+		add("brand IN ("+placeholders(len(filter.GetBrands()))+")", toArgs(filter.GetBrands())...)
+	}
+	if filter.GetMinReleaseYear() > 0 {
+		add("release_year >= ?", filter.GetMinReleaseYear())
+	}
+	if filter.GetMaxReleaseYear() > 0 {
+		add("release_year <= ?", filter.GetMaxReleaseYear())
+	}
+	if filter.GetMinCpuCores() > 0 {
+		add("cpu_cores >= ?", filter.GetMinCpuCores())
+	}
+	if filter.GetMinCpuGhz() > 0 {
+		add("cpu_min_ghz >= ?", filter.GetMinCpuGhz())
+	}
+	if filter.GetMinRam() != nil {
+		add("ram_bits >= ?", int64(toBit(filter.GetMinRam())))
+	}
+
+	if len(filter.GetGpuBrands()) > 0 || filter.GetMinGpuMemory() != nil {
+		gpu := []string{"laptop_gpus.laptop_id = laptops.id"}
+		var gpuArgs []interface{}
+		if len(filter.GetGpuBrands()) > 0 {
+			gpu = append(gpu, "laptop_gpus.brand IN ("+placeholders(len(filter.GetGpuBrands()))+")")
+			gpuArgs = append(gpuArgs, toArgs(filter.GetGpuBrands())...)
+		}
+		if filter.GetMinGpuMemory() != nil {
+			gpu = append(gpu, "laptop_gpus.memory_bits >= ?")
+			gpuArgs = append(gpuArgs, int64(toBit(filter.GetMinGpuMemory())))
+		}
+		add("EXISTS (SELECT 1 FROM laptop_gpus WHERE "+strings.Join(gpu, " AND ")+")", gpuArgs...)
+	}
+
+	if filter.GetMinSsdCapacity() != nil {
+		add("ssd_bits >= ?", int64(toBit(filter.GetMinSsdCapacity())))
+	}
+	if filter.GetMinHddCapacity() != nil {
+		add("hdd_bits >= ?", int64(toBit(filter.GetMinHddCapacity())))
+	}
+
+	if filter.GetMinScreenSizeInch() > 0 {
+		add("screen_size_inch >= ?", float64(filter.GetMinScreenSizeInch()))
+	}
+	if filter.GetMaxScreenSizeInch() > 0 {
+		add("screen_size_inch <= ?", float64(filter.GetMaxScreenSizeInch()))
+	}
+	if resolution := filter.GetMinScreenResolution(); resolution != nil {
+		add("screen_width >= ? AND screen_height >= ?", resolution.GetWidth(), resolution.GetHeight())
+	}
+	if len(filter.GetScreenPanels()) > 0 {
+		add("screen_panel IN ("+placeholders(len(filter.GetScreenPanels()))+")", toArgs(filter.GetScreenPanels())...)
+	}
+	if filter != nil && filter.Multitouch != nil {
+		add("multitouch = ?", filter.GetMultitouch())
+	}
+
+	if len(filter.GetKeyboardLayouts()) > 0 {
+		add("keyboard_layout IN ("+placeholders(len(filter.GetKeyboardLayouts()))+")", toArgs(filter.GetKeyboardLayouts())...)
+	}
+	if filter != nil && filter.KeyboardBacklit != nil {
+		add("keyboard_backlit = ?", filter.GetKeyboardBacklit())
+	}
+
+	if filter.GetMaxWeightKg() > 0 {
+		add("weight_kg <= ?", filter.GetMaxWeightKg())
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func toArgs[T any](values []T) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
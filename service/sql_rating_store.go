@@ -0,0 +1,144 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type SQLRatingStore struct {
+	db *sql.DB
+}
+
+func NewSQLRatingStore(db *sql.DB) *SQLRatingStore {
+	return &SQLRatingStore{db: db}
+}
+
+func (store *SQLRatingStore) Save(laptopId string, username string, score float64) (*Rating, error) {
+	var r *Rating
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO user_ratings (laptop_id, username, score, rated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (laptop_id, username) DO UPDATE SET score = excluded.score, rated_at = excluded.rated_at`,
+			laptopId, username, score, time.Now().UnixMicro())
+		if err != nil {
+			return err
+		}
+		r, err = findRating(tx, laptopId)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot save rating: %w", err)
+	}
+	return r, nil
+}
+
+// Find returns the rating of a laptop, an empty one if it is not rated yet
+func (store *SQLRatingStore) Find(laptopId string) (*Rating, error) {
+	r, err := findRating(store.db, laptopId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query rating: %w", err)
+	}
+	return r, nil
+}
+
+func (store *SQLRatingStore) Remove(laptopId string, username string) (*Rating, error) {
+	var r *Rating
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM user_ratings WHERE laptop_id = ? AND username = ?`, laptopId, username)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		r, err = findRating(tx, laptopId)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot remove rating: %w", err)
+	}
+	return r, nil
+}
+
+func (store *SQLRatingStore) ListByUser(username string) ([]*UserRating, error) {
+	return store.queryUserRatings(`SELECT laptop_id, username, score, rated_at FROM user_ratings WHERE username = ?
+		ORDER BY rated_at DESC, laptop_id`, username)
+}
+
+func (store *SQLRatingStore) ListByLaptop(laptopId string) ([]*UserRating, error) {
+	return store.queryUserRatings(`SELECT laptop_id, username, score, rated_at FROM user_ratings WHERE laptop_id = ?
+		ORDER BY rated_at DESC, username`, laptopId)
+}
+
+func (store *SQLRatingStore) queryUserRatings(query string, args ...interface{}) ([]*UserRating, error) {
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query ratings: %w", err)
+	}
+	defer rows.Close()
+
+	var ratings []*UserRating
+	for rows.Next() {
+		r := &UserRating{}
+		var ratedAt int64
+		err = rows.Scan(&r.LaptopID, &r.Username, &r.Score, &ratedAt)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan rating: %w", err)
+		}
+		r.RatedAt = time.UnixMicro(ratedAt)
+		ratings = append(ratings, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read ratings: %w", err)
+	}
+	return ratings, nil
+}
+
+func (store *SQLRatingStore) Delete(laptopId string) error {
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM user_ratings WHERE laptop_id = ?`, laptopId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM legacy_ratings WHERE laptop_id = ?`, laptopId)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot delete rating: %w", err)
+	}
+	return nil
+}
+
+// findRating counts the ratings of a laptop by score,
+// the legacy ratings from before the user ratings only add to the count and sum
+func findRating(db queryer, laptopId string) (*Rating, error) {
+	r := &Rating{Histogram: make(map[float64]uint32)}
+	err := db.QueryRow(`SELECT count, sum FROM legacy_ratings WHERE laptop_id = ?`, laptopId).Scan(&r.Count, &r.Sum)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT score, COUNT(*) FROM user_ratings WHERE laptop_id = ? GROUP BY score`, laptopId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var score float64
+		var count uint32
+		err = rows.Scan(&score, &count)
+		if err != nil {
+			return nil, err
+		}
+		r.Count += count
+		r.Sum += score * float64(count)
+		r.Histogram[score] = count
+	}
+	return r, rows.Err()
+}
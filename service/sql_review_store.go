@@ -0,0 +1,182 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"pcbook/pb"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type SQLReviewStore struct {
+	db *sql.DB
+}
+
+func NewSQLReviewStore(db *sql.DB) *SQLReviewStore {
+	return &SQLReviewStore{db: db}
+}
+
+func (store *SQLReviewStore) Save(review *pb.Review) error {
+	data, err := proto.Marshal(review)
+	if err != nil {
+		return fmt.Errorf("cannot marshal review: %w", err)
+	}
+
+	_, err = store.db.Exec(`INSERT INTO reviews (id, laptop_id, author, state, created_at, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		review.GetId(),
+		review.GetLaptopId(),
+		review.GetAuthor(),
+		int32(review.GetState()),
+		review.GetCreatedAt().AsTime().UnixMicro(),
+		data,
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%s already reviewed laptop %s: %w", review.GetAuthor(), review.GetLaptopId(), ErrAlreadyExists)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot insert review: %w", err)
+	}
+	return nil
+}
+
+func (store *SQLReviewStore) Find(id string) (*pb.Review, error) {
+	return findReview(store.db, id)
+}
+
+func (store *SQLReviewStore) List(filter ReviewFilter, after *ReviewCursor, limit int) ([]*pb.Review, error) {
+	query := `SELECT data FROM reviews WHERE 1 = 1`
+	var args []interface{}
+	if filter.LaptopID != "" {
+		query += ` AND laptop_id = ?`
+		args = append(args, filter.LaptopID)
+	}
+	if len(filter.States) > 0 {
+		query += ` AND (state IN (?` + strings.Repeat(`, ?`, len(filter.States)-1) + `) OR author = ?)`
+		for _, state := range filter.States {
+			args = append(args, int32(state))
+		}
+		// an empty author matches no review, the author of a review is always set
+		args = append(args, filter.Author)
+	}
+	if after != nil {
+		query += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+		args = append(args, after.CreatedAt, after.CreatedAt, after.ID)
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []*pb.Review
+	for rows.Next() {
+		var data []byte
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan review: %w", err)
+		}
+
+		review := &pb.Review{}
+		err = proto.Unmarshal(data, review)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshal review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+func (store *SQLReviewStore) Update(id string, update func(review *pb.Review) error) (*pb.Review, error) {
+	var updated *pb.Review
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		review, err := findReview(tx, id)
+		if err != nil {
+			return err
+		}
+		err = update(review)
+		if err != nil {
+			return err
+		}
+		updated = review
+		return writeReview(tx, review)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (store *SQLReviewStore) Vote(id string, username string, helpful bool) (*pb.Review, error) {
+	var voted *pb.Review
+	err := withTx(store.db, func(tx *sql.Tx) error {
+		review, err := findReview(tx, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO review_votes (review_id, username, helpful) VALUES (?, ?, ?)
+			ON CONFLICT (review_id, username) DO UPDATE SET helpful = excluded.helpful`, id, username, helpful)
+		if err != nil {
+			return fmt.Errorf("cannot save vote: %w", err)
+		}
+		err = tx.QueryRow(`SELECT COALESCE(SUM(helpful), 0), COALESCE(SUM(1 - helpful), 0) FROM review_votes WHERE review_id = ?`, id).
+			Scan(&review.HelpfulCount, &review.UnhelpfulCount)
+		if err != nil {
+			return fmt.Errorf("cannot count votes: %w", err)
+		}
+
+		voted = review
+		return writeReview(tx, review)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return voted, nil
+}
+
+func (store *SQLReviewStore) DeleteByLaptop(laptopId string) error {
+	_, err := store.db.Exec(`DELETE FROM reviews WHERE laptop_id = ?`, laptopId)
+	if err != nil {
+		return fmt.Errorf("cannot delete reviews: %w", err)
+	}
+	return nil
+}
+
+func findReview(db queryer, id string) (*pb.Review, error) {
+	var data []byte
+	err := db.QueryRow(`SELECT data FROM reviews WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("review with id %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot query review: %w", err)
+	}
+
+	review := &pb.Review{}
+	err = proto.Unmarshal(data, review)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal review: %w", err)
+	}
+	return review, nil
+}
+
+// writeReview stores the changed review, its laptop, author and creation time never change
+func writeReview(tx *sql.Tx, review *pb.Review) error {
+	data, err := proto.Marshal(review)
+	if err != nil {
+		return fmt.Errorf("cannot marshal review: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE reviews SET state = ?, data = ? WHERE id = ?`, int32(review.GetState()), data, review.GetId())
+	if err != nil {
+		return fmt.Errorf("cannot update review: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlMigrations are the versions of the schema, each one is applied once in order.
+// Applied versions must not be changed, append a new one instead
+var sqlMigrations = []string{
+	// 1: laptops, the columns are copied from the encoded laptop for filtering and sorting
+	`CREATE TABLE laptops (
+		id TEXT PRIMARY KEY,
+		brand TEXT NOT NULL COLLATE NOCASE,
+		price_usd REAL NOT NULL,
+		release_year INTEGER NOT NULL,
+		cpu_cores INTEGER NOT NULL,
+		cpu_min_ghz REAL NOT NULL,
+		ram_bits INTEGER NOT NULL,
+		ssd_bits INTEGER NOT NULL,
+		hdd_bits INTEGER NOT NULL,
+		screen_size_inch REAL NOT NULL,
+		screen_width INTEGER NOT NULL,
+		screen_height INTEGER NOT NULL,
+		screen_panel INTEGER NOT NULL,
+		multitouch INTEGER NOT NULL,
+		keyboard_layout INTEGER NOT NULL,
+		keyboard_backlit INTEGER NOT NULL,
+		weight_kg REAL,
+		updated_at INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		deleted_at INTEGER,
+		deleted_by TEXT
+	);
+	CREATE INDEX laptops_brand ON laptops (brand) WHERE deleted_at IS NULL;
+	CREATE INDEX laptops_price_usd ON laptops (price_usd, id) WHERE deleted_at IS NULL;
+	CREATE INDEX laptops_release_year ON laptops (release_year, id) WHERE deleted_at IS NULL;
+	CREATE INDEX laptops_cpu_cores ON laptops (cpu_cores, id) WHERE deleted_at IS NULL;
+	CREATE INDEX laptops_ram_bits ON laptops (ram_bits, id) WHERE deleted_at IS NULL;
+	CREATE INDEX laptops_updated_at ON laptops (updated_at, id) WHERE deleted_at IS NULL;
+	CREATE INDEX laptops_deleted_at ON laptops (deleted_at) WHERE deleted_at IS NOT NULL;
+
+	CREATE TABLE laptop_gpus (
+		laptop_id TEXT NOT NULL REFERENCES laptops (id) ON DELETE CASCADE,
+		brand TEXT NOT NULL COLLATE NOCASE,
+		memory_bits INTEGER NOT NULL
+	);
+	CREATE INDEX laptop_gpus_laptop_id ON laptop_gpus (laptop_id);
+
+	CREATE VIRTUAL TABLE laptop_text USING fts5 (id UNINDEXED, text, tokenize = 'unicode61 remove_diacritics 0');
+	CREATE VIRTUAL TABLE laptop_terms USING fts5vocab (laptop_text, 'row');`,
+
+	// 2: users
+	`CREATE TABLE users (
+		username TEXT PRIMARY KEY,
+		hashed_password TEXT NOT NULL,
+		role TEXT NOT NULL
+	);`,
+
+	// 3: ratings
+	`CREATE TABLE ratings (
+		laptop_id TEXT PRIMARY KEY,
+		count INTEGER NOT NULL,
+		sum REAL NOT NULL
+	);`,
+
+	// 4: one rating per user and laptop, the anonymous sums cannot be attributed to users,
+	// they are kept as legacy_ratings and added to the count and sum of the laptop
+	`CREATE TABLE user_ratings (
+		laptop_id TEXT NOT NULL,
+		username TEXT NOT NULL,
+		score REAL NOT NULL,
+		rated_at INTEGER NOT NULL,
+		PRIMARY KEY (laptop_id, username)
+	);
+	CREATE INDEX user_ratings_username ON user_ratings (username, rated_at);
+	ALTER TABLE ratings RENAME TO legacy_ratings;`,
+
+	// 5: reviews, the columns are copied from the encoded review for filtering and sorting
+	`CREATE TABLE reviews (
+		id TEXT PRIMARY KEY,
+		laptop_id TEXT NOT NULL,
+		author TEXT NOT NULL,
+		state INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		UNIQUE (laptop_id, author)
+	);
+	CREATE INDEX reviews_laptop_id ON reviews (laptop_id, created_at, id);
+	CREATE INDEX reviews_state ON reviews (state, created_at, id);
+
+	CREATE TABLE review_votes (
+		review_id TEXT NOT NULL REFERENCES reviews (id) ON DELETE CASCADE,
+		username TEXT NOT NULL,
+		helpful INTEGER NOT NULL,
+		PRIMARY KEY (review_id, username)
+	);`,
+}
+
+// OpenSQLiteDatabase opens the SQLite database at the path and migrates its schema
+func OpenSQLiteDatabase(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database: %w", err)
+	}
+
+	err = MigrateSQLDatabase(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// MigrateSQLDatabase applies the schema versions which are not applied yet
+func MigrateSQLDatabase(db *sql.DB) error {
+	return migrateSQLDatabase(db, sqlMigrations)
+}
+
+func migrateSQLDatabase(db *sql.DB, migrations []string) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("cannot create migrations table: %w", err)
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("cannot read schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the supported version %d", current, len(migrations))
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		err = withTx(db, func(tx *sql.Tx) error {
+			_, err := tx.Exec(migrations[version-1])
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, strftime('%s', 'now'))`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("cannot apply schema version %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction, which is committed if fn returns nil
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// isUniqueViolation tells if the error is caused by a duplicate primary or unique key
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || code == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,205 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/service"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func openTestSQLiteDatabase(t *testing.T) *sql.DB {
+	db, err := service.OpenSQLiteDatabase(filepath.Join(t.TempDir(), "pcbook.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteMigration(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "pcbook.db")
+	db, err := service.OpenSQLiteDatabase(path)
+	require.NoError(t, err)
+	require.NoError(t, service.NewSQLUserStore(db).Save(&service.User{Username: "admin1", Role: "admin"}))
+	require.NoError(t, db.Close())
+
+	// reopening applies no version twice and keeps the data
+	db, err = service.OpenSQLiteDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var versions int
+	err = db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&versions)
+	require.NoError(t, err)
+	require.Equal(t, 5, versions)
+
+	_, err = service.NewSQLUserStore(db).Find("admin1")
+	require.NoError(t, err)
+}
+
+func TestSQLiteMigrationLegacyRatings(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "pcbook.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	require.NoError(t, err)
+	require.NoError(t, service.MigrateSQLDatabaseTo(db, 3))
+	_, err = db.Exec(`INSERT INTO ratings (laptop_id, count, sum) VALUES ('laptop1', 2, 7)`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// the anonymous ratings are kept in the count and sum, but not in the histogram
+	db, err = service.OpenSQLiteDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+	store := service.NewSQLRatingStore(db)
+
+	rating, err := store.Find("laptop1")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, rating.Count)
+	require.Equal(t, 7.0, rating.Sum)
+	require.Empty(t, rating.Histogram)
+	require.Equal(t, 0.0, rating.Median())
+
+	rating, err = store.Save("laptop1", "user1", 5)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, rating.Count)
+	require.Equal(t, 12.0, rating.Sum)
+	require.Equal(t, 4.0, rating.Average())
+	require.Equal(t, 5.0, rating.Median())
+
+	require.NoError(t, store.Delete("laptop1"))
+	rating, err = store.Find("laptop1")
+	require.NoError(t, err)
+	require.Zero(t, rating.Count)
+}
+
+func TestSQLLaptopStoreSearchFilter(t *testing.T) {
+	t.Parallel()
+	testLaptopStoreSearchFilter(t, service.NewSQLLaptopStore(openTestSQLiteDatabase(t)))
+}
+
+func TestSQLLaptopStoreTextSearch(t *testing.T) {
+	t.Parallel()
+	testLaptopStoreTextSearch(t, service.NewSQLLaptopStore(openTestSQLiteDatabase(t)))
+}
+
+func TestSQLLaptopStore(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewSQLLaptopStore(openTestSQLiteDatabase(t))
+	laptop := sample.NewLaptop()
+	require.NoError(t, store.Save(laptop))
+	require.ErrorIs(t, store.Save(laptop), service.ErrAlreadyExists)
+
+	found, err := store.Find(laptop.Id)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(laptop, found))
+
+	others := []*pb.Laptop{sample.NewLaptop(), sample.NewLaptop(), laptop}
+	i, err := store.SaveAll(others)
+	require.ErrorIs(t, err, service.ErrAlreadyExists)
+	require.Equal(t, 2, i)
+	_, err = store.Find(others[0].Id)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	i, err = store.SaveAll(others[:2])
+	require.NoError(t, err)
+	require.Equal(t, 0, i)
+
+	update := &pb.Laptop{Id: laptop.Id, PriceUsd: 999, UpdatedAt: laptop.UpdatedAt}
+	updated, err := store.Update(update, []string{"price_usd"})
+	require.NoError(t, err)
+	require.Equal(t, 999.0, updated.GetPriceUsd())
+	require.Equal(t, laptop.Brand, updated.GetBrand())
+	_, err = store.Update(update, []string{"price_usd"})
+	require.ErrorIs(t, err, service.ErrConflict)
+
+	require.NoError(t, store.Delete(laptop.Id, "admin1"))
+	require.ErrorIs(t, store.Delete(laptop.Id, "admin1"), service.ErrNotFound)
+	_, err = store.Find(laptop.Id)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.ErrorIs(t, store.Save(laptop), service.ErrAlreadyExists)
+
+	purged, err := store.PurgeDeleted(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	require.NoError(t, store.Save(laptop))
+}
+
+func TestSQLLaptopStoreList(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewSQLLaptopStore(openTestSQLiteDatabase(t))
+	laptops := make([]*pb.Laptop, 7)
+	for i := range laptops {
+		laptops[i] = sample.NewLaptop()
+		laptops[i].PriceUsd = float64(1000 + i%3*100)
+		require.NoError(t, store.Save(laptops[i]))
+	}
+
+	order, err := service.ParseLaptopOrder("price_usd desc")
+	require.NoError(t, err)
+	sort.Slice(laptops, func(i, j int) bool {
+		if laptops[i].PriceUsd != laptops[j].PriceUsd {
+			return laptops[i].PriceUsd > laptops[j].PriceUsd
+		}
+		return laptops[i].Id < laptops[j].Id
+	})
+
+	var ids []string
+	var after *service.LaptopCursor
+	for {
+		page, err := store.List(context.Background(), order, after, 3)
+		require.NoError(t, err)
+		for _, laptop := range page {
+			ids = append(ids, laptop.Id)
+		}
+		if len(page) < 3 {
+			break
+		}
+		last := page[len(page)-1]
+		after = &service.LaptopCursor{Order: order.String(), Key: last.PriceUsd, ID: last.Id}
+	}
+
+	require.Len(t, ids, len(laptops))
+	for i, laptop := range laptops {
+		require.Equal(t, laptop.Id, ids[i])
+	}
+}
+
+func TestSQLUserStore(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewSQLUserStore(openTestSQLiteDatabase(t))
+	user, err := service.NewUser("user1", "secret", "user")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(user))
+	require.ErrorIs(t, store.Save(user), service.ErrAlreadyExists)
+
+	found, err := store.Find("user1")
+	require.NoError(t, err)
+	require.Equal(t, user, found)
+	require.True(t, found.IsCorrectPassword("secret"))
+
+	_, err = store.Find("user2")
+	require.Error(t, err)
+}
+
+func TestSQLRatingStore(t *testing.T) {
+	t.Parallel()
+	testRatingStore(t, service.NewSQLRatingStore(openTestSQLiteDatabase(t)))
+}
+
+func TestSQLReviewStore(t *testing.T) {
+	t.Parallel()
+	testReviewStore(t, service.NewSQLReviewStore(openTestSQLiteDatabase(t)))
+}
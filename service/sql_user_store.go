@@ -0,0 +1,40 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type SQLUserStore struct {
+	db *sql.DB
+}
+
+func NewSQLUserStore(db *sql.DB) *SQLUserStore {
+	return &SQLUserStore{db: db}
+}
+
+func (store *SQLUserStore) Save(user *User) error {
+	_, err := store.db.Exec(`INSERT INTO users (username, hashed_password, role) VALUES (?, ?, ?)`,
+		user.Username, user.HashedPassword, user.Role)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("cannot insert user: %w", err)
+	}
+	return nil
+}
+
+func (store *SQLUserStore) Find(username string) (*User, error) {
+	user := &User{}
+	err := store.db.QueryRow(`SELECT username, hashed_password, role FROM users WHERE username = ?`, username).
+		Scan(&user.Username, &user.HashedPassword, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user with username %s not found", username)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot query user: %w", err)
+	}
+	return user, nil
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// textIndex is an inverted index ranking documents by BM25
+type textIndex struct {
+	// postings maps a term to the frequency of the term in each document
+	postings map[string]map[string]int
+	// lengths is the number of terms of each document
+	lengths map[string]int
+	// docTerms are the distinct terms of each document
+	docTerms    map[string][]string
+	totalLength int
+	// terms are sorted for prefix lookups
+	terms []string
+}
+
+type scoredID struct {
+	id    string
+	score float64
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		postings: make(map[string]map[string]int),
+		lengths:  make(map[string]int),
+		docTerms: make(map[string][]string),
+	}
+}
+
+// tokenize splits a text into lower-case terms of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+// add indexes the texts of a document, replacing a previous version of it
+func (index *textIndex) add(id string, texts ...string) {
+	index.remove(id)
+
+	length := 0
+	var terms []string
+	for _, text := range texts {
+		for _, term := range tokenize(text) {
+			docs := index.postings[term]
+			if docs == nil {
+				docs = make(map[string]int)
+				index.postings[term] = docs
+				index.insertTerm(term)
+			}
+			if docs[id] == 0 {
+				terms = append(terms, term)
+			}
+			docs[id]++
+			length++
+		}
+	}
+
+	index.lengths[id] = length
+	index.docTerms[id] = terms
+	index.totalLength += length
+}
+
+func (index *textIndex) remove(id string) {
+	length, ok := index.lengths[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range index.docTerms[id] {
+		docs := index.postings[term]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(index.postings, term)
+			index.deleteTerm(term)
+		}
+	}
+
+	delete(index.lengths, id)
+	delete(index.docTerms, id)
+	index.totalLength -= length
+}
+
+func (index *textIndex) insertTerm(term string) {
+	i := sort.SearchStrings(index.terms, term)
+	index.terms = append(index.terms, "")
+	copy(index.terms[i+1:], index.terms[i:])
+	index.terms[i] = term
+}
+
+func (index *textIndex) deleteTerm(term string) {
+	i := sort.SearchStrings(index.terms, term)
+	if i < len(index.terms) && index.terms[i] == term {
+		index.terms = append(index.terms[:i], index.terms[i+1:]...)
+	}
+}
+
+// termsWithPrefix returns the indexed terms starting with prefix
+func (index *textIndex) termsWithPrefix(prefix string) []string {
+	i := sort.SearchStrings(index.terms, prefix)
+	j := i
+	for j < len(index.terms) && strings.HasPrefix(index.terms[j], prefix) {
+		j++
+	}
+	return index.terms[i:j]
+}
+
+// search returns the documents containing every query term ranked by BM25,
+// the last term also matches as a prefix for typeahead
+func (index *textIndex) search(query string) []scoredID {
+	queryTerms := tokenize(query)
+	if len(queryTerms) == 0 || len(index.lengths) == 0 {
+		return nil
+	}
+
+	avgLength := float64(index.totalLength) / float64(len(index.lengths))
+	var scores map[string]float64
+	for i, queryTerm := range queryTerms {
+		terms := []string{queryTerm}
+		if i == len(queryTerms)-1 {
+			terms = index.termsWithPrefix(queryTerm)
+		}
+
+		// a document scores the best of the terms expanded from the query term
+		termScores := make(map[string]float64)
+		for _, term := range terms {
+			docs := index.postings[term]
+			idf := index.idf(len(docs))
+			for id, freq := range docs {
+				tf := float64(freq)
+				norm := tf + bm25K1*(1-bm25B+bm25B*float64(index.lengths[id])/avgLength)
+				score := idf * tf * (bm25K1 + 1) / norm
+				if score > termScores[id] {
+					termScores[id] = score
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for id, score := range scores {
+			termScore, ok := termScores[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] = score + termScore
+		}
+	}
+
+	results := make([]scoredID, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, scoredID{id: id, score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].id < results[j].id
+	})
+	return results
+}
+
+func (index *textIndex) idf(docFreq int) float64 {
+	n := float64(len(index.lengths))
+	df := float64(docFreq)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// suggest completes the last word of the prefix with the terms found in most documents
+func (index *textIndex) suggest(prefix string, limit int) []string {
+	words := tokenize(prefix)
+	if len(words) == 0 || limit <= 0 {
+		return nil
+	}
+
+	last := words[len(words)-1]
+	terms := append([]string(nil), index.termsWithPrefix(last)...)
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(index.postings[terms[i]]) > len(index.postings[terms[j]])
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+
+	head := strings.Join(words[:len(words)-1], " ")
+	suggestions := make([]string, len(terms))
+	for i, term := range terms {
+		if len(head) > 0 {
+			term = head + " " + term
+		}
+		suggestions[i] = term
+	}
+	return suggestions
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultUploadTTL is how long an upload session is kept without activity unless it is configured
+const DefaultUploadTTL = time.Hour
+
+// uploadFileExt is the extension of the files keeping the data of the sessions
+const uploadFileExt = ".upload"
+
+var ErrOffsetMismatch = errors.New("chunk offset does not match the committed size")
+var ErrSizeMismatch = errors.New("upload size does not match the committed size")
+var ErrChecksumMismatch = errors.New("upload checksum does not match")
+
+type UploadSessionConfig struct {
+	// Folder keeps the data of the unfinished uploads
+	Folder string
+	// TTL is how long a session is kept after its last chunk
+	TTL time.Duration
+	// MaxImageSize is the size limit of an upload in bytes
+	MaxImageSize int64
+}
+
+// UploadSession is an unfinished image upload, its data is appended chunk by chunk
+type UploadSession struct {
+	ID         string
+	LaptopID   string
+	ImageType  string
+	UploadedBy string
+	// Size is the number of committed bytes
+	Size      int64
+	ExpiresAt time.Time
+
+	mutex sync.Mutex
+	file  *os.File
+	hash  hash.Hash
+	// closed is set once the session is finished or expired
+	closed bool
+}
+
+// UploadSessionStore keeps the upload sessions in memory and their data in files,
+// sessions expire after the TTL without a chunk
+type UploadSessionStore struct {
+	mutex    sync.Mutex
+	config   UploadSessionConfig
+	sessions map[string]*UploadSession
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewUploadSessionStore(config UploadSessionConfig) (*UploadSessionStore, error) {
+	if config.TTL <= 0 {
+		config.TTL = DefaultUploadTTL
+	}
+	if config.MaxImageSize <= 0 {
+		config.MaxImageSize = DefaultMaxImageSize
+	}
+
+	err := os.MkdirAll(config.Folder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create upload folder: %w", err)
+	}
+
+	// the sessions are kept in memory, so the data left by a previous process can not be resumed.
+	// Only the files without a chunk for the TTL are removed, the others may be the sessions
+	// of another server sharing the folder
+	names, err := filepath.Glob(filepath.Join(config.Folder, "*"+uploadFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list upload folder: %w", err)
+	}
+	stale := 0
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err == nil && time.Since(info.ModTime()) > config.TTL {
+			err = os.Remove(name)
+			stale++
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot remove stale upload file: %w", err)
+		}
+	}
+	if stale > 0 {
+		log.Printf("removed %d stale upload files", stale)
+	}
+
+	store := &UploadSessionStore{
+		config:   config,
+		sessions: make(map[string]*UploadSession),
+		done:     make(chan struct{}),
+	}
+
+	store.wg.Add(1)
+	go store.expirePeriodically()
+	return store, nil
+}
+
+// Start creates a session for an image of a laptop
+func (store *UploadSessionStore) Start(laptopID string, imageType string, uploadedBy string) (*UploadSession, error) {
+	uploadID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate a new upload ID: %w", err)
+	}
+
+	file, err := os.Create(filepath.Join(store.config.Folder, uploadID.String()+uploadFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create upload file: %w", err)
+	}
+
+	session := &UploadSession{
+		ID:         uploadID.String(),
+		LaptopID:   laptopID,
+		ImageType:  imageType,
+		UploadedBy: uploadedBy,
+		ExpiresAt:  time.Now().Add(store.config.TTL),
+		file:       file,
+		hash:       sha256.New(),
+	}
+
+	other := session.info()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.sessions[session.ID] = session
+	return other, nil
+}
+
+// lock returns the session with the id locked, or ErrNotFound if there is none or it has expired
+func (store *UploadSessionStore) lock(uploadID string) (*UploadSession, error) {
+	store.mutex.Lock()
+	session := store.sessions[uploadID]
+	store.mutex.Unlock()
+
+	if session == nil {
+		return nil, fmt.Errorf("upload with id %s: %w", uploadID, ErrNotFound)
+	}
+
+	session.mutex.Lock()
+	if !session.closed && session.ExpiresAt.Before(time.Now()) {
+		store.remove(session)
+	}
+	if session.closed {
+		session.mutex.Unlock()
+		return nil, fmt.Errorf("upload with id %s: %w", uploadID, ErrNotFound)
+	}
+	return session, nil
+}
+
+// Write appends a chunk at the offset and returns the committed size.
+// The part of a chunk before the committed size is skipped, so a chunk can be sent again,
+// but a chunk after the committed size is refused with ErrOffsetMismatch
+func (store *UploadSessionStore) Write(uploadID string, offset int64, data []byte) (int64, error) {
+	session, err := store.lock(uploadID)
+	if err != nil {
+		return 0, err
+	}
+	defer session.mutex.Unlock()
+
+	if offset > session.Size {
+		return session.Size, fmt.Errorf("offset %d, committed %d: %w", offset, session.Size, ErrOffsetMismatch)
+	}
+
+	skip := session.Size - offset
+	if skip >= int64(len(data)) {
+		return session.Size, nil
+	}
+	data = data[skip:]
+
+	if session.Size+int64(len(data)) > store.config.MaxImageSize {
+		return session.Size, fmt.Errorf("upload is larger than %d bytes: %w", store.config.MaxImageSize, ErrImageTooLarge)
+	}
+
+	n, err := session.file.Write(data)
+	session.hash.Write(data[:n])
+	session.Size += int64(n)
+	if err != nil {
+		return session.Size, fmt.Errorf("cannot write upload data: %w", err)
+	}
+
+	session.ExpiresAt = time.Now().Add(store.config.TTL)
+	return session.Size, nil
+}
+
+// Find returns a copy of the session
+func (store *UploadSessionStore) Find(uploadID string) (*UploadSession, error) {
+	session, err := store.lock(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer session.mutex.Unlock()
+
+	return session.info(), nil
+}
+
+// Finish checks the size and the SHA-256 checksum in hex of the upload, then calls save with its data.
+// The session is removed once save succeeds, it is kept on a mismatch so that finishing can be retried
+func (store *UploadSessionStore) Finish(uploadID string, size int64, checksum string, save func(session *UploadSession, data io.Reader) error) error {
+	session, err := store.lock(uploadID)
+	if err != nil {
+		return err
+	}
+	defer session.mutex.Unlock()
+
+	if size != session.Size {
+		return fmt.Errorf("size %d, committed %d: %w", size, session.Size, ErrSizeMismatch)
+	}
+
+	if !strings.EqualFold(hex.EncodeToString(session.hash.Sum(nil)), checksum) {
+		return ErrChecksumMismatch
+	}
+
+	_, err = session.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("cannot seek upload file: %w", err)
+	}
+
+	err = save(session.info(), session.file)
+	if err != nil {
+		return err
+	}
+
+	store.remove(session)
+	return nil
+}
+
+// remove deletes a locked session and its data
+func (store *UploadSessionStore) remove(session *UploadSession) {
+	store.mutex.Lock()
+	delete(store.sessions, session.ID)
+	store.mutex.Unlock()
+
+	session.closed = true
+	session.file.Close()
+	err := os.Remove(session.file.Name())
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("cannot remove upload file: %v", err)
+	}
+}
+
+// list returns the sessions, they must be locked after the store mutex is released
+func (store *UploadSessionStore) list() []*UploadSession {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	sessions := make([]*UploadSession, 0, len(store.sessions))
+	for _, session := range store.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Expire removes the sessions which expired before now and returns how many they were
+func (store *UploadSessionStore) Expire(now time.Time) int {
+	expired := 0
+	for _, session := range store.list() {
+		session.mutex.Lock()
+		if !session.closed && session.ExpiresAt.Before(now) {
+			store.remove(session)
+			expired++
+		}
+		session.mutex.Unlock()
+	}
+	return expired
+}
+
+func (store *UploadSessionStore) expirePeriodically() {
+	defer store.wg.Done()
+
+	ticker := time.NewTicker(store.config.TTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-store.done:
+			return
+		case now := <-ticker.C:
+			if expired := store.Expire(now); expired > 0 {
+				log.Printf("expired %d upload sessions", expired)
+			}
+		}
+	}
+}
+
+// Close stops expiring the sessions and removes them with their data,
+// the sessions are kept in memory so they can not be resumed by another store
+func (store *UploadSessionStore) Close() error {
+	close(store.done)
+	store.wg.Wait()
+
+	// the sessions are locked after the store like in Expire, lock holds a session while it removes it
+	for _, session := range store.list() {
+		session.mutex.Lock()
+		if !session.closed {
+			store.remove(session)
+		}
+		session.mutex.Unlock()
+	}
+	return nil
+}
+
+// info returns a copy of the exported fields of a locked session
+func (session *UploadSession) info() *UploadSession {
+	return &UploadSession{
+		ID:         session.ID,
+		LaptopID:   session.LaptopID,
+		ImageType:  session.ImageType,
+		UploadedBy: session.UploadedBy,
+		Size:       session.Size,
+		ExpiresAt:  session.ExpiresAt,
+	}
+}
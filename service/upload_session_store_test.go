@@ -0,0 +1,151 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"pcbook/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadSessionStore(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store, err := service.NewUploadSessionStore(service.UploadSessionConfig{Folder: folder, MaxImageSize: 10})
+	require.NoError(t, err)
+	defer store.Close()
+
+	session, err := store.Start("laptop", ".jpg", "admin1")
+	require.NoError(t, err)
+
+	committed, err := store.Write(session.ID, 0, []byte("hello"))
+	require.NoError(t, err)
+	require.EqualValues(t, 5, committed)
+
+	// a chunk sent again is skipped, the new part of an overlapping chunk is appended
+	committed, err = store.Write(session.ID, 0, []byte("hel"))
+	require.NoError(t, err)
+	require.EqualValues(t, 5, committed)
+	committed, err = store.Write(session.ID, 3, []byte("lo wo"))
+	require.NoError(t, err)
+	require.EqualValues(t, 8, committed)
+
+	_, err = store.Write(session.ID, 9, []byte("d"))
+	require.ErrorIs(t, err, service.ErrOffsetMismatch)
+	_, err = store.Write(session.ID, 8, []byte("rld"))
+	require.ErrorIs(t, err, service.ErrImageTooLarge)
+	_, err = store.Write("unknown", 0, []byte("a"))
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	found, err := store.Find(session.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 8, found.Size)
+	require.Equal(t, "laptop", found.LaptopID)
+
+	save := func(session *service.UploadSession, data io.Reader) error {
+		t.Fatal("save must not be called")
+		return nil
+	}
+	err = store.Finish(session.ID, 9, checksum([]byte("hello wo")), save)
+	require.ErrorIs(t, err, service.ErrSizeMismatch)
+
+	var saved []byte
+	err = store.Finish(session.ID, 8, checksum([]byte("hello wo")), func(session *service.UploadSession, data io.Reader) error {
+		saved, err = io.ReadAll(data)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "hello wo", string(saved))
+
+	_, err = store.Find(session.ID)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	session, err = store.Start("laptop", ".jpg", "admin1")
+	require.NoError(t, err)
+	_, err = store.Write(session.ID, 0, []byte("data"))
+	require.NoError(t, err)
+	err = store.Finish(session.ID, 4, checksum([]byte("atad")), save)
+	require.ErrorIs(t, err, service.ErrChecksumMismatch)
+
+	// the upload is kept after a wrong checksum, and the checksum is not case sensitive
+	err = store.Finish(session.ID, 4, strings.ToUpper(checksum([]byte("data"))), func(session *service.UploadSession, data io.Reader) error {
+		saved, err = io.ReadAll(data)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "data", string(saved))
+	_, err = store.Find(session.ID)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	entries, err := os.ReadDir(folder)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestUploadSessionStoreExpire(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	store, err := service.NewUploadSessionStore(service.UploadSessionConfig{Folder: folder, TTL: time.Minute})
+	require.NoError(t, err)
+	defer store.Close()
+
+	session, err := store.Start("laptop", ".jpg", "admin1")
+	require.NoError(t, err)
+	_, err = store.Write(session.ID, 0, []byte("data"))
+	require.NoError(t, err)
+
+	require.Zero(t, store.Expire(time.Now()))
+	require.Equal(t, 1, store.Expire(time.Now().Add(2*time.Minute)))
+
+	_, err = store.Write(session.ID, 4, []byte("more"))
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	entries, err := os.ReadDir(folder)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestUploadSessionStoreClose(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	// the data of a previous process can not be resumed, but a recent upload may be another server's
+	stale := filepath.Join(folder, "stale.upload")
+	require.NoError(t, os.WriteFile(stale, []byte("hello"), 0644))
+	lastChunk := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, os.Chtimes(stale, lastChunk, lastChunk))
+	live := filepath.Join(folder, "live.upload")
+	require.NoError(t, os.WriteFile(live, []byte("hello"), 0644))
+	other := filepath.Join(folder, "notes.txt")
+	require.NoError(t, os.WriteFile(other, []byte("hello"), 0644))
+
+	store, err := service.NewUploadSessionStore(service.UploadSessionConfig{Folder: folder, TTL: time.Minute})
+	require.NoError(t, err)
+	require.NoFileExists(t, stale)
+	require.FileExists(t, live)
+	require.FileExists(t, other)
+
+	session, err := store.Start("laptop", ".jpg", "admin1")
+	require.NoError(t, err)
+	_, err = store.Write(session.ID, 0, []byte("hello"))
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(folder, session.ID+".upload"))
+
+	require.NoError(t, store.Close())
+	require.NoFileExists(t, filepath.Join(folder, session.ID+".upload"))
+	_, err = store.Find(session.ID)
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
@@ -0,0 +1,208 @@
+// Package validation checks the domain rules of the pcbook messages
+package validation
+
+import (
+	"fmt"
+	"math"
+	"pcbook/pb"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// minReleaseYear is the oldest release year accepted for a laptop
+const minReleaseYear = 1970
+
+// Violations are the fields of a message breaking a rule
+type Violations []*errdetails.BadRequest_FieldViolation
+
+// isFinite tells if the value is neither NaN nor infinite,
+// NaN fails every comparison and would pass the range checks below
+func isFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+func (violations *Violations) add(field string, format string, args ...interface{}) {
+	*violations = append(*violations, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// Err returns nil if there is no violation, otherwise an InvalidArgument status
+// naming the invalid subject, with the violations as google.rpc.BadRequest details
+func (violations Violations) Err(subject string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	st := status.Newf(codes.InvalidArgument, "%s is invalid: %d field violations, first: %s: %s",
+		subject, len(violations), violations[0].Field, violations[0].Description)
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// ValidateLaptop returns every violation of the laptop and its nested messages
+func ValidateLaptop(laptop *pb.Laptop) Violations {
+	var violations Violations
+
+	if _, err := uuid.Parse(laptop.GetId()); err != nil {
+		violations.add("id", "must be a UUID")
+	}
+	if laptop.GetBrand() == "" {
+		violations.add("brand", "must not be empty")
+	}
+	if laptop.GetName() == "" {
+		violations.add("name", "must not be empty")
+	}
+
+	if laptop.GetCpu() == nil {
+		violations.add("cpu", "is required")
+	} else {
+		validateCPU(&violations, "cpu", laptop.GetCpu())
+	}
+
+	if laptop.GetRam() == nil {
+		violations.add("ram", "is required")
+	} else {
+		validateMemory(&violations, "ram", laptop.GetRam())
+	}
+
+	for i, gpu := range laptop.GetGpus() {
+		validateGPU(&violations, fmt.Sprintf("gpus[%d]", i), gpu)
+	}
+	for i, storage := range laptop.GetStorages() {
+		validateStorage(&violations, fmt.Sprintf("storages[%d]", i), storage)
+	}
+
+	if laptop.GetScreen() == nil {
+		violations.add("screen", "is required")
+	} else {
+		validateScreen(&violations, "screen", laptop.GetScreen())
+	}
+
+	if laptop.GetKeyboard() == nil {
+		violations.add("keyboard", "is required")
+	} else if laptop.GetKeyboard().GetLayout() == pb.Keyboard_UNKOWN {
+		violations.add("keyboard.layout", "must be specified")
+	}
+
+	switch weight := laptop.GetWeight().(type) {
+	case *pb.Laptop_WeightKg:
+		if !isFinite(weight.WeightKg) {
+			violations.add("weight_kg", "must be a finite number, got %v", weight.WeightKg)
+		} else if weight.WeightKg <= 0 {
+			violations.add("weight_kg", "must be positive, got %v", weight.WeightKg)
+		}
+	case *pb.Laptop_WeightLb:
+		if !isFinite(weight.WeightLb) {
+			violations.add("weight_lb", "must be a finite number, got %v", weight.WeightLb)
+		} else if weight.WeightLb <= 0 {
+			violations.add("weight_lb", "must be positive, got %v", weight.WeightLb)
+		}
+	}
+
+	if !isFinite(laptop.GetPriceUsd()) {
+		violations.add("price_usd", "must be a finite number, got %v", laptop.GetPriceUsd())
+	} else if laptop.GetPriceUsd() < 0 {
+		violations.add("price_usd", "must not be negative, got %v", laptop.GetPriceUsd())
+	}
+
+	maxReleaseYear := uint32(time.Now().Year() + 1)
+	if year := laptop.GetReleaseYear(); year < minReleaseYear || year > maxReleaseYear {
+		violations.add("release_year", "must be between %d and %d, got %d", minReleaseYear, maxReleaseYear, year)
+	}
+
+	return violations
+}
+
+func validateCPU(violations *Violations, field string, cpu *pb.CPU) {
+	if cpu.GetBrand() == "" {
+		violations.add(field+".brand", "must not be empty")
+	}
+	if cpu.GetName() == "" {
+		violations.add(field+".name", "must not be empty")
+	}
+	if cpu.GetNumberCores() == 0 {
+		violations.add(field+".number_cores", "must be positive")
+	}
+	if cpu.GetNumberThreads() < cpu.GetNumberCores() {
+		violations.add(field+".number_threads", "must not be less than number_cores %d, got %d", cpu.GetNumberCores(), cpu.GetNumberThreads())
+	}
+	validateFrequency(violations, field, cpu.GetMinGhz(), cpu.GetMaxGhz())
+}
+
+func validateGPU(violations *Violations, field string, gpu *pb.GPU) {
+	if gpu.GetBrand() == "" {
+		violations.add(field+".brand", "must not be empty")
+	}
+	if gpu.GetName() == "" {
+		violations.add(field+".name", "must not be empty")
+	}
+	validateFrequency(violations, field, gpu.GetMinGhz(), gpu.GetMaxGhz())
+	if gpu.GetMemory() == nil {
+		violations.add(field+".memory", "is required")
+	} else {
+		validateMemory(violations, field+".memory", gpu.GetMemory())
+	}
+}
+
+func validateFrequency(violations *Violations, field string, minGhz, maxGhz float64) {
+	if !isFinite(minGhz) {
+		violations.add(field+".min_ghz", "must be a finite number, got %v", minGhz)
+	} else if minGhz <= 0 {
+		violations.add(field+".min_ghz", "must be positive, got %v", minGhz)
+	}
+	if !isFinite(maxGhz) {
+		violations.add(field+".max_ghz", "must be a finite number, got %v", maxGhz)
+	} else if maxGhz < minGhz {
+		violations.add(field+".max_ghz", "must not be less than min_ghz %v, got %v", minGhz, maxGhz)
+	}
+}
+
+func validateMemory(violations *Violations, field string, memory *pb.Memory) {
+	if memory.GetValue() == 0 {
+		violations.add(field+".value", "must be positive")
+	}
+	if memory.GetUnit() == pb.Memory_UNKNOWN {
+		violations.add(field+".unit", "must be specified")
+	}
+}
+
+func validateStorage(violations *Violations, field string, storage *pb.Storage) {
+	if storage.GetDriver() == pb.Storage_UNKOWN {
+		violations.add(field+".driver", "must be specified")
+	}
+	if storage.GetMemory() == nil {
+		violations.add(field+".memory", "is required")
+	} else {
+		validateMemory(violations, field+".memory", storage.GetMemory())
+	}
+}
+
+func validateScreen(violations *Violations, field string, screen *pb.Screen) {
+	if !isFinite(float64(screen.GetSizeInch())) {
+		violations.add(field+".size_inch", "must be a finite number, got %v", screen.GetSizeInch())
+	} else if screen.GetSizeInch() <= 0 {
+		violations.add(field+".size_inch", "must be positive, got %v", screen.GetSizeInch())
+	}
+	if screen.GetResolution() == nil {
+		violations.add(field+".resolution", "is required")
+	} else {
+		if screen.GetResolution().GetWidth() == 0 {
+			violations.add(field+".resolution.width", "must be positive")
+		}
+		if screen.GetResolution().GetHeight() == 0 {
+			violations.add(field+".resolution.height", "must be positive")
+		}
+	}
+	if screen.GetPanel() == pb.Screen_UNKOWN {
+		violations.add(field+".panel", "must be specified")
+	}
+}
@@ -0,0 +1,120 @@
+package validation_test
+
+import (
+	"math"
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/validation"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateLaptop(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		modify func(laptop *pb.Laptop)
+		fields []string
+	}{
+		{
+			name:   "valid",
+			modify: func(laptop *pb.Laptop) {},
+		}, {
+			name: "cpu_frequency_and_threads",
+			modify: func(laptop *pb.Laptop) {
+				laptop.Cpu.MinGhz = 3.5
+				laptop.Cpu.MaxGhz = 2.5
+				laptop.Cpu.NumberThreads = laptop.Cpu.NumberCores - 1
+			},
+			fields: []string{"cpu.number_threads", "cpu.max_ghz"},
+		}, {
+			name: "nested_messages",
+			modify: func(laptop *pb.Laptop) {
+				laptop.Ram.Unit = pb.Memory_UNKNOWN
+				laptop.Gpus[0].Memory = nil
+				laptop.Storages[1].Driver = pb.Storage_UNKOWN
+				laptop.Screen.SizeInch = 0
+				laptop.Screen.Resolution.Height = 0
+				laptop.Keyboard.Layout = pb.Keyboard_UNKOWN
+			},
+			fields: []string{
+				"ram.unit",
+				"gpus[0].memory",
+				"storages[1].driver",
+				"screen.size_inch",
+				"screen.resolution.height",
+				"keyboard.layout",
+			},
+		}, {
+			name: "top_level_fields",
+			modify: func(laptop *pb.Laptop) {
+				laptop.Id = "invalid-uuid"
+				laptop.Brand = ""
+				laptop.Cpu = nil
+				laptop.Weight = &pb.Laptop_WeightLb{WeightLb: -1}
+				laptop.PriceUsd = -100
+				laptop.ReleaseYear = 1900
+			},
+			fields: []string{"id", "brand", "cpu", "weight_lb", "price_usd", "release_year"},
+		}, {
+			name: "not_finite_numbers",
+			modify: func(laptop *pb.Laptop) {
+				laptop.Cpu.MinGhz = math.NaN()
+				laptop.Gpus[0].MaxGhz = math.Inf(1)
+				laptop.Screen.SizeInch = float32(math.NaN())
+				laptop.Weight = &pb.Laptop_WeightKg{WeightKg: math.Inf(-1)}
+				laptop.PriceUsd = math.NaN()
+			},
+			fields: []string{"cpu.min_ghz", "gpus[0].max_ghz", "screen.size_inch", "weight_kg", "price_usd"},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			laptop := sample.NewLaptop()
+			tc.modify(laptop)
+
+			violations := validation.ValidateLaptop(laptop)
+			fields := make([]string, len(violations))
+			for i, violation := range violations {
+				fields[i] = violation.GetField()
+				require.NotEmpty(t, violation.GetDescription())
+			}
+			require.Equal(t, len(tc.fields), len(fields), fields)
+			if len(tc.fields) > 0 {
+				require.Equal(t, tc.fields, fields)
+			}
+		})
+	}
+}
+
+func TestViolationsErr(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, validation.ValidateLaptop(sample.NewLaptop()).Err("laptop"))
+
+	laptop := sample.NewLaptop()
+	laptop.Brand = ""
+	laptop.PriceUsd = -1
+	err := validation.ValidateLaptop(laptop).Err("laptop")
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Contains(t, st.Message(), "laptop is invalid: 2 field violations")
+	require.Len(t, st.Details(), 1)
+
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.GetFieldViolations(), 2)
+	require.Equal(t, "brand", badRequest.GetFieldViolations()[0].GetField())
+	require.Equal(t, "price_usd", badRequest.GetFieldViolations()[1].GetField())
+}
@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"fmt"
+	"pcbook/pb"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// the length limits of a review, in characters
+const (
+	maxReviewTitleLength = 120
+	maxReviewBodyLength  = 5000
+	maxReviewPoints      = 10
+	maxReviewPointLength = 200
+)
+
+// ValidateReview returns every violation of the text of a review written by a user,
+// the rating is checked against the rating scale of the server
+func ValidateReview(review *pb.Review) Violations {
+	var violations Violations
+
+	if _, err := uuid.Parse(review.GetLaptopId()); err != nil {
+		violations.add("laptop_id", "must be a UUID")
+	}
+	validateText(&violations, "title", review.GetTitle(), maxReviewTitleLength)
+	validateText(&violations, "body", review.GetBody(), maxReviewBodyLength)
+	validatePoints(&violations, "pros", review.GetPros())
+	validatePoints(&violations, "cons", review.GetCons())
+
+	return violations
+}
+
+func validateText(violations *Violations, field string, text string, maxLength int) {
+	if strings.TrimSpace(text) == "" {
+		violations.add(field, "must not be empty")
+	} else if length := utf8.RuneCountInString(text); length > maxLength {
+		violations.add(field, "must be at most %d characters, got %d", maxLength, length)
+	}
+}
+
+func validatePoints(violations *Violations, field string, points []string) {
+	if len(points) > maxReviewPoints {
+		violations.add(field, "must have at most %d items, got %d", maxReviewPoints, len(points))
+	}
+	for i, point := range points {
+		validateText(violations, fmt.Sprintf("%s[%d]", field, i), point, maxReviewPointLength)
+	}
+}
@@ -0,0 +1,75 @@
+package validation_test
+
+import (
+	"pcbook/pb"
+	"pcbook/sample"
+	"pcbook/validation"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReview(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		modify func(review *pb.Review)
+		fields []string
+	}{
+		{
+			name:   "valid",
+			modify: func(review *pb.Review) {},
+		},
+		{
+			name:   "invalid laptop id",
+			modify: func(review *pb.Review) { review.LaptopId = "laptop" },
+			fields: []string{"laptop_id"},
+		},
+		{
+			name: "blank text",
+			modify: func(review *pb.Review) {
+				review.Title = " "
+				review.Body = ""
+			},
+			fields: []string{"title", "body"},
+		},
+		{
+			name:   "long title",
+			modify: func(review *pb.Review) { review.Title = strings.Repeat("é", 121) },
+			fields: []string{"title"},
+		},
+		{
+			name: "points",
+			modify: func(review *pb.Review) {
+				review.Pros = make([]string, 11)
+				for i := range review.Pros {
+					review.Pros[i] = "fast"
+				}
+				review.Cons = []string{"heavy", ""}
+			},
+			fields: []string{"pros", "cons[1]"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			review := sample.NewReview(sample.NewLaptop().GetId())
+			tc.modify(review)
+
+			var fields []string
+			for _, violation := range validation.ValidateReview(review) {
+				fields = append(fields, violation.GetField())
+			}
+			require.Equal(t, tc.fields, fields)
+		})
+	}
+
+	review := sample.NewReview(sample.NewLaptop().GetId())
+	review.LaptopId = ""
+	require.ErrorContains(t, validation.ValidateReview(review).Err("review"), "review is invalid: 1 field violations")
+}